@@ -88,6 +88,9 @@ func init() {
 	if err != nil {
 		log.Fatalln("Failed to load environment variables! \n", err.Error())
 	}
+	if err := utils.CheckTokenSecret(&config); err != nil {
+		log.Fatalln("Invalid configuration:", err.Error())
+	}
 
 	initializers.ConnectDB(&config)
 	initializers.ConnectRedis(&config)
@@ -301,6 +304,7 @@ func main() {
 					Preload("Catygory.Translations", "language = ?", language).
 					Preload("User").
 					Preload("Hashtags").
+					Where("status = ?", "ACTIVE").
 					Order("RANDOM()").
 					Limit(2).
 					Find(&blogs).
@@ -311,6 +315,7 @@ func main() {
 					return // Exit or handle the error appropriately
 				}
 
+				shown := make([]uint64, 0, len(blogs))
 				for _, blog := range blogs {
 					blogJSON, err := json.Marshal(blog)
 					if err != nil {
@@ -332,8 +337,10 @@ func main() {
 						continue
 					}
 					bufferPool.ReleaseBuffer(buffer)
+					shown = append(shown, blog.ID)
 
 				}
+				utils.RecordBlogEvent(utils.BlogEventImpression, shown...)
 			}
 
 			for byteQueue.Size() > 0 {
@@ -381,6 +388,7 @@ func main() {
 						Preload("Catygory.Translations", "language = ?", lang).
 						Preload("User").
 						Preload("Hashtags").
+						Where("status = ?", "ACTIVE").
 						Order("RANDOM()").
 						Limit(1).
 						First(&blog).
@@ -1148,6 +1156,49 @@ func main() {
 			utils.CheckPlan(bot)
 			utils.CheckSite(bot)
 			utils.CheckSiteTime(bot)
+			utils.CleanupDataExports()
+			utils.PurgeDeletedAccounts()
+			utils.SendSavedSearchDigests(bot)
+		}
+	}()
+
+	// Translate blog and profile texts in the background
+	utils.RunTranslationWorkers()
+
+	// Publish and unpublish scheduled blogs
+	scheduleTicker := time.NewTicker(utils.BlogScheduleInterval)
+	defer scheduleTicker.Stop()
+	go func() {
+		for range scheduleTicker.C {
+			utils.RunBlogSchedule()
+		}
+	}()
+
+	// Store blog activity counters
+	blogStatsTicker := time.NewTicker(utils.BlogStatsInterval)
+	defer blogStatsTicker.Stop()
+	go func() {
+		for range blogStatsTicker.C {
+			utils.RollupBlogStats()
+		}
+	}()
+
+	// Announce new blogs matching saved filters
+	savedSearchTicker := time.NewTicker(utils.SavedSearchInterval)
+	defer savedSearchTicker.Stop()
+	go func() {
+		for range savedSearchTicker.C {
+			utils.RunSavedSearchAlerts(bot)
+		}
+	}()
+
+	// Load currency rates from the rates file, if any
+	currencyRatesTicker := time.NewTicker(utils.CurrencyRatesInterval)
+	defer currencyRatesTicker.Stop()
+	go func() {
+		utils.RunCurrencyRatesFeed()
+		for range currencyRatesTicker.C {
+			utils.RunCurrencyRatesFeed()
 		}
 	}()
 
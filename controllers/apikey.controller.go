@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"strings"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func GetAPIKeys(c *fiber.Ctx) error {
+	var keys []models.APIKey
+	if err := initializers.DB.Order("created_at DESC").Find(&keys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve API keys",
+		})
+	}
+
+	res := make([]models.APIKeyResponse, 0, len(keys))
+	for i := range keys {
+		res = append(res, models.FilterAPIKeyRecord(&keys[i]))
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   res,
+	})
+}
+
+// CreateAPIKey mints a key. The plain key is returned only in this response.
+func CreateAPIKey(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	var payload models.CreateAPIKeyInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	plain, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to generate API key",
+		})
+	}
+
+	key := models.APIKey{
+		Name:      payload.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    strings.Join(payload.Scopes, " "),
+		CreatedBy: user.ID,
+	}
+
+	if payload.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, payload.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := initializers.DB.Create(&key).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create API key",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "API key created successfully, store it now as it will not be shown again",
+		"data": fiber.Map{
+			"key":    plain,
+			"apiKey": models.FilterAPIKeyRecord(&key),
+		},
+	})
+}
+
+func RevokeAPIKey(c *fiber.Ctx) error {
+	var key models.APIKey
+	if err := initializers.DB.First(&key, "id = ?", c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "API key not found",
+		})
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := initializers.DB.Model(&key).Update("revoked_at", now).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to revoke API key",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "API key revoked successfully",
+		"data":    models.FilterAPIKeyRecord(&key),
+	})
+}
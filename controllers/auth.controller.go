@@ -270,10 +270,18 @@ func SignUpBot(c *fiber.Ctx) error {
 
 func VerifyEmail(c *fiber.Ctx) error {
 	code := c.Params("verificationCode")
+	ip := utils.ClientIP(c)
+
+	if limited, err := rejectIfAuthLimited(c, utils.AuthActionVerifyEmail, ip, ""); limited {
+		return err
+	}
 
 	var updatedUser models.User
 	result := initializers.DB.First(&updatedUser, "verification_code = ?", code)
 	if result.Error != nil {
+		if _, err := utils.RegisterAuthFailure(utils.AuthActionVerifyEmail, ip, ""); err != nil {
+			log.Printf("auth limiter: %s", err)
+		}
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid verification code or user doesn't exist"})
 	}
 
@@ -309,12 +317,20 @@ func SignInUser(c *fiber.Ctx) error {
 	}
 
 	message := "Invalid email or password"
+	email := strings.ToLower(payload.Email)
+	ip := utils.ClientIP(c)
+
+	// Back off repeated failures and refuse locked accounts
+	if limited, err := rejectIfAuthLimited(c, utils.AuthActionLogin, ip, email); limited {
+		return err
+	}
 
 	// Find the user by email
 	var user models.User
-	err := initializers.DB.Where("email = ?", strings.ToLower(payload.Email)).First(&user).Error
+	err := initializers.DB.Where("email = ?", email).First(&user).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
+			registerLoginFailure(c, ip, email, nil)
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": message})
 		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Internal server error"})
@@ -328,60 +344,148 @@ func SignInUser(c *fiber.Ctx) error {
 	// Compare passwords
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password))
 	if err != nil {
+		registerLoginFailure(c, ip, email, &user)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": message})
 	}
 
+	utils.ResetAuthFailures(utils.AuthActionLogin, ip, email)
+
+	return beginSignIn(c, &user, payload.Session)
+}
+
+// rejectIfAuthLimited answers 429, or 423 for a locked account, with a
+// Retry-After header when the caller has to wait. The limiter fails open if
+// Redis is unavailable.
+func rejectIfAuthLimited(c *fiber.Ctx, action, ip, email string) (bool, error) {
+	status, err := utils.CheckAuthLimit(action, ip, email)
+	if err != nil {
+		log.Printf("auth limiter: %s", err)
+		return false, nil
+	}
+
+	if status.RetryAfter <= 0 {
+		return false, nil
+	}
+
+	utils.SetRetryAfter(c, status.RetryAfter)
+
+	if status.Locked {
+		return true, c.Status(fiber.StatusLocked).JSON(fiber.Map{"status": "fail", "message": "Account is temporarily locked after too many failed attempts"})
+	}
+
+	return true, c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"status": "fail", "message": "Too many attempts, please try again later"})
+}
+
+// registerLoginFailure counts a failed login and emails the owner when the
+// failure locks their account.
+func registerLoginFailure(c *fiber.Ctx, ip, email string, user *models.User) {
+	locked, err := utils.RegisterAuthFailure(utils.AuthActionLogin, ip, email)
+	if err != nil {
+		log.Printf("auth limiter: %s", err)
+		return
+	}
+
+	if !locked || user == nil {
+		return
+	}
+
+	config, _ := initializers.LoadConfig(".")
+	language := c.Query("language", "en")
+
+	var firstName = user.Name
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[1]
+	}
+
+	emailData := utils.EmailData{
+		URL:       "https://www." + config.ClientOrigin,
+		FirstName: firstName,
+	}
+
+	switch language {
+	case "ru":
+		emailData.Subject = "MYRUONLINE аккаунт временно заблокирован"
+	case "es":
+		emailData.Subject = "MYRUONLINE cuenta bloqueada temporalmente"
+	case "ke":
+		emailData.Subject = "MYRUONLINE ანგარიში დროებით დაბლოკილია"
+	default:
+		language = "en"
+		emailData.Subject = "MYRUONLINE account temporarily locked"
+	}
+
+	utils.SendEmail(user, &emailData, "accountLocked", language)
+}
+
+// beginSignIn finishes a first-factor login. With two-factor authentication
+// enabled it only hands out an mfa pending token for VerifyTwoFactor.
+func beginSignIn(c *fiber.Ctx, user *models.User, session string) error {
+	if user.TwoFactorEnabled {
+		mfaToken, err := utils.CreateMFAPendingToken(utils.MFAPending{UserID: user.ID.String(), Session: session})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Failed to start two-factor authentication"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"status":     "mfa_required",
+			"mfa_token":  mfaToken,
+			"expires_in": int(utils.MFAPendingTTL.Seconds()),
+		})
+	}
+
+	return completeSignIn(c, user, session)
+}
+
+// completeSignIn issues the token pair for an authenticated user, marks them
+// online and sets the access token cookie.
+func completeSignIn(c *fiber.Ctx, user *models.User, session string) error {
 	// Load configuration
 	config, _ := initializers.LoadConfig(".")
 
-	// Create access and refresh tokens
-	accessTokenDetails, err := utils.CreateToken(user.ID.String(), config.AccessTokenExpiresIn, config.AccessTokenPrivateKey)
-	if err != nil {
-		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"status": "fail", "message": "Failed to create access token"})
+	// Signing in within the grace period cancels a pending account deletion
+	restored := false
+	if user.DeletionRequestedAt != nil {
+		if err := utils.RestoreAccount(user); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Failed to restore account"})
+		}
+		restored = true
 	}
 
-	refreshTokenDetails, err := utils.CreateToken(user.ID.String(), config.RefreshTokenExpiresIn, config.RefreshTokenPrivateKey)
+	// Open a device session and create access and refresh tokens bound to it
+	accessTokenDetails, refreshTokenDetails, err := createSessionTokens(c, user, &config)
 	if err != nil {
-		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"status": "fail", "message": "Failed to create refresh token"})
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"status": "fail", "message": err.Error()})
 	}
 
 	// Update user session and status
-	user.Session = payload.Session
+	user.Session = session
 	user.Online = true
 
 	// Save updated user information to the database
-	if err := initializers.DB.Save(&user).Error; err != nil {
+	if err := initializers.DB.Save(user).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Failed to update user session"})
 	}
 
 	// Set user data in the context
-	c.Locals("user", &user)
+	c.Locals("user", user)
 
 	userID := user.ID.String()
 	var addintinal = ""
 	utils.UserActivity("userOnline", userID, addintinal)
 	// Send a personal message to the client
-	if err := utils.SendPersonalMessageToClient(payload.Session, "Hello Client"); err != nil {
+	if err := utils.SendPersonalMessageToClient(session, "Hello Client"); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Failed to send message to client"})
 	}
 
 	// Set access token cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "access_token",
-		Value:    *accessTokenDetails.Token,
-		Path:     "/",
-		SameSite: "Lax",
-		MaxAge:   config.AccessTokenMaxAge * 60,
-		Secure:   true,  // Consider setting this to true in production
-		HTTPOnly: false, // Consider making this true for better security
-		Domain:   config.ClientOrigin,
-	})
+	setAccessTokenCookie(c, accessTokenDetails, &config)
 
 	// Respond with success and tokens
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"status":        "success",
-		"access_token":  accessTokenDetails.Token,
-		"refresh_token": refreshTokenDetails,
+		"status":           "success",
+		"access_token":     accessTokenDetails.Token,
+		"refresh_token":    refreshTokenDetails,
+		"account_restored": restored,
 	})
 }
 
@@ -430,6 +534,14 @@ func RefreshAccessToken(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": err.Error()})
 	}
 
+	// Rotate the refresh token; a token that was already rotated revokes its whole session
+	session, err := utils.ConsumeRefreshToken(tokenClaims, config.RefreshTokenExpiresIn)
+	if err == utils.ErrRefreshTokenRevoked || err == utils.ErrRefreshTokenReused {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
 	var user models.User
 	err = initializers.DB.First(&user, "id = ?", tokenClaims.UserID).Error
 
@@ -441,23 +553,61 @@ func RefreshAccessToken(c *fiber.Ctx) error {
 		}
 	}
 
-	accessTokenDetails, err := utils.CreateToken(user.ID.String(), config.AccessTokenExpiresIn, config.AccessTokenPrivateKey)
+	accessTokenDetails, err := utils.CreateToken(user.ID.String(), session.ID, config.AccessTokenExpiresIn, config.AccessTokenPrivateKey)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	refreshTokenDetails, err := utils.CreateToken(user.ID.String(), session.ID, config.RefreshTokenExpiresIn, config.RefreshTokenPrivateKey)
 	if err != nil {
 		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"status": "fail", "message": err.Error()})
 	}
 
+	if err := utils.RegisterRefreshToken(refreshTokenDetails, config.RefreshTokenExpiresIn); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	setAccessTokenCookie(c, accessTokenDetails, &config)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "access_token": accessTokenDetails.Token, "refresh_token": refreshTokenDetails})
+}
+
+// createSessionTokens opens a new device session for user and issues the
+// access and refresh tokens bound to it.
+func createSessionTokens(c *fiber.Ctx, user *models.User, config *initializers.Config) (*utils.TokenDetails, *utils.TokenDetails, error) {
+	session, err := utils.StartSession(user.ID.String(), c.Get(fiber.HeaderUserAgent), utils.ClientIP(c), config.RefreshTokenExpiresIn)
+	if err != nil {
+		return nil, nil, errors.New("Failed to create session")
+	}
+
+	accessTokenDetails, err := utils.CreateToken(user.ID.String(), session.ID, config.AccessTokenExpiresIn, config.AccessTokenPrivateKey)
+	if err != nil {
+		return nil, nil, errors.New("Failed to create access token")
+	}
+
+	refreshTokenDetails, err := utils.CreateToken(user.ID.String(), session.ID, config.RefreshTokenExpiresIn, config.RefreshTokenPrivateKey)
+	if err != nil {
+		return nil, nil, errors.New("Failed to create refresh token")
+	}
+
+	if err := utils.RegisterRefreshToken(refreshTokenDetails, config.RefreshTokenExpiresIn); err != nil {
+		return nil, nil, errors.New("Failed to create refresh token")
+	}
+
+	return accessTokenDetails, refreshTokenDetails, nil
+}
+
+func setAccessTokenCookie(c *fiber.Ctx, accessTokenDetails *utils.TokenDetails, config *initializers.Config) {
 	c.Cookie(&fiber.Cookie{
 		Name:     "access_token",
 		Value:    *accessTokenDetails.Token,
 		Path:     "/",
 		SameSite: "Lax",
 		MaxAge:   config.AccessTokenMaxAge * 60,
-		Secure:   true,
-		HTTPOnly: false,
+		Secure:   true,  // Consider setting this to true in production
+		HTTPOnly: false, // Consider making this true for better security
 		Domain:   config.ClientOrigin,
 	})
-
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "access_token": accessTokenDetails.Token})
 }
 
 func ForgotPassword(c *fiber.Ctx) error {
@@ -480,6 +630,16 @@ func ForgotPassword(c *fiber.Ctx) error {
 		})
 	}
 
+	// Every reset request counts, so the mailbox cannot be flooded
+	ip := utils.ClientIP(c)
+	email := strings.ToLower(reqBody.Email)
+	if limited, err := rejectIfAuthLimited(c, utils.AuthActionForgot, ip, email); limited {
+		return err
+	}
+	if _, err := utils.RegisterAuthFailure(utils.AuthActionForgot, ip, email); err != nil {
+		log.Printf("auth limiter: %s", err)
+	}
+
 	// TODO: Check if the email exists in the database
 	user := new(models.User)
 	result := initializers.DB.Where("email = ?", reqBody.Email).First(user)
@@ -673,6 +833,13 @@ func LogoutUser(c *fiber.Ctx) error {
 
 	userRecord.Session = ""
 
+	// Revoke the device session so its access and refresh tokens stop working
+	if sessionID, ok := c.Locals("session_id").(string); ok && sessionID != "" {
+		if err := utils.RevokeSession(userRecord.ID.String(), sessionID); err != nil && err != utils.ErrSessionNotFound {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+		}
+	}
+
 	// Сохраните изменения и проверьте запрос
 	err = initializers.DB.Save(&userRecord).Error
 	if err != nil {
@@ -741,3 +908,123 @@ func GetUserDetails(c *fiber.Ctx) error {
 		"data":   res,
 	})
 }
+
+// registerExternalUser creates a verified account for someone who signed in
+// through an external identity provider. The password is random, so the
+// account can only be used through the provider or after a password reset.
+func registerExternalUser(name, email, provider, subject string) (*models.User, error) {
+	config, _ := initializers.LoadConfig(".")
+
+	randomPassword := make([]byte, 32)
+	if _, err := rand.Read(randomPassword); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(randomPassword)), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	// Generate a unique directory name
+	dirName := utils.GenerateUniqueDirName()
+
+	// Create the directory if it doesn't exist
+	if err := os.MkdirAll(filepath.Join(config.IMGStorePath, dirName), 0755); err != nil {
+		return nil, err
+	}
+
+	srcFile, err := os.Open(filepath.Join(config.IMGStorePath, "default.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(filepath.Join(config.IMGStorePath, dirName, "default.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	defer dstFile.Close()
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		return nil, err
+	}
+
+	code := make([]byte, 20)
+	if _, err := rand.Read(code); err != nil {
+		return nil, err
+	}
+
+	newUser := models.User{
+		Name:            uniqueUserName(name),
+		Email:           strings.ToLower(email),
+		Storage:         dirName,
+		Password:        string(hashedPassword),
+		Photo:           dirName + "/default.jpg",
+		Provider:        provider,
+		ProviderSubject: subject,
+		Verified:        true,
+		TelegramToken:   hex.EncodeToString(code),
+	}
+
+	if err := initializers.DB.Create(&newUser).Error; err != nil {
+		return nil, err
+	}
+
+	billing := models.Billing{
+		UserID: newUser.ID,
+		Amount: 100,
+	}
+
+	transaction := models.Transaction{
+		UserID:      newUser.ID,
+		Total:       `0`,
+		Amount:      100,
+		Description: `Бонус за регистрацию`,
+		Module:      `Registration`,
+		Type:        `profit`,
+		Status:      `CLOSED_1`,
+	}
+
+	onlineStorage := models.OnlineStorage{
+		UserID: newUser.ID,
+		Year:   time.Now().Year(),
+		Data:   []byte("[]"),
+	}
+
+	profile := models.Profile{
+		UserID: newUser.ID,
+	}
+
+	initializers.DB.Create(&onlineStorage)
+	initializers.DB.Create(&transaction)
+	initializers.DB.Create(&billing)
+	initializers.DB.Create(&profile)
+
+	return &newUser, nil
+}
+
+// uniqueUserName returns name, or name with a random suffix when it is taken.
+func uniqueUserName(name string) string {
+	name = strings.TrimSpace(name)
+	if len([]rune(name)) < 2 {
+		name = "user"
+	}
+	if runes := []rune(name); len(runes) > 90 {
+		name = string(runes[:90])
+	}
+
+	candidate := name
+	for i := 0; i < 5; i++ {
+		var count int64
+		initializers.DB.Model(&models.User{}).Where("name = ?", candidate).Count(&count)
+		if count == 0 {
+			return candidate
+		}
+
+		suffix := make([]byte, 3)
+		rand.Read(suffix)
+		candidate = name + "_" + hex.EncodeToString(suffix)
+	}
+
+	return candidate
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"strings"
+
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetAuthLocks lists locked accounts and keys currently in backoff.
+func GetAuthLocks(c *fiber.Ctx) error {
+	locks, err := utils.ListAuthLocks()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve locks",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   locks,
+	})
+}
+
+// ClearAuthLocks unlocks an account and/or IP given as ?email= and ?ip=.
+func ClearAuthLocks(c *fiber.Ctx) error {
+	email := strings.ToLower(strings.TrimSpace(c.Query("email")))
+	ip := strings.TrimSpace(c.Query("ip"))
+
+	if email == "" && ip == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "email or ip is required",
+		})
+	}
+
+	cleared, err := utils.ClearAuthLocks(email, ip)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to clear locks",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Locks cleared successfully",
+		"cleared": cleared,
+	})
+}
@@ -27,7 +27,6 @@ import (
 	"hyperpage/models"
 	"hyperpage/utils"
 
-	gt "github.com/bas24/googletranslatefree"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -101,36 +100,85 @@ type CityJSON struct {
 }
 
 type UserProfileJSON struct {
-	MultilangDescr models.MultilangTitle `json:"multilangtitle"`
-	Streaming      models.Streamings     `json:"streaming"`
+	MultilangDescr models.Multilang  `json:"multilangtitle"`
+	LocalDescr     string            `json:"localdescr"`
+	Streaming      models.Streamings `json:"streaming"`
 	// Add other fields from the user profile as needed
 }
 
 type blogResponse struct {
-	ID               uint64                `json:"id"`
-	Title            string                `json:"title"`
-	Descr            string                `json:"descr"`
-	Slug             string                `json:"slug"`
-	Status           string                `json:"status"`
-	MultilangTitle   models.MultilangTitle `json:"multilangtitle"`
-	MultilangDescr   models.MultilangTitle `json:"multilangdescr"`
-	MultilangContent models.MultilangTitle `json:"multilangcontent"`
-	Total            float64               `json:"total"`
-	Content          string                `json:"content"`
-	Lang             string                `json:"lang"`
-	Views            int                   `json:"views"`
-	UserAvatar       string                `json:"userAvatar"`
-	Photos           []models.BlogPhoto    `json:"photos"`
-	CreatedAt        time.Time             `json:"createdAt"`
-	UpdatedAt        time.Time             `json:"updatedAt"`
-	User             userResponse          `json:"user"`
-	City             []CityJSON            `json:"city"`
-	Pined            bool                  `json:"pined"`
-	Catygory         []CategoryJSON        `json:"catygory"`
-	UniqId           string                `json:"uniqId"`
-	Sticker          string                `json:"sticker"`
-	Hashtags         []string              `json:"hashtags"`
-	UserProfile      UserProfileJSON       `json:"userProfile"`
+	ID               uint64               `json:"id"`
+	Title            string               `json:"title"`
+	Descr            string               `json:"descr"`
+	Slug             string               `json:"slug"`
+	Status           string               `json:"status"`
+	MultilangTitle   models.Multilang     `json:"multilangtitle"`
+	MultilangDescr   models.Multilang     `json:"multilangdescr"`
+	MultilangContent models.Multilang     `json:"multilangcontent"`
+	LocalTitle       string               `json:"localtitle"`
+	LocalDescr       string               `json:"localdescr"`
+	LocalContent     string               `json:"localcontent"`
+	Total            float64              `json:"total"`
+	Content          string               `json:"content"`
+	Lang             string               `json:"lang"`
+	Views            int                  `json:"views"`
+	UserAvatar       string               `json:"userAvatar"`
+	Photos           []models.BlogPhoto   `json:"photos"`
+	CreatedAt        time.Time            `json:"createdAt"`
+	UpdatedAt        time.Time            `json:"updatedAt"`
+	User             userResponse         `json:"user"`
+	City             []CityJSON           `json:"city"`
+	Pined            bool                 `json:"pined"`
+	Catygory         []CategoryJSON       `json:"catygory"`
+	UniqId           string               `json:"uniqId"`
+	Sticker          string               `json:"sticker"`
+	Hashtags         []string             `json:"hashtags"`
+	UserProfile      UserProfileJSON      `json:"userProfile"`
+	Search           *utils.BlogSearchHit `json:"search,omitempty"`
+	Latitude         *float64             `json:"latitude"`
+	Longitude        *float64             `json:"longitude"`
+	Distance         *float64             `json:"distance_km,omitempty"`
+	Stations         []stationJSON        `json:"stations"`
+	Currency         string               `json:"currency"`
+	Converted        *convertedPrice      `json:"converted,omitempty"`
+}
+
+// convertedPrice is the price of a blog in the currency asked by the viewer.
+type convertedPrice struct {
+	Total    float64 `json:"total"`
+	Currency string  `json:"currency"`
+}
+
+const (
+	blogSortPriceAsc  = "price_asc"
+	blogSortPriceDesc = "price_desc"
+)
+
+// viewerCurrency reads ?currency=, the base currency by default, and the
+// rates to convert prices to it.
+func viewerCurrency(c *fiber.Ctx) (string, map[string]float64, error) {
+	rates, err := utils.CurrencyRates()
+	if err != nil {
+		return "", nil, err
+	}
+	currency := utils.NormalizeCurrency(c.Query("currency"))
+	if currency == "" {
+		currency = utils.BaseCurrency()
+	}
+	if _, ok := rates[currency]; !ok {
+		return "", nil, utils.ErrCurrencyUnknown
+	}
+	return currency, rates, nil
+}
+
+// blogConvertedPrice converts the price of a blog to currency, nil when its
+// currency has no rate.
+func blogConvertedPrice(b *models.Blog, currency string, rates map[string]float64) *convertedPrice {
+	total := utils.ConvertPrice(b.Total, b.Currency, currency, rates)
+	if total == nil {
+		return nil
+	}
+	return &convertedPrice{Total: *total, Currency: currency}
 }
 
 func AddFav(c *fiber.Ctx) error {
@@ -171,6 +219,7 @@ func AddFav(c *fiber.Ctx) error {
 			"error": "Could not create favorite",
 		})
 	}
+	utils.RecordBlogEvent(utils.BlogEventFavorite, blog.ID)
 
 	return c.Status(fiber.StatusOK).JSON(favorite)
 }
@@ -344,8 +393,8 @@ func SendToArchive(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user is the owner of the blog post or has admin rights
-	if userObj.Role != "admin" && blog.UserID != userObj.ID {
+	// Check if user is the owner of the blog post or may edit any blog
+	if !hasScopeAny(c) && blog.UserID != userObj.ID {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Unauthorized",
@@ -426,46 +475,8 @@ func CreateBlog(c *fiber.Ctx) error {
 	// replace special characters in blog.Slug
 	blog.Slug = replaceSpecialChars(blog.Slug)
 
-	// Fetch languages from the database
-	var langs []models.Langs
-	err := initializers.DB.Raw("SELECT * FROM langs").Scan(&langs).Error
-	if err != nil {
-		return err
-	}
-
-	translations := make(map[string]string)
-	translationsDescr := make(map[string]string)
-	translationsContent := make(map[string]string)
-
-	for _, lang := range langs {
-
-		result, _ := gt.Translate(blog.Title, blog.Lang, lang.Code)
-		translations[lang.Code] = result
-
-		resultDescr, _ := gt.Translate(blog.Descr, blog.Lang, lang.Code)
-		translationsDescr[lang.Code] = resultDescr
-
-		resultContent, _ := gt.Translate(blog.Content, blog.Lang, lang.Code)
-		translationsContent[lang.Code] = resultContent
-	}
-
-	// Set the translated values in the TitleLangs field
-	blog.MultilangTitle.En = translations["en"]
-	blog.MultilangTitle.Ru = translations["ru"]
-	blog.MultilangTitle.Ka = translations["ka"]
-	blog.MultilangTitle.Es = translations["es"]
-
-	// Set the translated values in the TitleLangs field
-	blog.MultilangDescr.En = translationsDescr["en"]
-	blog.MultilangDescr.Ru = translationsDescr["ru"]
-	blog.MultilangDescr.Ka = translationsDescr["ka"]
-	blog.MultilangDescr.Es = translationsDescr["es"]
-
-	// Set the translated values in the TitleLangs field
-	blog.MultilangContent.En = translationsContent["en"]
-	blog.MultilangContent.Ru = translationsContent["ru"]
-	blog.MultilangContent.Ka = translationsContent["ka"]
-	blog.MultilangContent.Es = translationsContent["es"]
+	// Cached translations are filled now, the rest after the blog is saved
+	prefillBlogTranslations(blog)
 
 	// Retrieve associated Hashtags from the database
 	hashtags := []models.Hashtags{}
@@ -517,6 +528,34 @@ func CreateBlog(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := utils.ValidateBlogSchedule(blog.PublishAt, blog.UnpublishAt); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	if err := utils.ValidateCoordinates(blog.Latitude, blog.Longitude); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	currency, err := utils.BlogCurrency(blog.Currency)
+	if err == utils.ErrCurrencyUnknown {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not check the currency",
+		})
+	}
+	blog.Currency = currency
+
 	// config, _ := initializers.LoadConfig(".")
 
 	// cfg := &initializers.Config{
@@ -586,6 +625,14 @@ func CreateBlog(c *fiber.Ctx) error {
 	// Commission * 0.05
 	amount := commission
 	module := "blog"
+
+	if blog.PublishAt != nil {
+		return createDeferredBlog(c, blog, user, uniqueID, amount, models.BlogStatusScheduled)
+	}
+	if utils.BlogNeedsReview(user) {
+		return createDeferredBlog(c, blog, user, uniqueID, amount, models.BlogStatusPendingReview)
+	}
+
 	if err := utils.DeductAmountFromUserBalance(userObj.ID, amount, total, module, elementId); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
@@ -756,6 +803,8 @@ func CreateBlog(c *fiber.Ctx) error {
 			// Create blog record in database
 			if err := initializers.DB.Create(&blog).Error; err != nil {
 				log.Println("Could not create blog:", err)
+			} else {
+				translateBlog(blog.ID)
 			}
 		}()
 
@@ -797,6 +846,8 @@ func CreateBlog(c *fiber.Ctx) error {
 	// Create blog record in database
 	if err := initializers.DB.Create(&blog).Error; err != nil {
 		log.Println("Could not create blog:", err)
+	} else {
+		translateBlog(blog.ID)
 	}
 
 	fmt.Println("END2")
@@ -808,6 +859,86 @@ func CreateBlog(c *fiber.Ctx) error {
 
 }
 
+// createDeferredBlog stores a blog that is not published yet: one scheduled
+// for blog.PublishAt or one waiting for review. The publication is charged
+// now, with the blog ID, so that a cancellation or rejection can be
+// refunded; the expiry is set and the blog announced once it goes live.
+func createDeferredBlog(c *fiber.Ctx, blog *models.Blog, user *models.User, uniqueID string, amount float64, status string) error {
+	blog.UserID = user.ID
+	blog.UniqId = uniqueID
+	blog.Status = status
+	blog.ExpiredAt = nil
+	blog.UserAvatar = user.Photo
+	blog.NotAds = blog.Total == 0
+
+	if err := initializers.DB.Create(blog).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not create blogs",
+		})
+	}
+
+	if err := utils.DeductAmountFromUserBalance(user.ID, amount, blog.Total, "blog", blog.ID); err != nil {
+		initializers.DB.Select(clause.Associations).Delete(blog)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Insufficient balance",
+		})
+	}
+	translateBlog(blog.ID)
+
+	user.TotalBlogs += 1
+	if err := initializers.DB.Save(user).Error; err != nil {
+		log.Println("Could not update user's total blogs count:", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   blog,
+	})
+}
+
+// CancelScheduledBlog cancels a blog before its publication and refunds it.
+func CancelScheduledBlog(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	var blog models.Blog
+	if err := initializers.DB.First(&blog, "id = ?", c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Element not found",
+		})
+	}
+
+	if !hasScopeAny(c) && blog.UserID != user.ID {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+	}
+
+	refunded, err := utils.CancelScheduledBlog(&blog)
+	if err == utils.ErrBlogNotScheduled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "fail",
+			"message": "Only scheduled posts can be cancelled",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not cancel blog",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"blog":     blog,
+			"refunded": refunded,
+		},
+	})
+}
+
 func formatPriceWithDots(price int) string {
 	formattedPrice := strconv.Itoa(price)
 	n := len(formattedPrice)
@@ -990,14 +1121,23 @@ func AddBlogTime(c *fiber.Ctx) error {
 		Role: userResp.Role,
 	}
 
-	// Check if user is the owner of the blog post or has admin rights
-	if userObj.Role != "admin" && blog.UserID != userObj.ID {
+	// Check if user is the owner of the blog post or may edit any blog
+	if !hasScopeAny(c) && blog.UserID != userObj.ID {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Unauthorized",
 		})
 	}
 
+	if blog.Status == models.BlogStatusScheduled || blog.Status == models.BlogStatusCancelled ||
+		blog.Status == models.BlogStatusPendingReview || blog.Status == models.BlogStatusRejected ||
+		blog.Status == models.BlogStatusHidden {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "fail",
+			"message": "The post is not published",
+		})
+	}
+
 	// Convert the string days to an integer
 	daysInt, err := strconv.Atoi(days)
 	if err != nil {
@@ -1113,13 +1253,18 @@ func SearchBlogByTitle(c *fiber.Ctx) error {
 		Role: userResp.Role,
 	}
 
-	title := strings.ToLower(c.FormValue("title"))
+	title := strings.TrimSpace(c.FormValue("title"))
+
+	// Search the user's blogs, best matches first
+	query := initializers.DB.Where("user_id = ?", userObj.ID)
+	if title != "" {
+		query = utils.SearchBlogs(query, title, c.Query("language", "en"), "blogs.created_at DESC")
+	} else {
+		query = query.Order("created_at DESC")
+	}
 
-	// Search blogs by title and user ID
 	blogs := make([]*models.Blog, 0)
-	err := utils.Paginate(c, initializers.DB.
-		Where("LOWER(title) LIKE ? AND user_id = ?", "%"+title+"%", userObj.ID).
-		Order("created_at DESC").
+	err := utils.Paginate(c, query.
 		Preload("User").
 		Preload("Photos"), &blogs)
 
@@ -1422,13 +1567,27 @@ func GetBlogById(c *fiber.Ctx) error {
 	}
 	var blog []models.Blog
 
-	err := utils.Paginate(c, initializers.DB.Where("slug = ? AND uniq_id = ?", blogID, uniqId).First(&blog).Preload("Catygory.Translations", "language = ?", language).Preload("City.Translations", "language = ?", language).Preload("Hashtags").Preload("Photos").Preload("User"), &blog)
+	err := utils.Paginate(c, initializers.DB.Where("slug = ? AND uniq_id = ? AND status NOT IN ?", blogID, uniqId, []string{models.BlogStatusPendingDeletion, models.BlogStatusScheduled, models.BlogStatusCancelled, models.BlogStatusPendingReview, models.BlogStatusRejected, models.BlogStatusHidden}).First(&blog).Preload("Catygory.Translations", "language = ?", language).Preload("City.Translations", "language = ?", language).Preload("Stations.Translations", "language = ?", language).Preload("Hashtags").Preload("Photos").Preload("User"), &blog)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Element not found",
 		})
 	}
+
+	currency, rates, err := viewerCurrency(c)
+	if err == utils.ErrCurrencyUnknown {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
+	}
+
 	var res []*blogResponse
 	for _, b := range blog {
 		userID := b.User.ID
@@ -1445,6 +1604,7 @@ func GetBlogById(c *fiber.Ctx) error {
 		if err := initializers.DB.Save(&b).Error; err != nil {
 			return err
 		}
+		utils.RecordBlogView(b.ID, utils.BlogVisitorID(c))
 		hashtags := make([]string, len(b.Hashtags))
 		for i, tag := range b.Hashtags {
 			hashtags[i] = tag.Hashtag
@@ -1497,6 +1657,9 @@ func GetBlogById(c *fiber.Ctx) error {
 			MultilangTitle:   b.MultilangTitle,
 			MultilangDescr:   b.MultilangDescr,
 			MultilangContent: b.MultilangContent,
+			LocalTitle:       b.MultilangTitle.Resolve(language, b.Lang, b.Title),
+			LocalDescr:       b.MultilangDescr.Resolve(language, b.Lang, b.Descr),
+			LocalContent:     b.MultilangContent.Resolve(language, b.Lang, b.Content),
 
 			Descr:      b.Descr,
 			Lang:       b.Lang,
@@ -1514,6 +1677,7 @@ func GetBlogById(c *fiber.Ctx) error {
 			Sticker:    b.Sticker,
 			UserProfile: UserProfileJSON{
 				MultilangDescr: userProfile.MultilangDescr,
+				LocalDescr:     userProfile.MultilangDescr.Resolve(language, userProfile.Lang, userProfile.Descr),
 				Streaming:      userProfile.Streaming,
 			},
 			User: userResponse{
@@ -1529,7 +1693,12 @@ func GetBlogById(c *fiber.Ctx) error {
 				TelegramActivated: b.User.TelegramActivated,
 				IsBot:             b.User.IsBot,
 			},
-			Hashtags: hashtags,
+			Hashtags:  hashtags,
+			Latitude:  b.Latitude,
+			Longitude: b.Longitude,
+			Stations:  stationsJSON(b.Stations),
+			Currency:  b.Currency,
+			Converted: blogConvertedPrice(&b, currency, rates),
 		}
 		res = append(res, blogRes)
 	}
@@ -1561,8 +1730,8 @@ func DeleteBlog(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user is the owner of the blog post or has admin rights
-	if userObj.Role != "admin" && blog.UserID != userObj.ID {
+	// Check if user is the owner of the blog post or may edit any blog
+	if !hasScopeAny(c) && blog.UserID != userObj.ID {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Unauthorized",
@@ -1605,6 +1774,14 @@ func DeleteBlog(c *fiber.Ctx) error {
 		})
 	}
 
+	// Delete all blog stations associated with the blog post
+	if err := initializers.DB.Exec("DELETE FROM blog_stations WHERE blog_id = ?", blogID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not delete element",
+		})
+	}
+
 	// Delete all photos associated with the blog post
 	var blogPhotos []models.BlogPhoto
 	if err := initializers.DB.Where("blog_id = ?", blogID).Find(&blogPhotos).Error; err != nil {
@@ -1649,6 +1826,22 @@ func DeleteBlog(c *fiber.Ctx) error {
 		}
 	}
 
+	if err := utils.DeleteBlogRevisions(blog.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not delete element",
+		})
+	}
+	if err := utils.DeleteTranslations(models.TranslationEntityBlog, blog.ID); err != nil {
+		log.Printf("Could not delete translations of blog %d: %s", blog.ID, err)
+	}
+	if err := utils.DeleteBlogStats(blog.ID); err != nil {
+		log.Printf("Could not delete stats of blog %d: %s", blog.ID, err)
+	}
+	if err := utils.InvalidateRelatedBlogs(blog.ID); err != nil {
+		log.Printf("Could not invalidate related blogs of %d: %s", blog.ID, err)
+	}
+
 	// Proceed with deleting the blog entry
 	err = initializers.DB.Delete(&blog).Error
 	if err != nil {
@@ -1676,6 +1869,10 @@ func DeleteBlog(c *fiber.Ctx) error {
 // return nil
 
 // }
+
+// blogListKeyset pages /blog/listAll newest first.
+var blogListKeyset = utils.Keyset{Name: "blogs", Columns: []string{"blogs.created_at", "blogs.id"}, Desc: true}
+
 func GetAll(c *fiber.Ctx) error {
 	var blogs []models.Blog
 	language := c.Query("language")
@@ -1684,96 +1881,61 @@ func GetAll(c *fiber.Ctx) error {
 		language = "en"
 	}
 
-	query := initializers.DB.Order("created_at DESC").
+	query := initializers.DB.
 		Preload("Catygory.Translations", "language = ?", language).
 		Preload("City.Translations", "language = ?", language).
+		Preload("Stations.Translations", "language = ?", language).
 		Preload("Hashtags").
 		Preload("Photos").
 		Preload("User").
 		Where("status = ?", "ACTIVE")
 
-	// Get the query parameters
-	city := c.Query("city")
-	skip := c.Query("skip")
-	money := c.Query("money")
-	title := c.Query("title")
-	hashtags := c.Query("hashtag")
-	category := c.Query("category")
-
-	if hashtags != "" && hashtags != "all" {
-		// Split the hashtags into separate values
-		hashtagValues := strings.Split(hashtags, ",")
-
-		// Join the hashtag values with the '#' character
-		hashtagValuesWithPrefix := make([]string, len(hashtagValues))
-		for i, tag := range hashtagValues {
-			hashtagValuesWithPrefix[i] = strings.TrimSpace(tag)
-		}
-
-		// Add the hashtags filter to the query
-		query = query.Joins("JOIN blog_hashtags bh ON blogs.id = bh.blog_id").
-			Joins("JOIN hashtags h ON bh.hashtags_id = h.id").
-			Where("h.hashtag IN (?)", hashtagValuesWithPrefix)
+	filters, err := parseBlogListFilters(c, language)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
 	}
+	query = filters.Apply(query, "")
 
-	if city != "" && city != "all" {
-		// Сначала найдем city_id для указанного города и языка
-		var cityTranslation models.CityTranslation
-		initializers.DB.Where("name = ? AND language = ?", city, language).First(&cityTranslation)
-
-		if cityTranslation.ID != 0 {
-			// Создадим подзапрос для поиска всех blog_id, связанных с указанным city_id
-			subQuery := initializers.DB.Table("blog_city").
-				Select("blog_id").
-				Where("city_id = ?", cityTranslation.CityID)
-
-			// Добавим условие, чтобы ваш основной запрос включал только записи с blog_id из подзапроса
-			query = query.Where("blogs.id IN (?)", subQuery) // Specify the table alias for "blogs.id"
-		}
+	params, err := utils.ParsePageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
 	}
 
-	if category != "" && category != "all" {
-		var guildTranslation models.GuildTranslation
-		initializers.DB.Where("name = ? AND language = ?", category, language).First(&guildTranslation)
-		if guildTranslation.ID != 0 {
-			// Создадим подзапрос для поиска всех blog_id, связанных с указанным guild_id
-			subQuery := initializers.DB.Table("blog_guilds").
-				Select("blog_id").
-				Where("guilds_id = ?", guildTranslation.GuildID)
-
-			// Добавим условие, чтобы ваш основной запрос включил только записи с blog_id из подзапроса
-			query = query.Where("blogs.id IN (?)", subQuery)
-		}
+	// ?sort=price_asc or price_desc orders by the converted price
+	sort := c.Query("sort")
+	if sort != "" && sort != blogSortPriceAsc && sort != blogSortPriceDesc {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid sort, use price_asc or price_desc",
+		})
 	}
-
-	if title != "" && title != "all" {
-		query = query.Where("LOWER(title) LIKE ?", "%"+title+"%")
+	if sort != "" && params.Cursor != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Cursor pagination is not available for price sorting, use skip",
+		})
 	}
-	if money != "" && money != "all" {
-		if strings.Contains(money, "-") {
-			totalRange := strings.Split(money, "-")
-			if len(totalRange) != 2 {
-				return fmt.Errorf("invalid total range format: %w", fmt.Errorf("length of totalRange is not 2"))
-			}
-
-			lowerTotal, err := strconv.Atoi(strings.TrimSpace(totalRange[0]))
-			if err != nil {
-				return err
-			}
 
-			upperTotal, err := strconv.Atoi(strings.TrimSpace(totalRange[1]))
-			if err != nil {
-				return err
-			}
-
-			query = query.Where("total >= ? AND total <= ?", lowerTotal, upperTotal)
-		} else {
-			totalInt, err := strconv.Atoi(money)
-			if err != nil {
-				return err
-			}
-			query = query.Where("total >= ?", totalInt)
-		}
+	// Search results are ordered by rank and geo results by distance,
+	// neither has a stable cursor
+	searching := filters.Title != ""
+	if searching && params.Cursor != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Cursor pagination is not available for title search, use skip",
+		})
+	}
+	if filters.Geo != nil && params.Cursor != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Cursor pagination is not available for distance sorting, use skip",
+		})
 	}
 
 	var count int64
@@ -1784,38 +1946,56 @@ func GetAll(c *fiber.Ctx) error {
 		})
 	}
 
-	if skip != "" {
-		skipInt, err := strconv.Atoi(skip)
-		if err != nil {
-			return err
-		}
-
-		if skipInt >= int(count) {
-			skipInt = 0
-		}
-
-		query = query.Offset(skipInt)
+	page := &utils.CursorPage{}
+	if sort != "" {
+		err = utils.OrderBlogsByPrice(query, filters.CurrencyRate, sort == blogSortPriceDesc, "blogs.created_at DESC, blogs.id DESC").
+			Offset(params.Skip).
+			Limit(params.Limit).
+			Find(&blogs).Error
+	} else if filters.Geo != nil {
+		err = filters.Geo.OrderByDistance(query, utils.BlogLocation, "blogs.created_at DESC, blogs.id DESC").
+			Offset(params.Skip).
+			Limit(params.Limit).
+			Find(&blogs).Error
+	} else if searching {
+		err = utils.OrderBlogsByRank(query, filters.Title, language, "blogs.created_at DESC, blogs.id DESC").
+			Offset(params.Skip).
+			Limit(params.Limit).
+			Find(&blogs).Error
+	} else {
+		blogs, page, err = utils.FindPage(query, blogListKeyset, params, func(b *models.Blog) []interface{} {
+			return []interface{}{b.CreatedAt, b.ID}
+		})
 	}
-
-	limit := c.Query("limit", "10")
-	limitInt, err := strconv.Atoi(limit)
-	if err != nil {
+	if err == utils.ErrCursorInvalid {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Invalid limit parameter",
+			"message": err.Error(),
 		})
-	}
-
-	query = query.Limit(limitInt)
-
-	err = query.Find(&blogs).Error
-	if err != nil {
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Could not retrieve data",
 		})
 	}
 
+	ids := make([]uint64, len(blogs))
+	for i, b := range blogs {
+		ids[i] = b.ID
+	}
+	utils.RecordBlogEvent(utils.BlogEventImpression, ids...)
+
+	var hits map[uint64]utils.BlogSearchHit
+	if searching {
+		hits, err = utils.BlogSearchHits(ids, filters.Title, language)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Could not retrieve data",
+			})
+		}
+	}
+
 	var res []*blogResponse
 	for _, b := range blogs {
 		// b.Views++
@@ -1876,6 +2056,8 @@ func GetAll(c *fiber.Ctx) error {
 			Title:          b.Title,
 			MultilangTitle: b.MultilangTitle,
 			MultilangDescr: b.MultilangDescr,
+			LocalTitle:     b.MultilangTitle.Resolve(language, b.Lang, b.Title),
+			LocalDescr:     b.MultilangDescr.Resolve(language, b.Lang, b.Descr),
 			Lang:           b.Lang,
 			Descr:          b.Descr,
 			Slug:           b.Slug,
@@ -1906,32 +2088,49 @@ func GetAll(c *fiber.Ctx) error {
 				TelegramActivated: b.User.TelegramActivated,
 				IsBot:             b.User.IsBot,
 			},
-			Hashtags: hashtags,
+			Hashtags:  hashtags,
+			Latitude:  b.Latitude,
+			Longitude: b.Longitude,
+			Stations:  stationsJSON(b.Stations),
+			Currency:  b.Currency,
+			Converted: blogConvertedPrice(&b, filters.Currency, filters.Rates),
+		}
+		if hit, ok := hits[b.ID]; ok {
+			blogRes.Search = &hit
+		}
+		if filters.Geo != nil {
+			blogRes.Distance = filters.Geo.DistanceTo(utils.BlogCoordinates(&b))
 		}
 		res = append(res, blogRes)
 	}
 
-	if len(blogs) == 0 {
-		return c.JSON(fiber.Map{
-			"status": "success",
-			"data":   []models.Blog{},
-			"meta": fiber.Map{
-				"total": count,
-				"limit": limitInt,
-				"skip":  skip,
-			},
-		})
-	}
-
-	return c.JSON(fiber.Map{
+	response := fiber.Map{
 		"status": "success",
 		"data":   res,
-		"meta": fiber.Map{
+		"meta": page.Meta(fiber.Map{
 			"total": count,
-			"limit": limitInt,
-			"skip":  skip,
-		},
-	})
+			"limit": params.Limit,
+			"skip":  params.Skip,
+		}),
+	}
+
+	if len(blogs) == 0 {
+		response["data"] = []models.Blog{}
+	}
+
+	// ?facets=true adds counts of the other filter options
+	if c.QueryBool("facets") {
+		facets, err := blogListFacets(filters)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Could not retrieve facets",
+			})
+		}
+		response["facets"] = facets
+	}
+
+	return c.JSON(response)
 }
 
 func GetRandom(c *fiber.Ctx) error {
@@ -1986,8 +2185,8 @@ func EditBlogGetId(c *fiber.Ctx) error {
 	// Access the first blog in the slice
 	blogPost := blog[0]
 
-	// Check if user is the owner of the blog post or has admin rights
-	if userObj.Role != "admin" && blogPost.UserID != userObj.ID {
+	// Check if user is the owner of the blog post or may edit any blog
+	if !hasScopeAny(c) && blogPost.UserID != userObj.ID {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Unauthorized",
@@ -2113,8 +2312,8 @@ func UpdateBlog(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if the user is the owner of the blog post or has admin rights
-	if userObj.Role != "admin" && blog.UserID != userObj.ID {
+	// Check if the user is the owner of the blog post or may edit any blog
+	if !hasScopeAny(c) && blog.UserID != userObj.ID {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Unauthorized",
@@ -2145,6 +2344,14 @@ func UpdateBlog(c *fiber.Ctx) error {
 				Path string `json:"path"`
 			} `json:"files"`
 		} `json:"photos"`
+		PublishAt   *time.Time `json:"publish_at"`
+		UnpublishAt *time.Time `json:"unpublish_at"`
+		utils.CoordinatesUpdate
+		// Currency and stations are kept when left out
+		Currency string `json:"currency"`
+		Stations []struct {
+			ID uint64 `json:"id"`
+		} `json:"stations"`
 	}
 
 	var requestBody RequestBody
@@ -2155,6 +2362,51 @@ func UpdateBlog(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := requestBody.CoordinatesUpdate.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	if requestBody.Currency != "" {
+		currency, err := utils.BlogCurrency(requestBody.Currency)
+		if err == utils.ErrCurrencyUnknown {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": err.Error(),
+			})
+		} else if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Could not check the currency",
+			})
+		}
+		requestBody.Currency = currency
+	}
+
+	// Only a scheduled post can be moved, any unfinished one can get an end
+	if requestBody.PublishAt != nil && blog.Status != models.BlogStatusScheduled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "fail",
+			"message": "Only scheduled posts can be rescheduled",
+		})
+	}
+	publishAt := blog.PublishAt
+	if requestBody.PublishAt != nil {
+		publishAt = requestBody.PublishAt
+	} else if blog.Status != models.BlogStatusScheduled {
+		publishAt = nil
+	}
+	if requestBody.PublishAt != nil || requestBody.UnpublishAt != nil {
+		if err := utils.ValidateBlogSchedule(publishAt, requestBody.UnpublishAt); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": err.Error(),
+			})
+		}
+	}
+
 	if requestBody.Pined {
 		// Check if the blog is already pinned by the user
 		var pinnedBlog models.Blog
@@ -2197,6 +2449,25 @@ func UpdateBlog(c *fiber.Ctx) error {
 
 	}
 
+	// An edit of a live blog goes back to review, a rejected blog is
+	// resubmitted
+	var editor models.User
+	if err := initializers.DB.First(&editor, "id = ?", userObj.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not update blog post",
+		})
+	}
+	blog.Status = utils.EditedBlogStatus(blog.Status, &editor)
+
+	// Keep the current state, including the photo files, in the history
+	if _, err := utils.SnapshotBlog(blog.ID, userObj.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not save blog revision",
+		})
+	}
+
 	// Retrieve or create new Hashtags based on the request body
 	updatedHashtags := []models.Hashtags{}
 	for _, tag := range requestBody.Hashtags {
@@ -2285,47 +2556,18 @@ func UpdateBlog(c *fiber.Ctx) error {
 	blog.Total = requestBody.Total
 	blog.Pined = requestBody.Pined
 	blog.Content = requestBody.Content
-
-	// Fetch languages from the database
-	var langs []models.Langs
-	err = initializers.DB.Raw("SELECT * FROM langs").Scan(&langs).Error
-	if err != nil {
-		return err
+	requestBody.CoordinatesUpdate.Apply(&blog.Latitude, &blog.Longitude)
+	if requestBody.Currency != "" {
+		blog.Currency = requestBody.Currency
 	}
-
-	translations := make(map[string]string)
-	translationsDescr := make(map[string]string)
-	translationsContent := make(map[string]string)
-
-	for _, lang := range langs {
-
-		result, _ := gt.Translate(blog.Title, blog.Lang, lang.Code)
-		translations[lang.Code] = result
-
-		resultDescr, _ := gt.Translate(blog.Descr, blog.Lang, lang.Code)
-		translationsDescr[lang.Code] = resultDescr
-
-		resultContent, _ := gt.Translate(blog.Content, blog.Lang, lang.Code)
-		translationsContent[lang.Code] = resultContent
+	if requestBody.PublishAt != nil {
+		blog.PublishAt = requestBody.PublishAt
+	}
+	if requestBody.UnpublishAt != nil {
+		blog.UnpublishAt = requestBody.UnpublishAt
 	}
 
-	// Set the translated values in the TitleLangs field
-	blog.MultilangTitle.En = translations["en"]
-	blog.MultilangTitle.Ru = translations["ru"]
-	blog.MultilangTitle.Ka = translations["ka"]
-	blog.MultilangTitle.Es = translations["es"]
-
-	// Set the translated values in the TitleLangs field
-	blog.MultilangDescr.En = translationsDescr["en"]
-	blog.MultilangDescr.Ru = translationsDescr["ru"]
-	blog.MultilangDescr.Ka = translationsDescr["ka"]
-	blog.MultilangDescr.Es = translationsDescr["es"]
-
-	// Set the translated values in the TitleLangs field
-	blog.MultilangContent.En = translationsContent["en"]
-	blog.MultilangContent.Ru = translationsContent["ru"]
-	blog.MultilangContent.Ka = translationsContent["ka"]
-	blog.MultilangContent.Es = translationsContent["es"]
+	prefillBlogTranslations(&blog)
 
 	if err := initializers.DB.Save(&blog).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -2333,6 +2575,24 @@ func UpdateBlog(c *fiber.Ctx) error {
 			"message": "Could not update blog post",
 		})
 	}
+	translateBlog(blog.ID)
+
+	if requestBody.Stations != nil {
+		updatedStations := []models.Stations{}
+		for _, station := range requestBody.Stations {
+			updatedStations = append(updatedStations, models.Stations{ID: uint(station.ID)})
+		}
+		if err := initializers.DB.Model(&blog).Association("Stations").Replace(updatedStations); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Could not update stations",
+			})
+		}
+	}
+
+	if err := utils.InvalidateRelatedBlogs(blog.ID); err != nil {
+		log.Printf("Could not invalidate related blogs of %d: %s", blog.ID, err)
+	}
 
 	// Iterate over the photos in the request body
 	for _, photo := range requestBody.Photos {
@@ -2369,8 +2629,8 @@ func UpdateBlog(c *fiber.Ctx) error {
 			})
 		}
 
-		// Delete the files that were removed
-		deleteRemovedFiles(blogPhoto.Files, filesJSONB)
+		// Removed files stay on disk while a revision references them,
+		// PruneBlogRevisions deletes them with the last such revision
 
 		// Update the Files field with the JSONB value
 		blogPhoto.Files = filesJSONB
@@ -2387,9 +2647,12 @@ func UpdateBlog(c *fiber.Ctx) error {
 		}
 	}
 
+	utils.PruneBlogRevisions(blog.ID)
+
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": fmt.Sprintf("Element with ID %s has been updated", blogID),
+		"review":  blog.Status == models.BlogStatusPendingReview,
 		"data":    blog,
 	})
 }
@@ -2442,6 +2705,21 @@ func deleteFileFromServer(path string) {
 	_ = os.Remove(absolutePath)
 }
 
+// prefillBlogTranslations fills the translated fields of a blog from the
+// cache, falling back to the source text.
+func prefillBlogTranslations(blog *models.Blog) {
+	blog.MultilangTitle = utils.PrefillTranslations(blog.Title, blog.Lang)
+	blog.MultilangDescr = utils.PrefillTranslations(blog.Descr, blog.Lang)
+	blog.MultilangContent = utils.PrefillTranslations(blog.Content, blog.Lang)
+}
+
+// translateBlog queues the translations of a saved blog that are missing.
+func translateBlog(id uint64) {
+	if err := utils.TranslateFields(models.TranslationEntityBlog, id, "title", "descr", "content"); err != nil {
+		log.Printf("Could not translate blog %d: %s", id, err)
+	}
+}
+
 // replaceSpecialChars replaces each special character in the input string
 func replaceSpecialChars(title string) string {
 	// Convert to lowercase
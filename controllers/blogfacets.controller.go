@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"fmt"
+	"math"
+
+	"hyperpage/initializers"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	blogFacetHashtagLimit = 20
+	blogFacetPriceBuckets = 10
+)
+
+type blogFacetCount struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type blogHashtagFacet struct {
+	Hashtag string `json:"hashtag"`
+	Count   int64  `json:"count"`
+}
+
+type blogPriceBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int64   `json:"count"`
+}
+
+type blogFacets struct {
+	Cities     []blogFacetCount   `json:"cities"`
+	Categories []blogFacetCount   `json:"categories"`
+	Hashtags   []blogHashtagFacet `json:"hashtags"`
+	Prices     []blogPriceBucket  `json:"prices"`
+}
+
+// parseBlogListFilters reads the filters of /blog/listAll from the query.
+func parseBlogListFilters(c *fiber.Ctx, language string) (*utils.BlogFilters, error) {
+	values := map[string]string{}
+	for _, key := range utils.BlogFilterKeys {
+		values[key] = c.Query(key)
+	}
+	return utils.ParseBlogFilters(values, language)
+}
+
+// blogListFacets counts the options of every filter dimension among the
+// blogs matching the other filters.
+func blogListFacets(f *utils.BlogFilters) (*blogFacets, error) {
+	facets := &blogFacets{
+		Cities:     []blogFacetCount{},
+		Categories: []blogFacetCount{},
+		Hashtags:   []blogHashtagFacet{},
+		Prices:     []blogPriceBucket{},
+	}
+
+	if err := initializers.DB.Table("blog_city bc").
+		Select("bc.city_id AS id, ct.name AS name, COUNT(DISTINCT bc.blog_id) AS count").
+		Joins("JOIN city_translations ct ON ct.city_id = bc.city_id AND ct.language = ?", f.Language).
+		Where("bc.blog_id IN (?)", f.MatchingIDs(utils.BlogFilterCity)).
+		Group("bc.city_id, ct.name").
+		Order("count DESC, name").
+		Scan(&facets.Cities).Error; err != nil {
+		return nil, fmt.Errorf("city facet: %w", err)
+	}
+
+	if err := initializers.DB.Table("blog_guilds bg").
+		Select("bg.guilds_id AS id, gt.name AS name, COUNT(DISTINCT bg.blog_id) AS count").
+		Joins("JOIN guild_translations gt ON gt.guild_id = bg.guilds_id AND gt.language = ?", f.Language).
+		Where("bg.blog_id IN (?)", f.MatchingIDs(utils.BlogFilterCategory)).
+		Group("bg.guilds_id, gt.name").
+		Order("count DESC, name").
+		Scan(&facets.Categories).Error; err != nil {
+		return nil, fmt.Errorf("category facet: %w", err)
+	}
+
+	if err := initializers.DB.Table("blog_hashtags bh").
+		Select("h.hashtag AS hashtag, COUNT(DISTINCT bh.blog_id) AS count").
+		Joins("JOIN hashtags h ON bh.hashtags_id = h.id").
+		Where("bh.blog_id IN (?)", f.MatchingIDs(utils.BlogFilterHashtag)).
+		Group("h.hashtag").
+		Order("count DESC, hashtag").
+		Limit(blogFacetHashtagLimit).
+		Scan(&facets.Hashtags).Error; err != nil {
+		return nil, fmt.Errorf("hashtag facet: %w", err)
+	}
+
+	prices, err := blogPriceHistogram(f)
+	if err != nil {
+		return nil, fmt.Errorf("price facet: %w", err)
+	}
+	facets.Prices = prices
+
+	return facets, nil
+}
+
+// blogPriceHistogram splits the price range of the matching blogs, in the
+// currency of the filters, into equal buckets. Blogs without a price or
+// whose currency has no rate are left out.
+func blogPriceHistogram(f *utils.BlogFilters) ([]blogPriceBucket, error) {
+	ids := f.MatchingIDs(utils.BlogFilterMoney)
+
+	var bounds struct {
+		Min *float64
+		Max *float64
+	}
+	if err := initializers.DB.Table("blogs").
+		Select("MIN("+utils.BlogPriceSQL+") AS min, MAX("+utils.BlogPriceSQL+") AS max", f.CurrencyRate, f.CurrencyRate).
+		Where("id IN (?) AND total IS NOT NULL", ids).
+		Scan(&bounds).Error; err != nil {
+		return nil, err
+	}
+
+	buckets := []blogPriceBucket{}
+	if bounds.Min == nil || bounds.Max == nil {
+		return buckets, nil
+	}
+
+	min, max := math.Floor(*bounds.Min), math.Ceil(*bounds.Max)
+	if max <= min {
+		max = min + 1
+	}
+	width := (max - min) / blogFacetPriceBuckets
+
+	var rows []struct {
+		Bucket int
+		Count  int64
+	}
+	// width_bucket puts the maximum into bucket count+1, LEAST folds it back
+	if err := initializers.DB.Table("blogs").
+		Select("LEAST(width_bucket("+utils.BlogPriceSQL+", ?, ?, ?), ?) AS bucket, COUNT(*) AS count", f.CurrencyRate, min, max, blogFacetPriceBuckets, blogFacetPriceBuckets).
+		Where("id IN (?) AND total IS NOT NULL AND "+utils.BlogPriceSQL+" IS NOT NULL", ids, f.CurrencyRate).
+		Group("bucket").
+		Order("bucket").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		from := min + float64(row.Bucket-1)*width
+		buckets = append(buckets, blogPriceBucket{
+			From:  math.Round(from*100) / 100,
+			To:    math.Round((from+width)*100) / 100,
+			Count: row.Count,
+		})
+	}
+
+	return buckets, nil
+}
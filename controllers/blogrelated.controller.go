@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetRelatedBlogs lists active blogs similar to a blog: sharing hashtags, a
+// city or a category, close in price and recent. ?exclude_author=true leaves
+// out the author's other blogs, ?limit= caps the list, ?currency= converts
+// the prices.
+func GetRelatedBlogs(c *fiber.Ctx) error {
+	language := c.Query("language")
+	if language == "" {
+		language = "en"
+	}
+
+	var blog models.Blog
+	if err := initializers.DB.Select("id", "user_id", "total", "currency").
+		Where("status NOT IN ?", []string{models.BlogStatusPendingDeletion, models.BlogStatusScheduled, models.BlogStatusCancelled, models.BlogStatusPendingReview, models.BlogStatusRejected, models.BlogStatusHidden}).
+		First(&blog, "id = ?", c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Element not found",
+		})
+	}
+
+	currency, rates, err := viewerCurrency(c)
+	if err == utils.ErrCurrencyUnknown {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
+	}
+
+	limit := c.QueryInt("limit", utils.RelatedBlogsLimit)
+	if limit <= 0 || limit > utils.RelatedBlogsLimit {
+		limit = utils.RelatedBlogsLimit
+	}
+
+	ids, err := utils.RelatedBlogIDs(&blog, c.QueryBool("exclude_author"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
+	}
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	res := []*blogResponse{}
+	if len(ids) > 0 {
+		var blogs []models.Blog
+		if err := initializers.DB.
+			Preload("Catygory.Translations", "language = ?", language).
+			Preload("City.Translations", "language = ?", language).
+			Preload("Hashtags").
+			Preload("Photos").
+			Preload("User").
+			Where("id IN ?", ids).
+			Find(&blogs).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Could not retrieve data",
+			})
+		}
+
+		byID := make(map[uint64]*models.Blog, len(blogs))
+		for i := range blogs {
+			byID[blogs[i].ID] = &blogs[i]
+		}
+		for _, id := range ids {
+			if b, ok := byID[id]; ok {
+				res = append(res, relatedBlogResponse(b, language, currency, rates))
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   res,
+	})
+}
+
+// relatedBlogResponse is the card of a related blog, without the content.
+func relatedBlogResponse(b *models.Blog, language, currency string, rates map[string]float64) *blogResponse {
+	hashtags := make([]string, len(b.Hashtags))
+	for i, tag := range b.Hashtags {
+		hashtags[i] = tag.Hashtag
+	}
+
+	cities := make([]CityJSON, len(b.City))
+	for i, city := range b.City {
+		cities[i] = CityJSON{ID: city.ID}
+		if len(city.Translations) > 0 {
+			cities[i].Name = city.Translations[0].Name
+		}
+	}
+
+	categories := make([]CategoryJSON, len(b.Catygory))
+	for i, category := range b.Catygory {
+		categories[i] = CategoryJSON{ID: category.ID}
+		if len(category.Translations) > 0 {
+			categories[i].Name = category.Translations[0].Name
+		}
+	}
+
+	return &blogResponse{
+		ID:             b.ID,
+		Title:          b.Title,
+		Descr:          b.Descr,
+		MultilangTitle: b.MultilangTitle,
+		MultilangDescr: b.MultilangDescr,
+		LocalTitle:     b.MultilangTitle.Resolve(language, b.Lang, b.Title),
+		LocalDescr:     b.MultilangDescr.Resolve(language, b.Lang, b.Descr),
+		Lang:           b.Lang,
+		Slug:           b.Slug,
+		Status:         b.Status,
+		Total:          b.Total,
+		City:           cities,
+		Catygory:       categories,
+		UserAvatar:     b.UserAvatar,
+		Views:          b.Views,
+		Photos:         b.Photos,
+		CreatedAt:      b.CreatedAt,
+		UpdatedAt:      b.UpdatedAt,
+		UniqId:         b.UniqId,
+		Sticker:        b.Sticker,
+		Hashtags:       hashtags,
+		Latitude:       b.Latitude,
+		Longitude:      b.Longitude,
+		Currency:       b.Currency,
+		Converted:      blogConvertedPrice(b, currency, rates),
+		User: userResponse{
+			ID:     b.User.ID,
+			Online: b.User.Online,
+			Photo:  b.User.Photo,
+			Name:   b.User.Name,
+			Role:   b.User.Role,
+		},
+	}
+}
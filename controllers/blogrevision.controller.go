@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"strconv"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetBlogRevisions lists the stored revisions of a blog, newest first.
+func GetBlogRevisions(c *fiber.Ctx) error {
+	blog, ok := revisionBlog(c)
+	if !ok {
+		return nil
+	}
+
+	var revisions []models.BlogRevision
+	if err := initializers.DB.Where("blog_id = ?", blog.ID).Order("number DESC").Find(&revisions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve revisions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   revisions,
+	})
+}
+
+// DiffBlogRevisions compares two revisions given by number in ?from= and
+// ?to=. A missing or zero number stands for the current state of the blog.
+func DiffBlogRevisions(c *fiber.Ctx) error {
+	blog, ok := revisionBlog(c)
+	if !ok {
+		return nil
+	}
+
+	from, err := blogRevisionByNumber(blog.ID, c.Query("from"))
+	if err != nil {
+		return blogRevisionError(c, err)
+	}
+	to, err := blogRevisionByNumber(blog.ID, c.Query("to"))
+	if err != nil {
+		return blogRevisionError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"from":    from.Number,
+			"to":      to.Number,
+			"changes": utils.DiffBlogRevisions(from, to),
+		},
+	})
+}
+
+// RestoreBlogRevision puts a blog back into the state of a revision.
+func RestoreBlogRevision(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	blog, ok := revisionBlog(c)
+	if !ok {
+		return nil
+	}
+
+	number, err := strconv.Atoi(c.Params("number"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid revision number"})
+	}
+
+	revision, err := utils.GetBlogRevision(blog.ID, number)
+	if err != nil {
+		return blogRevisionError(c, err)
+	}
+
+	// A restore is an edit, so it goes through review the same way
+	var editor models.User
+	if err := initializers.DB.First(&editor, "id = ?", user.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not restore revision",
+		})
+	}
+
+	if err := utils.RestoreBlogRevision(blog.ID, revision, user.ID, utils.EditedBlogStatus(blog.Status, &editor)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not restore revision",
+		})
+	}
+
+	var restored models.Blog
+	initializers.DB.Preload("Hashtags").Preload("City").Preload("Catygory").Preload("Photos").First(&restored, "id = ?", blog.ID)
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   restored,
+	})
+}
+
+// revisionBlog loads the blog of the :id parameter and checks that the
+// user may see its history. On failure the response is already written.
+func revisionBlog(c *fiber.Ctx) (*models.Blog, bool) {
+	user := c.Locals("user").(models.UserResponse)
+
+	var blog models.Blog
+	if err := initializers.DB.First(&blog, "id = ?", c.Params("id")).Error; err != nil {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Element not found",
+		})
+		return nil, false
+	}
+
+	if !hasScopeAny(c) && blog.UserID != user.ID {
+		c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+		return nil, false
+	}
+
+	return &blog, true
+}
+
+func blogRevisionError(c *fiber.Ctx, err error) error {
+	if err == utils.ErrBlogRevisionNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+	if _, ok := err.(*strconv.NumError); ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid revision number"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Could not retrieve revision"})
+}
+
+func blogRevisionByNumber(blogID uint64, number string) (*models.BlogRevision, error) {
+	if number == "" || number == "0" || number == "current" {
+		return utils.CurrentBlogRevision(blogID)
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return nil, err
+	}
+	return utils.GetBlogRevision(blogID, n)
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Ranges served when ?from= is left out.
+const (
+	blogStatsDefaultHours = 48
+	blogStatsDefaultDays  = 30
+)
+
+// GetBlogStats returns the activity of a blog as a time series. ?interval=
+// is "day" (default) or "hour"; ?from= and ?to= take a date or an RFC 3339
+// time and default to the last 30 days or 48 hours. The counters of the
+// current hour are added by the next rollup.
+func GetBlogStats(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	var blog models.Blog
+	if err := initializers.DB.Select("id", "user_id").First(&blog, "id = ?", c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Element not found",
+		})
+	}
+	if !hasScopeAny(c) && blog.UserID != user.ID {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+	}
+
+	interval := c.Query("interval", utils.BlogStatsDay)
+
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		parsed, ok := parseBlogStatsTime(value)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid to parameter"})
+		}
+		to = parsed
+	}
+
+	from := to.Add(-(blogStatsDefaultDays - 1) * 24 * time.Hour)
+	if interval == utils.BlogStatsHour {
+		from = to.Add(-(blogStatsDefaultHours - 1) * time.Hour)
+	}
+	if value := c.Query("from"); value != "" {
+		parsed, ok := parseBlogStatsTime(value)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid from parameter"})
+		}
+		from = parsed
+	}
+
+	series, err := utils.BlogStatsSeries(blog.ID, interval, from, to)
+	if err == utils.ErrBlogStatsRange {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "fail",
+			"message": "Invalid range, at most 31 days by hour or 366 days by day",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve stats",
+		})
+	}
+
+	// Unique visitors of different days may overlap and are not summed
+	var totals models.BlogStatsPoint
+	for _, point := range series {
+		totals.Views += point.Views
+		totals.Impressions += point.Impressions
+		totals.Favorites += point.Favorites
+		totals.Votes += point.Votes
+		totals.Chats += point.Chats
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"interval": interval,
+			"series":   series,
+			"totals": fiber.Map{
+				"views":       totals.Views,
+				"impressions": totals.Impressions,
+				"favorites":   totals.Favorites,
+				"votes":       totals.Votes,
+				"chats":       totals.Chats,
+			},
+		},
+	})
+}
+
+func parseBlogStatsTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
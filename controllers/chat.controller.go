@@ -18,6 +18,7 @@ import (
 type CreateRoomRequest struct {
 	AcceptorId     string `json:"acceptorId"`
 	InitialMessage string `json:"initialMessage"`
+	BlogId         uint64 `json:"blogId,omitempty"` // the listing the chat was opened from
 }
 
 type SendMessageRequest struct {
@@ -106,6 +107,15 @@ func CreateChatRoomForDM(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to update room's last message"})
 		}
 
+		// Count the chat for the listing if it belongs to the acceptor
+		if payload.BlogId != 0 {
+			var owned int64
+			initializers.DB.Model(&models.Blog{}).Where("id = ? AND user_id = ?", payload.BlogId, acceptorUser.ID).Count(&owned)
+			if owned > 0 {
+				utils.RecordBlogEvent(utils.BlogEventChat, payload.BlogId)
+			}
+		}
+
 		serializedRoom := utils.SerializeChatRoom(newRoom.ID)
 		channels, err := GetRoomMemberChannels(newRoom.ID)
 		if err != nil {
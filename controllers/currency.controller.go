@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetCurrencyRates lists the currency rates, in the base currency.
+func GetCurrencyRates(c *fiber.Ctx) error {
+	var rates []models.CurrencyRate
+	if err := initializers.DB.Order("code").Find(&rates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve currency rates",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   rates,
+		"meta": fiber.Map{
+			"base": utils.BaseCurrency(),
+		},
+	})
+}
+
+// SetCurrencyRate creates or replaces the rate of a currency. It wins over
+// the rates file until it is deleted.
+func SetCurrencyRate(c *fiber.Ctx) error {
+	var payload models.CurrencyRateInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	rate, err := utils.SetCurrencyRate(payload.Code, payload.Rate)
+	if err == utils.ErrCurrencyBase {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not save the currency rate",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   rate,
+	})
+}
+
+// DeleteCurrencyRate removes the rate of a currency. A rate from the rates
+// file comes back with the next load.
+func DeleteCurrencyRate(c *fiber.Ctx) error {
+	err := utils.DeleteCurrencyRate(c.Params("code"))
+	if err == utils.ErrCurrencyBase {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err == utils.ErrCurrencyUnknown {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not delete the currency rate",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Currency rate deleted",
+	})
+}
+
+// ReloadCurrencyRates loads CURRENCY_RATES_FILE now instead of waiting for
+// the next hourly load.
+func ReloadCurrencyRates(c *fiber.Ctx) error {
+	config, _ := initializers.LoadConfig(".")
+	if config.CurrencyRatesFile == "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"status":  "fail",
+			"message": "No currency rates file is configured",
+		})
+	}
+
+	loaded, err := utils.LoadCurrencyRatesFile(config.CurrencyRatesFile)
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"status":  "fail",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"loaded": loaded,
+		},
+	})
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestDataExport queues an archive of the user's personal data. The
+// download link is emailed once the archive is ready.
+func RequestDataExport(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	var last models.DataExport
+	err := initializers.DB.
+		Where("user_id = ? AND status <> ?", user.ID, models.DataExportFailed).
+		Order("created_at DESC").
+		First(&last).Error
+	if err == nil && time.Since(last.CreatedAt) < utils.DataExportCooldown {
+		utils.SetRetryAfter(c, utils.DataExportCooldown-time.Since(last.CreatedAt))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"status":  "fail",
+			"message": "A data export was already requested in the last 24 hours",
+			"data":    last,
+		})
+	}
+
+	export := models.DataExport{
+		UserID:   user.ID,
+		Status:   models.DataExportPending,
+		Language: c.Query("language", "en"),
+	}
+	if err := initializers.DB.Create(&export).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create data export",
+		})
+	}
+
+	go utils.BuildDataExport(export.ID)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"status":  "success",
+		"message": "Data export started, the download link will be emailed when it is ready",
+		"data":    export,
+	})
+}
+
+// GetDataExports lists the user's exports with download links of ready ones.
+func GetDataExports(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	var exports []models.DataExport
+	if err := initializers.DB.Where("user_id = ?", user.ID).Order("created_at DESC").Limit(10).Find(&exports).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve data exports",
+		})
+	}
+
+	res := make([]fiber.Map, 0, len(exports))
+	for i := range exports {
+		item := fiber.Map{"export": exports[i]}
+		if exports[i].Status == models.DataExportReady {
+			if url, err := utils.DataExportURL(&exports[i]); err == nil {
+				item["url"] = url
+			}
+		}
+		res = append(res, item)
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   res,
+	})
+}
+
+// DownloadDataExport serves an archive. Access is granted by the signed,
+// time-limited link rather than a session so it works from the email.
+func DownloadDataExport(c *fiber.Ctx) error {
+	_, path, err := utils.VerifyDataExportLink(c.Params("id"), c.Query("expires"), c.Query("signature"))
+	if err == utils.ErrDataExportLinkInvalid {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Internal server error"})
+	}
+
+	return c.Download(path, "myru-data-export.zip")
+}
@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"log"
+	"strings"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// RequestMagicLink mails a single-use sign-in link. The response does not
+// reveal whether the address is registered.
+func RequestMagicLink(c *fiber.Ctx) error {
+	var payload models.MagicLinkInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	// Every request counts, so the mailbox cannot be flooded
+	ip := utils.ClientIP(c)
+	email := strings.ToLower(payload.Email)
+	if limited, err := rejectIfAuthLimited(c, utils.AuthActionMagicLink, ip, email); limited {
+		return err
+	}
+	if _, err := utils.RegisterAuthFailure(utils.AuthActionMagicLink, ip, email); err != nil {
+		log.Printf("auth limiter: %s", err)
+	}
+
+	response := fiber.Map{"status": "success", "message": "If the address is registered, a sign-in link has been sent"}
+
+	var user models.User
+	if err := initializers.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.JSON(response)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Internal server error"})
+	}
+
+	if !user.Verified || user.Banned {
+		return c.JSON(response)
+	}
+
+	token, err := utils.CreateEmailLinkToken(utils.EmailLinkPurposeLogin, utils.EmailLink{
+		UserID:  user.ID.String(),
+		Email:   user.Email,
+		Session: payload.Session,
+	}, utils.MagicLinkTTL)
+	if err != nil {
+		log.Printf("magic link: %s", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Failed to create sign-in link"})
+	}
+
+	config, _ := initializers.LoadConfig(".")
+	language := c.Query("language", "en")
+
+	emailData := utils.EmailData{
+		URL:       "https://www." + config.ClientOrigin + "/auth/magic-link/" + token,
+		FirstName: emailFirstName(&user),
+	}
+
+	switch language {
+	case "ru":
+		emailData.Subject = "Ссылка для входа в MYRUONLINE (доступно 15 мин)"
+	case "es":
+		emailData.Subject = "Enlace de inicio de sesión en MYRUONLINE (15 min disponibles)"
+	case "ke":
+		emailData.Subject = "MYRUONLINE-ში შესვლის ბმული (ხელმისაწვდომია 15 წთ)"
+	default:
+		language = "en"
+		emailData.Subject = "Your MYRUONLINE sign-in link (available for 15 minutes)"
+	}
+
+	utils.SendEmail(&user, &emailData, "magicLink", language)
+
+	return c.JSON(response)
+}
+
+// MagicLinkSignIn exchanges a sign-in link token for the usual token pair.
+// Two-factor authentication still applies.
+func MagicLinkSignIn(c *fiber.Ctx) error {
+	var payload models.EmailLinkTokenInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	link, err := utils.ConsumeEmailLinkToken(utils.EmailLinkPurposeLogin, payload.Token)
+	if err == utils.ErrEmailLinkInvalid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		log.Printf("magic link: %s", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Internal server error"})
+	}
+
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", link.UserID).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": utils.ErrEmailLinkInvalid.Error()})
+	}
+
+	// The link was mailed to an address the account no longer uses
+	if user.Email != link.Email {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": utils.ErrEmailLinkInvalid.Error()})
+	}
+
+	if user.Banned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": "Account is banned"})
+	}
+
+	utils.ResetAuthFailures(utils.AuthActionMagicLink, utils.ClientIP(c), user.Email)
+
+	session := payload.Session
+	if session == "" {
+		session = link.Session
+	}
+
+	return beginSignIn(c, &user, session)
+}
+
+// RequestEmailChange mails a confirmation link to the new address. The email
+// is swapped only once the link is opened.
+func RequestEmailChange(c *fiber.Ctx) error {
+	userResp := c.Locals("user").(models.UserResponse)
+
+	var payload models.ChangeEmailInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", userResp.ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "User not found"})
+	}
+
+	// Accounts created through an external provider have a random password,
+	// so they prove themselves with a second factor or a fresh sign-in
+	if user.Provider == "local" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password)); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": "Invalid password"})
+		}
+	} else if !user.TwoFactorEnabled {
+		sessionID, _ := c.Locals("session_id").(string)
+		recent, err := utils.IsRecentSignIn(sessionID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Internal server error"})
+		}
+		if !recent {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"status":  "reauth_required",
+				"message": "Sign in again to change your email",
+			})
+		}
+	}
+
+	if user.TwoFactorEnabled {
+		if payload.Code == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": "Two-factor code is required"})
+		}
+		ok, err := checkSecondFactor(&user, payload.Code)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+		}
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": "Invalid two-factor code"})
+		}
+	}
+
+	newEmail := strings.ToLower(payload.NewEmail)
+	if newEmail == user.Email {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "This is already your email"})
+	}
+
+	var taken int64
+	initializers.DB.Model(&models.User{}).Where("email = ?", newEmail).Count(&taken)
+	if taken > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "fail", "message": "Email is already in use"})
+	}
+
+	token, err := utils.CreateEmailLinkToken(utils.EmailLinkPurposeChange, utils.EmailLink{
+		UserID: user.ID.String(),
+		Email:  newEmail,
+	}, utils.EmailChangeTTL)
+	if err != nil {
+		log.Printf("email change: %s", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Failed to create confirmation link"})
+	}
+
+	config, _ := initializers.LoadConfig(".")
+	language := c.Query("language", "en")
+
+	emailData := utils.EmailData{
+		URL:       "https://www." + config.ClientOrigin + "/auth/confirm-email/" + token,
+		FirstName: emailFirstName(&user),
+	}
+
+	switch language {
+	case "ru":
+		emailData.Subject = "Подтвердите новый email MYRUONLINE"
+	case "es":
+		emailData.Subject = "Confirme su nuevo correo de MYRUONLINE"
+	case "ke":
+		emailData.Subject = "დაადასტურეთ ახალი MYRUONLINE ელფოსტა"
+	default:
+		language = "en"
+		emailData.Subject = "Confirm your new MYRUONLINE email"
+	}
+
+	recipient := user
+	recipient.Email = newEmail
+	utils.SendEmail(&recipient, &emailData, "emailChange", language)
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Confirmation link sent to the new email"})
+}
+
+// ConfirmEmailChange swaps the email after the new address was verified and
+// alerts the old one.
+func ConfirmEmailChange(c *fiber.Ctx) error {
+	var payload models.EmailLinkTokenInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	link, err := utils.ConsumeEmailLinkToken(utils.EmailLinkPurposeChange, payload.Token)
+	if err == utils.ErrEmailLinkInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		log.Printf("email change: %s", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Internal server error"})
+	}
+
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", link.UserID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "User not found"})
+	}
+
+	var taken int64
+	initializers.DB.Model(&models.User{}).Where("email = ? AND id <> ?", link.Email, user.ID).Count(&taken)
+	if taken > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "fail", "message": "Email is already in use"})
+	}
+
+	oldEmail := user.Email
+	if err := initializers.DB.Model(&user).Updates(map[string]interface{}{
+		"email":    link.Email,
+		"verified": true,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Failed to change email"})
+	}
+
+	// Placeholder addresses of Telegram accounts cannot receive mail
+	if !strings.HasSuffix(oldEmail, ".invalid") {
+		config, _ := initializers.LoadConfig(".")
+		language := c.Query("language", "en")
+
+		emailData := utils.EmailData{
+			URL:       "https://www." + config.ClientOrigin,
+			FirstName: emailFirstName(&user),
+		}
+
+		switch language {
+		case "ru":
+			emailData.Subject = "Email вашего аккаунта MYRUONLINE изменён"
+		case "es":
+			emailData.Subject = "El correo de su cuenta MYRUONLINE ha cambiado"
+		case "ke":
+			emailData.Subject = "თქვენი MYRUONLINE ანგარიშის ელფოსტა შეიცვალა"
+		default:
+			language = "en"
+			emailData.Subject = "Your MYRUONLINE email has been changed"
+		}
+
+		recipient := user
+		recipient.Email = oldEmail
+		utils.SendEmail(&recipient, &emailData, "emailChanged", language)
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Email changed successfully"})
+}
+
+// emailFirstName picks the name used in the greeting of an email.
+func emailFirstName(user *models.User) string {
+	firstName := user.Name
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[1]
+	}
+	return firstName
+}
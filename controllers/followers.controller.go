@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hyperpage/initializers"
 	"hyperpage/models"
+	"hyperpage/utils"
 	"log"
 
 	uuid "github.com/satori/go.uuid"
@@ -173,6 +174,16 @@ func Unscribe(c *fiber.Ctx) error {
 
 }
 
+// Followers and followings are listed newest account first.
+var (
+	followerKeyset  = utils.Keyset{Name: "followers", Columns: []string{"users.created_at", "users.id"}, Desc: true}
+	followingKeyset = utils.Keyset{Name: "followings", Columns: []string{"users.created_at", "users.id"}, Desc: true}
+)
+
+func followKey(u *models.User) []interface{} {
+	return []interface{}{u.CreatedAt, u.ID}
+}
+
 func GetFollowers(c *fiber.Ctx) error {
 	user := c.Locals("user")
 	if user == nil {
@@ -197,15 +208,43 @@ func GetFollowers(c *fiber.Ctx) error {
 		language = "en"
 	}
 
-	var usF models.User
-	if err := initializers.DB.Preload("Followers").Preload("Blogs").Preload("Followers.Profile").Preload("Followers.Profile.Hashtags").Preload("Followers.Domains").Preload("Followers.Profile.Photos").Preload("Followers.Profile.City.Translations", "language = ?", language).Preload("Followers.Followings").Preload("Followers.Followers").Preload("Followers.Profile.Guilds.Translations", "language = ?", language).First(&usF, "id = ?", userObj.ID).Error; err != nil {
-		// Handle database error
+	params, err := utils.ParsePageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	query := initializers.DB.
+		Preload("Profile").
+		Preload("Profile.Hashtags").
+		Preload("Domains").
+		Preload("Profile.Photos").
+		Preload("Profile.City.Translations", "language = ?", language).
+		Preload("Followings").
+		Preload("Followers").
+		Preload("Profile.Guilds.Translations", "language = ?", language).
+		Joins("JOIN user_relation ON user_relation.user_id = users.id").
+		Where("user_relation.following_id = ?", userObj.ID)
+
+	users, page, err := utils.FindPage(query, followerKeyset, params, followKey)
+	if err == utils.ErrCursorInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	} else if err != nil {
 		return err
 	}
 
 	return c.JSON(fiber.Map{
 		"status": "success",
-		"data":   usF.Followers,
+		"data":   users,
+		"meta": page.Meta(fiber.Map{
+			"limit": params.Limit,
+			"skip":  params.Skip,
+		}),
 	})
 }
 
@@ -233,14 +272,42 @@ func GetFollowing(c *fiber.Ctx) error {
 		language = "en"
 	}
 
-	var usF models.User
-	if err := initializers.DB.Preload("Followings").Preload("Blogs").Preload("Followings.Profile").Preload("Followings.Profile.Hashtags").Preload("Followings.Domains").Preload("Followings.Profile.Photos").Preload("Followings.Profile.City.Translations", "language = ?", language).Preload("Followings.Followings").Preload("Followings.Followers").Preload("Followings.Profile.Guilds.Translations", "language = ?", language).First(&usF, "id = ?", userObj.ID).Error; err != nil {
-		// Handle database error
+	params, err := utils.ParsePageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	query := initializers.DB.
+		Preload("Profile").
+		Preload("Profile.Hashtags").
+		Preload("Domains").
+		Preload("Profile.Photos").
+		Preload("Profile.City.Translations", "language = ?", language).
+		Preload("Followings").
+		Preload("Followers").
+		Preload("Profile.Guilds.Translations", "language = ?", language).
+		Joins("JOIN user_relation ON user_relation.following_id = users.id").
+		Where("user_relation.user_id = ?", userObj.ID)
+
+	users, page, err := utils.FindPage(query, followingKeyset, params, followKey)
+	if err == utils.ErrCursorInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	} else if err != nil {
 		return err
 	}
 
 	return c.JSON(fiber.Map{
 		"status": "success",
-		"data":   usF.Followings,
+		"data":   users,
+		"meta": page.Meta(fiber.Map{
+			"limit": params.Limit,
+			"skip":  params.Skip,
+		}),
 	})
 }
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"strings"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// The review queue is served oldest first so that nothing waits forever.
+var moderationKeyset = utils.Keyset{Name: "moderation", Columns: []string{"blogs.updated_at", "blogs.id"}}
+
+// GetModerationQueue lists blogs waiting for review. ?status=REJECTED shows
+// rejected ones instead; user, city, category and title narrow the list.
+func GetModerationQueue(c *fiber.Ctx) error {
+	params, err := utils.ParsePageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	status := strings.ToUpper(c.Query("status", models.BlogStatusPendingReview))
+	if status != models.BlogStatusPendingReview && status != models.BlogStatusRejected {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid status parameter",
+		})
+	}
+
+	language := c.Query("language", "en")
+	query := initializers.DB.
+		Preload("Catygory.Translations", "language = ?", language).
+		Preload("City.Translations", "language = ?", language).
+		Preload("Hashtags").
+		Preload("Photos").
+		Preload("User").
+		Where("blogs.status = ?", status)
+
+	if user := c.Query("user"); user != "" {
+		query = query.Where("blogs.user_id IN (?)", initializers.DB.Table("users").Select("id").Where("id::text = ? OR name = ?", user, user))
+	}
+	if city := c.QueryInt("city"); city != 0 {
+		query = query.Where("blogs.id IN (?)", initializers.DB.Table("blog_city").Select("blog_id").Where("city_id = ?", city))
+	}
+	if category := c.QueryInt("category"); category != 0 {
+		query = query.Where("blogs.id IN (?)", initializers.DB.Table("blog_guilds").Select("blog_id").Where("guilds_id = ?", category))
+	}
+	if title := c.Query("title"); title != "" {
+		query = query.Where("blogs.title ILIKE ?", "%"+title+"%")
+	}
+
+	var count int64
+	if err := query.Model(&models.Blog{}).Count(&count).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
+	}
+
+	blogs, page, err := utils.FindPage(query, moderationKeyset, params, func(b *models.Blog) []interface{} {
+		return []interface{}{b.UpdatedAt, b.ID}
+	})
+	if err == utils.ErrCursorInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   blogs,
+		"meta": page.Meta(fiber.Map{
+			"total": count,
+			"limit": params.Limit,
+			"skip":  params.Skip,
+		}),
+	})
+}
+
+// ApproveBlogs publishes the given pending blogs.
+func ApproveBlogs(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	var payload *models.ModerationDecisionInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	approved, err := utils.ApproveBlogs(payload.IDs, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not approve blogs",
+			"data":    fiber.Map{"approved": approved},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   fiber.Map{"approved": approved},
+	})
+}
+
+// RejectBlogs rejects the given pending blogs with a reason shown to their
+// authors.
+func RejectBlogs(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	var payload *models.ModerationDecisionInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	reason := strings.TrimSpace(payload.Reason)
+	if reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "A rejection reason is required"})
+	}
+
+	rejected, err := utils.RejectBlogs(payload.IDs, reason, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not reject blogs",
+			"data":    fiber.Map{"rejected": rejected},
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   fiber.Map{"rejected": rejected},
+	})
+}
+
+// SetUserTrusted lets a user's blogs skip review, or takes that back.
+func SetUserTrusted(c *fiber.Ctx) error {
+	var payload models.TrustUserInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	result := initializers.DB.Model(&models.User{}).Where("id = ?", c.Params("userId")).Update("trusted", payload.Trusted)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not update user",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "fail",
+			"message": "User not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   fiber.Map{"trusted": payload.Trusted},
+	})
+}
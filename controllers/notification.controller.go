@@ -9,27 +9,20 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+var notificationKeyset = utils.Keyset{Name: "notifications", Columns: []string{"created_at", "id"}, Desc: true}
+
 func GetNotifications(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.UserResponse)
 
-	var notifications []models.Notification
-	db := initializers.DB.Where("user_id = ?", user.ID).Order("created_at DESC")
-
-	limit, err := strconv.Atoi(c.Query("limit", "10"))
+	params, err := utils.ParsePageParams(c)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Invalid limit parameter",
+			"message": err.Error(),
 		})
 	}
 
-	skip, err := strconv.ParseInt(c.Query("skip", "0"), 10, 64)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Invalid skip parameter",
-		})
-	}
+	db := initializers.DB.Where("user_id = ?", user.ID)
 
 	var totalCount int64
 	if err := db.Model(&models.Notification{}).Count(&totalCount).Error; err != nil {
@@ -39,10 +32,19 @@ func GetNotifications(c *fiber.Ctx) error {
 		})
 	}
 
-	db = db.Limit(limit).Offset(int(skip))
-
-	if err := utils.Paginate(c, db, &notifications); err != nil {
-		return err
+	notifications, page, err := utils.FindPage(db, notificationKeyset, params, func(n *models.Notification) []interface{} {
+		return []interface{}{n.CreatedAt, n.ID}
+	})
+	if err == utils.ErrCursorInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
 	}
 
 	var unreadCount int64
@@ -57,11 +59,11 @@ func GetNotifications(c *fiber.Ctx) error {
 		"status": "success",
 		"data":   notifications,
 		"unread": unreadCount,
-		"meta": fiber.Map{
-			"limit": limit,
-			"skip":  skip,
+		"meta": page.Meta(fiber.Map{
+			"limit": params.Limit,
+			"skip":  params.Skip,
 			"total": totalCount,
-		},
+		}),
 	})
 }
 
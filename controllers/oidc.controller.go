@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// OIDCLogin starts the authorization-code flow and returns the provider URL
+// the client should navigate to. ?session= carries the websocket session
+// that completeSignIn notifies once the login finishes.
+func OIDCLogin(c *fiber.Ctx) error {
+	config, _ := initializers.LoadConfig(".")
+
+	if config.OIDCIssuer == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "Single sign-on is not configured"})
+	}
+
+	provider, err := utils.DiscoverOIDC(config.OIDCIssuer)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	stateKey, state, err := utils.NewOIDCState(c.Query("session"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Failed to start single sign-on"})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"url":   utils.OIDCAuthorizationURL(provider, &config, stateKey, state),
+			"state": stateKey,
+		},
+	})
+}
+
+// OIDCCallback exchanges the authorization code, verifies the ID token and
+// signs in the linked user, creating one on first login. Two-factor
+// authentication applies as with a password login.
+func OIDCCallback(c *fiber.Ctx) error {
+	config, _ := initializers.LoadConfig(".")
+
+	if config.OIDCIssuer == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "Single sign-on is not configured"})
+	}
+
+	var payload models.OIDCCallbackInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	state, err := utils.ConsumeOIDCState(payload.State)
+	if err == utils.ErrOIDCStateInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Internal server error"})
+	}
+
+	provider, err := utils.DiscoverOIDC(config.OIDCIssuer)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	rawIDToken, err := utils.ExchangeOIDCCode(provider, &config, payload.Code, state.CodeVerifier)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	claims, err := utils.VerifyOIDCIDToken(provider, &config, rawIDToken, state.Nonce)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	user, err := findOIDCUser(provider.Issuer, claims)
+	if err == errOIDCLinkRequired {
+		// The email belongs to an account that is not linked yet. It is
+		// linked right away when its owner is signed in on this client,
+		// otherwise only once its password is confirmed.
+		if user.Banned {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": "Account is banned"})
+		}
+		if signedInUserID(c) == user.ID.String() {
+			if err := linkOIDCIdentity(user, provider.Issuer, claims.Subject); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Failed to link account"})
+			}
+		} else {
+			linkToken, err := utils.NewOIDCLink(utils.OIDCLink{
+				UserID:  user.ID.String(),
+				Issuer:  provider.Issuer,
+				Subject: claims.Subject,
+				Session: state.Session,
+			})
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Internal server error"})
+			}
+
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"status":     "link_required",
+				"message":    "An account with this email already exists, confirm its password to link it",
+				"link_token": linkToken,
+				"expires_in": int(utils.OIDCStateTTL.Seconds()),
+			})
+		}
+	} else if err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	if user.Banned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": "Account is banned"})
+	}
+
+	return beginSignIn(c, user, state.Session)
+}
+
+// OIDCLinkAccount links an existing account to the identity provider once
+// its owner confirms the password, then signs them in.
+func OIDCLinkAccount(c *fiber.Ctx) error {
+	var payload models.OIDCLinkInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	link, err := utils.ConsumeOIDCLink(payload.LinkToken)
+	if err == utils.ErrOIDCLinkInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Internal server error"})
+	}
+
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", link.UserID).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": utils.ErrOIDCLinkInvalid.Error()})
+	}
+
+	ip := utils.ClientIP(c)
+	if limited, err := rejectIfAuthLimited(c, utils.AuthActionLogin, ip, user.Email); limited {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password)); err != nil {
+		registerLoginFailure(c, ip, user.Email, &user)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": "Invalid password"})
+	}
+	utils.ResetAuthFailures(utils.AuthActionLogin, ip, user.Email)
+
+	if user.Banned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": "Account is banned"})
+	}
+
+	if err := linkOIDCIdentity(&user, link.Issuer, link.Subject); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Failed to link account"})
+	}
+
+	return beginSignIn(c, &user, link.Session)
+}
+
+var errOIDCLinkRequired = errors.New("account exists and is not linked to the identity provider")
+
+// findOIDCUser resolves the account for an ID token: the account created by
+// or linked to the issuer and subject, else a new one. When the verified
+// email belongs to another account it returns that account together with
+// errOIDCLinkRequired; the caller must prove ownership before linking it.
+func findOIDCUser(issuer string, claims *utils.OIDCClaims) (*models.User, error) {
+	var user models.User
+
+	err := initializers.DB.Where("(provider = ? AND provider_subject = ?) OR (oidc_issuer = ? AND oidc_subject = ?)",
+		issuer, claims.Subject, issuer, claims.Subject).First(&user).Error
+	if err == nil {
+		return &user, nil
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errors.New("The identity provider did not return a verified email")
+	}
+
+	err = initializers.DB.Where("email = ?", strings.ToLower(claims.Email)).First(&user).Error
+	if err == nil {
+		return &user, errOIDCLinkRequired
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	name := claims.PreferredUsername
+	if name == "" {
+		name = claims.Name
+	}
+	if name == "" {
+		name = strings.Split(claims.Email, "@")[0]
+	}
+
+	return registerExternalUser(name, claims.Email, issuer, claims.Subject)
+}
+
+// linkOIDCIdentity records the provider identity of an account. Provider
+// and ProviderSubject keep telling how the account was created.
+func linkOIDCIdentity(user *models.User, issuer, subject string) error {
+	user.OIDCIssuer = issuer
+	user.OIDCSubject = subject
+	user.Verified = true
+	return initializers.DB.Model(user).Updates(map[string]interface{}{
+		"oidc_issuer":  issuer,
+		"oidc_subject": subject,
+		"verified":     true,
+	}).Error
+}
+
+// signedInUserID returns the user of a valid access token sent with the
+// request, if any.
+func signedInUserID(c *fiber.Ctx) string {
+	token := c.Cookies("access_token")
+	if authorization := c.Get("Authorization"); strings.HasPrefix(authorization, "Bearer ") {
+		token = strings.TrimPrefix(authorization, "Bearer ")
+	}
+	if token == "" {
+		return ""
+	}
+
+	config, _ := initializers.LoadConfig(".")
+	claims, err := utils.ValidateToken(token, config.AccessTokenPublicKey)
+	if err != nil {
+		return ""
+	}
+	if active, err := utils.IsSessionActive(claims.SessionID); err != nil || !active {
+		return ""
+	}
+	return claims.UserID
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetRoles lists roles with their grants.
+func GetRoles(c *fiber.Ctx) error {
+	var roles []models.AccessRole
+	if err := initializers.DB.Order("name").Find(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve roles",
+		})
+	}
+
+	var grants []models.RolePermission
+	if err := initializers.DB.Preload("Permission").Order("role, permission_id").Find(&grants).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve grants",
+		})
+	}
+
+	byRole := make(map[string][]models.RolePermission, len(roles))
+	for _, grant := range grants {
+		byRole[grant.Role] = append(byRole[grant.Role], grant)
+	}
+
+	res := make([]fiber.Map, 0, len(roles))
+	for _, role := range roles {
+		roleGrants := byRole[role.Name]
+		if roleGrants == nil {
+			roleGrants = []models.RolePermission{}
+		}
+		res = append(res, fiber.Map{
+			"role":   role,
+			"grants": roleGrants,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   res,
+	})
+}
+
+func CreateRole(c *fiber.Ctx) error {
+	var payload models.CreateRoleInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	role := models.AccessRole{Name: payload.Name, Description: payload.Description}
+	result := initializers.DB.Where(models.AccessRole{Name: payload.Name}).FirstOrCreate(&role)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to create role",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "fail", "message": "Role already exists"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status": "success",
+		"data":   role,
+	})
+}
+
+// DeleteRole removes a role and its grants. Roles still assigned to users
+// cannot be removed.
+func DeleteRole(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	var role models.AccessRole
+	if err := initializers.DB.First(&role, "name = ?", name).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "Role not found"})
+	}
+
+	var users int64
+	initializers.DB.Model(&models.User{}).Where("role = ?", name).Count(&users)
+	if users > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "fail", "message": "Role is assigned to users"})
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role = ?", name).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete role",
+		})
+	}
+
+	utils.InvalidateRolePermissions(name)
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Role deleted successfully",
+	})
+}
+
+func GetPermissions(c *fiber.Ctx) error {
+	var permissions []models.Permission
+	if err := initializers.DB.Order("resource, action").Find(&permissions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve permissions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   permissions,
+	})
+}
+
+// GrantPermission grants a permission to a role or changes the scope of an
+// existing grant.
+func GrantPermission(c *fiber.Ctx) error {
+	var payload models.GrantPermissionInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	var role models.AccessRole
+	if err := initializers.DB.First(&role, "name = ?", payload.Role).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "Role not found"})
+	}
+
+	var permission models.Permission
+	if err := initializers.DB.First(&permission, "resource = ? AND action = ?", payload.Resource, payload.Action).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "Permission not found"})
+	}
+
+	grant := models.RolePermission{Role: role.Name, PermissionID: permission.ID}
+	err := initializers.DB.Where(grant).Assign(models.RolePermission{Scope: payload.Scope}).FirstOrCreate(&grant).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to grant permission",
+		})
+	}
+	grant.Permission = permission
+
+	utils.InvalidateRolePermissions(role.Name)
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   grant,
+	})
+}
+
+func RevokePermission(c *fiber.Ctx) error {
+	var grant models.RolePermission
+	if err := initializers.DB.First(&grant, "id = ?", c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "Grant not found"})
+	}
+
+	if err := initializers.DB.Delete(&grant).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to revoke permission",
+		})
+	}
+
+	utils.InvalidateRolePermissions(grant.Role)
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Permission revoked successfully",
+	})
+}
+
+// hasScopeAny reports whether CheckPermission granted the request with scope
+// "any", i.e. the user may act on records of other users.
+func hasScopeAny(c *fiber.Ctx) bool {
+	scope, _ := c.Locals("permission_scope").(string)
+	return scope == models.PermissionScopeAny
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"hyperpage/initializers"
 	"hyperpage/models"
+	"hyperpage/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -16,6 +17,9 @@ func CreatePresavedfilter(c *fiber.Ctx) error {
 	}
 
 	filter.UserID = user.ID
+	// Alerts are turned on through PatchPresavedFilterAlerts
+	filter.Alerts = models.SavedSearchAlertsOff
+	filter.AlertsCheckedAt = nil
 
 	result := initializers.DB.Create(filter)
 	if result.Error != nil {
@@ -67,6 +71,7 @@ func DeletePresavedFilter(c *fiber.Ctx) error {
 	}
 
 	// Delete the presaved filter from the database
+	initializers.DB.Where("filter_id = ?", filter.ID).Delete(&models.SavedSearchMatch{})
 	if err := initializers.DB.Delete(&filter).Error; err != nil {
 		// If there is an error while deleting the presaved filter, return an error
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -127,3 +132,42 @@ func PatchPresavedFilter(c *fiber.Ctx) error {
 		"data":    filter,
 	})
 }
+
+// PatchPresavedFilterAlerts subscribes a saved filter to new matching blogs,
+// announced instantly or in a daily digest, or unsubscribes it.
+func PatchPresavedFilterAlerts(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	filterID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid presaved filter id"})
+	}
+
+	var payload *models.SavedSearchAlertsInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	filter, err := utils.SetSavedSearchAlerts(user.ID, uint64(filterID), payload.Alerts)
+	if err == utils.ErrSavedSearchNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Presaved filter not found",
+		})
+	} else if err == utils.ErrSavedSearchInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update presaved filter alerts",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   filter,
+	})
+}
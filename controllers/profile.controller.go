@@ -6,6 +6,7 @@ import (
 	"hyperpage/initializers"
 	"hyperpage/models"
 	"hyperpage/utils"
+	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -15,7 +16,6 @@ import (
 
 	"reflect"
 
-	gt "github.com/bas24/googletranslatefree"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
@@ -42,11 +42,18 @@ import (
 
 // }
 
+// Profiles are listed by user name, which is unique, the profile ID only
+// breaks ties of the row comparison.
+var profileListKeyset = utils.Keyset{Name: "profiles", Columns: []string{"users.name", "profiles.id"}}
+
+func profileListKey(p *models.Profile) []interface{} {
+	return []interface{}{p.User.Name, p.ID}
+}
+
 func GetProfiles(c *fiber.Ctx) error {
 
 	language := c.Query("language")
 
-	var profiles []models.Profile
 	query := initializers.DB.
 		Preload("Guilds.Translations", "language = ?", language).
 		Preload("Hashtags").
@@ -54,8 +61,8 @@ func GetProfiles(c *fiber.Ctx) error {
 		Preload("Photos").
 		Preload("User").
 		Joins("JOIN users ON profiles.user_id = users.id").
-		Order("Users.name ASC").
-		Where("Users.filled = ?", true)
+		Where("Users.filled = ?", true).
+		Where("Users.deletion_requested_at IS NULL")
 	// Get the query parameters
 	city := c.Query("city")
 	hashtags := c.Query("hashtag")
@@ -133,6 +140,18 @@ func GetProfiles(c *fiber.Ctx) error {
 
 	}
 
+	geo, err := utils.ParseGeoFilter(c.Query("lat"), c.Query("lng"), c.Query("radius_km"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+	if geo != nil {
+		geo.Coarsen(utils.ProfileDistanceStepKm)
+		query = geo.Within(query, utils.ProfileLocation)
+	}
+
 	var count int64
 	if err := query.Model(&models.Profile{}).Count(&count).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -141,18 +160,45 @@ func GetProfiles(c *fiber.Ctx) error {
 		})
 	}
 
-	limit := c.Query("limit", "10")
-	limitInt, err := strconv.Atoi(limit)
+	params, err := utils.ParsePageParams(c)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Invalid limit parameter",
+			"message": err.Error(),
 		})
 	}
 
-	err = utils.Paginate(c, query.Limit(limitInt).Find(&profiles), &profiles)
-	if err != nil {
-		return err
+	// Distance order has no stable cursor
+	var profiles []models.Profile
+	page := &utils.CursorPage{}
+	if geo != nil {
+		if params.Cursor != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Cursor pagination is not available for distance sorting, use skip",
+			})
+		}
+		err = geo.OrderByDistance(query, utils.ProfileLocation, "users.name ASC, profiles.id ASC").
+			Offset(params.Skip).
+			Limit(params.Limit).
+			Find(&profiles).Error
+		for i := range profiles {
+			lat, lng := utils.ProfileCoordinates(&profiles[i])
+			profiles[i].Distance = geo.CoarseDistanceTo(lat, lng, utils.ProfileDistanceStepKm)
+		}
+	} else {
+		profiles, page, err = utils.FindPage(query, profileListKeyset, params, profileListKey)
+	}
+	if err == utils.ErrCursorInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
 	}
 
 	var userIds []uuid.UUID
@@ -174,10 +220,10 @@ func GetProfiles(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"status": "success",
 		"data":   streamings,
-		"meta": fiber.Map{
+		"meta": page.Meta(fiber.Map{
 			"total": len(profiles),
-			"limit": limitInt,
-		},
+			"limit": params.Limit,
+		}),
 	})
 
 }
@@ -186,18 +232,18 @@ func GetAllProfile(c *fiber.Ctx) error {
 
 	language := c.Query("language")
 
-	var profiles []models.Profile
 	query := initializers.DB.
 		Preload("Guilds.Translations", "language = ?", language).
 		Preload("Hashtags").
 		Preload("City.Translations", "language = ?", language).
+		Preload("Stations.Translations", "language = ?", language).
 		Preload("Photos").
 		Preload("User.Blogs").
 		Preload("User.Blogs.Photos").
 		Preload("User").
 		Joins("JOIN users ON profiles.user_id = users.id").
-		Order("Users.name ASC").
-		Where("Users.filled = ?", true)
+		Where("Users.filled = ?", true).
+		Where("Users.deletion_requested_at IS NULL")
 	// Get the query parameters
 	city := c.Query("city")
 	hashtags := c.Query("hashtag")
@@ -283,27 +329,35 @@ func GetAllProfile(c *fiber.Ctx) error {
 		})
 	}
 
-	limit := c.Query("limit", "10")
-	limitInt, err := strconv.Atoi(limit)
+	params, err := utils.ParsePageParams(c)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Invalid limit parameter",
+			"message": err.Error(),
 		})
 	}
 
-	err = utils.Paginate(c, query.Limit(limitInt).Find(&profiles), &profiles)
-	if err != nil {
-		return err
+	profiles, page, err := utils.FindPage(query, profileListKeyset, params, profileListKey)
+	if err == utils.ErrCursorInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
 	}
 
 	return c.JSON(fiber.Map{
 		"status": "success",
 		"data":   profiles,
-		"meta": fiber.Map{
+		"meta": page.Meta(fiber.Map{
 			"total": count,
-			"limit": limitInt,
-		},
+			"limit": params.Limit,
+			"skip":  params.Skip,
+		}),
 	})
 
 }
@@ -359,7 +413,7 @@ func GetProfileGuest(c *fiber.Ctx) error {
 
 		name := c.Params("name")
 		var profile models.User
-		if err := initializers.DB.Preload("Followers").Preload("Followings").Preload("Followings.Followers").Preload("Profile.Guilds.Translations", "language = ?", language).Preload("Profile.Photos").Preload("Profile.Service").Preload("Profile.City.Translations", "language = ?", language).Preload("Profile.Hashtags").Preload("Blogs").Preload("Blogs.Photos").Preload("Blogs.Votes").Preload("Profile.Documents").First(&profile, "name = ?", name).Error; err != nil {
+		if err := initializers.DB.Preload("Followers").Preload("Followings").Preload("Followings.Followers").Preload("Profile.Guilds.Translations", "language = ?", language).Preload("Profile.Photos").Preload("Profile.Service").Preload("Profile.City.Translations", "language = ?", language).Preload("Profile.Hashtags").Preload("Blogs").Preload("Blogs.Photos").Preload("Blogs.Votes").Preload("Profile.Documents").First(&profile, "name = ? AND deletion_requested_at IS NULL", name).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 					"status":  "error",
@@ -429,7 +483,7 @@ func GetProfileGuest(c *fiber.Ctx) error {
 
 		name := c.Params("name")
 		var profile models.User
-		if err := initializers.DB.Preload("Followings").Preload("Followers").Preload("Profile.Guilds.Translations", "language = ?", language).Preload("Profile.Photos").Preload("Profile.Service").Preload("Profile.City.Translations", "language = ?", language).Preload("Profile.Hashtags").Preload("Blogs").Preload("Blogs.Photos").Preload("Blogs.Votes").Preload("Profile.Documents").First(&profile, "name = ?", name).Error; err != nil {
+		if err := initializers.DB.Preload("Followings").Preload("Followers").Preload("Profile.Guilds.Translations", "language = ?", language).Preload("Profile.Photos").Preload("Profile.Service").Preload("Profile.City.Translations", "language = ?", language).Preload("Profile.Hashtags").Preload("Blogs").Preload("Blogs.Photos").Preload("Blogs.Votes").Preload("Profile.Documents").First(&profile, "name = ? AND deletion_requested_at IS NULL", name).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 					"status":  "error",
@@ -517,33 +571,7 @@ func UpdateProfileAdditional(c *fiber.Ctx) error {
 		})
 	}
 
-	// Fetch languages from the database
-	var langs []models.Langs
-	err = initializers.DB.Raw("SELECT * FROM langs").Scan(&langs).Error
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Could not fetch languages",
-		})
-	}
-	translations := make(map[string]string)
-
-	for _, lang := range langs {
-		result, err := gt.Translate(requestBody.Additional, profile.Lang, lang.Code)
-		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"status":  "error",
-				"message": fmt.Sprintf("Could not translate to %s: %v", lang.Code, err),
-			})
-		}
-		translations[lang.Code] = result
-	}
-
-	// Set the translated values in the TitleLangs field
-	profile.MultilangAdditional.En = translations["en"]
-	profile.MultilangAdditional.Ru = translations["ru"]
-	profile.MultilangAdditional.Ka = translations["ka"]
-	profile.MultilangAdditional.Es = translations["es"]
+	profile.MultilangAdditional = utils.PrefillTranslations(requestBody.Additional, profile.Lang)
 
 	// Update the "Additional" field in the profile
 	profile.Additional = requestBody.Additional
@@ -556,6 +584,7 @@ func UpdateProfileAdditional(c *fiber.Ctx) error {
 			"message": "Could not save profile",
 		})
 	}
+	translateProfile(profile.ID, "additional")
 
 	// Return a success response
 	return c.JSON(fiber.Map{
@@ -585,27 +614,7 @@ func UpdateBotProfileAdditional(c *fiber.Ctx) error {
 		// Handle the error appropriately (e.g., return an error response)
 	}
 
-	// Fetch languages from the database
-	var langs []models.Langs
-	err = initializers.DB.Raw("SELECT * FROM langs").Scan(&langs).Error
-	if err != nil {
-		return err
-	}
-
-	translations := make(map[string]string)
-
-	for _, lang := range langs {
-
-		result, _ := gt.Translate(requestBody.Additional, profile.Lang, lang.Code)
-		translations[lang.Code] = result
-
-	}
-
-	// Set the translated values in the TitleLangs field
-	profile.MultilangAdditional.En = translations["en"]
-	profile.MultilangAdditional.Ru = translations["ru"]
-	profile.MultilangAdditional.Ka = translations["ka"]
-	profile.MultilangAdditional.Es = translations["es"]
+	profile.MultilangAdditional = utils.PrefillTranslations(requestBody.Additional, profile.Lang)
 
 	// Update the "Additional" field in the profile
 	profile.Additional = requestBody.Additional
@@ -615,6 +624,8 @@ func UpdateBotProfileAdditional(c *fiber.Ctx) error {
 	if err != nil {
 		_ = err
 		// Handle the error appropriately (e.g., return an error response)
+	} else {
+		translateProfile(profile.ID, "additional")
 	}
 
 	// Return a success response
@@ -639,6 +650,11 @@ func UpdateProfile(c *fiber.Ctx) error {
 		Hashtags []struct {
 			ID uint64 `json:"id"`
 		} `json:"hashtags"`
+		utils.CoordinatesUpdate
+		// Stations are kept when left out
+		Stations []struct {
+			ID uint64 `json:"id"`
+		} `json:"stations"`
 	}
 
 	var requestBody RequestBody
@@ -648,6 +664,12 @@ func UpdateProfile(c *fiber.Ctx) error {
 			"message": "Could not parse request body",
 		})
 	}
+	if err := requestBody.CoordinatesUpdate.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
 	user := c.Locals("user").(models.UserResponse)
 
 	var profile models.Profile
@@ -664,27 +686,7 @@ func UpdateProfile(c *fiber.Ctx) error {
 		})
 	}
 
-	// Fetch languages from the database
-	var langs []models.Langs
-	err := initializers.DB.Raw("SELECT * FROM langs").Scan(&langs).Error
-	if err != nil {
-		return err
-	}
-
-	translations := make(map[string]string)
-
-	for _, lang := range langs {
-
-		result, _ := gt.Translate(requestBody.Descr, profile.Lang, lang.Code)
-		translations[lang.Code] = result
-
-	}
-
-	// Set the translated values in the TitleLangs field
-	profile.MultilangDescr.En = translations["en"]
-	profile.MultilangDescr.Ru = translations["ru"]
-	profile.MultilangDescr.Ka = translations["ka"]
-	profile.MultilangDescr.Es = translations["es"]
+	profile.MultilangDescr = utils.PrefillTranslations(requestBody.Descr, profile.Lang)
 
 	// Create a new slice to store the updated list of cities
 	updatedCities := []models.City{}
@@ -772,6 +774,7 @@ func UpdateProfile(c *fiber.Ctx) error {
 	// profile.Lastname = requestBody.Lastname
 	// profile.MiddleN = requestBody.MiddleN
 	profile.Descr = requestBody.Descr
+	requestBody.CoordinatesUpdate.Apply(&profile.Latitude, &profile.Longitude)
 
 	// Save the updated profile to the database
 	if err := initializers.DB.Save(&profile).Error; err != nil {
@@ -780,6 +783,7 @@ func UpdateProfile(c *fiber.Ctx) error {
 			"message": "Failed to update profile",
 		})
 	}
+	translateProfile(profile.ID, "descr")
 
 	// Update the city associations in the database
 	if err := initializers.DB.Model(&profile).Association("City").Replace(updatedCities); err != nil {
@@ -805,6 +809,20 @@ func UpdateProfile(c *fiber.Ctx) error {
 		})
 	}
 
+	// Update the station associations in the database
+	if requestBody.Stations != nil {
+		updatedStations := []models.Stations{}
+		for _, station := range requestBody.Stations {
+			updatedStations = append(updatedStations, models.Stations{ID: uint(station.ID)})
+		}
+		if err := initializers.DB.Model(&profile).Association("Stations").Replace(updatedStations); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to update station associations",
+			})
+		}
+	}
+
 	var newUser models.User
 
 	// Find the corresponding user record based on user.ID
@@ -875,27 +893,7 @@ func UpdateBotProfile(c *fiber.Ctx) error {
 		})
 	}
 
-	// Fetch languages from the database
-	var langs []models.Langs
-	err := initializers.DB.Raw("SELECT * FROM langs").Scan(&langs).Error
-	if err != nil {
-		return err
-	}
-
-	translations := make(map[string]string)
-
-	for _, lang := range langs {
-
-		result, _ := gt.Translate(requestBody.Descr, profile.Lang, lang.Code)
-		translations[lang.Code] = result
-
-	}
-
-	// Set the translated values in the TitleLangs field
-	profile.MultilangDescr.En = translations["en"]
-	profile.MultilangDescr.Ru = translations["ru"]
-	profile.MultilangDescr.Ka = translations["ka"]
-	profile.MultilangDescr.Es = translations["es"]
+	profile.MultilangDescr = utils.PrefillTranslations(requestBody.Descr, profile.Lang)
 
 	// Create a new slice to store the updated list of cities
 	updatedCities := []models.City{}
@@ -991,6 +989,7 @@ func UpdateBotProfile(c *fiber.Ctx) error {
 			"message": "Failed to update profile",
 		})
 	}
+	translateProfile(profile.ID, "descr")
 
 	// Update the city associations in the database
 	if err := initializers.DB.Model(&profile).Association("City").Replace(updatedCities); err != nil {
@@ -1729,3 +1728,11 @@ func DeleteProfileStreaming(c *fiber.Ctx) error {
 		"data":   profile.Streaming,
 	})
 }
+
+// translateProfile queues the translations of saved profile fields that are
+// missing.
+func translateProfile(id uint64, fields ...string) {
+	if err := utils.TranslateFields(models.TranslationEntityProfile, id, fields...); err != nil {
+		log.Printf("Could not translate profile %d: %s", id, err)
+	}
+}
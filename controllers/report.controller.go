@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"strings"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+	uuid "github.com/satori/go.uuid"
+)
+
+// The triage queue is served oldest first.
+var reportKeyset = utils.Keyset{Name: "reports", Columns: []string{"reports.created_at", "reports.id"}}
+
+// CreateReport files an abuse report on a post, user, chat message or profile.
+func CreateReport(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	var payload *models.CreateReportInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	report, err := utils.CreateReport(user.ID, payload)
+	if err != nil {
+		return reportError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status": "success",
+		"data":   report,
+	})
+}
+
+// GetReports lists reports for triage. By default open and assigned reports
+// are shown; status, target_type, reason and assignee ("me" or a user ID)
+// narrow the list.
+func GetReports(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	params, err := utils.ParsePageParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	query := initializers.DB.Model(&models.Report{})
+
+	switch status := strings.ToUpper(c.Query("status")); status {
+	case "":
+		query = query.Where("reports.status IN ?", []string{models.ReportStatusOpen, models.ReportStatusAssigned})
+	case models.ReportStatusOpen, models.ReportStatusAssigned, models.ReportStatusResolved, models.ReportStatusDismissed:
+		query = query.Where("reports.status = ?", status)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid status parameter",
+		})
+	}
+
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("reports.target_type = ?", targetType)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		query = query.Where("reports.target_id = ?", targetID)
+	}
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reports.reason = ?", reason)
+	}
+	if assignee := c.Query("assignee"); assignee == "me" {
+		query = query.Where("reports.assignee_id = ?", user.ID)
+	} else if assignee != "" {
+		assigneeID, err := uuid.FromString(assignee)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid assignee parameter",
+			})
+		}
+		query = query.Where("reports.assignee_id = ?", assigneeID)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
+	}
+
+	reports, page, err := utils.FindPage(query, reportKeyset, params, func(r *models.Report) []interface{} {
+		return []interface{}{r.CreatedAt, r.ID}
+	})
+	if err == utils.ErrCursorInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   reports,
+		"meta": page.Meta(fiber.Map{
+			"total": count,
+			"limit": params.Limit,
+			"skip":  params.Skip,
+		}),
+	})
+}
+
+// AssignReport hands a report to an admin; a null assignee_id puts it back
+// into the queue.
+func AssignReport(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid report id"})
+	}
+
+	var payload models.AssignReportInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	report, err := utils.AssignReport(uint64(id), payload.AssigneeID)
+	if err != nil {
+		return reportError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   report,
+	})
+}
+
+// ResolveReport closes a report as upheld.
+func ResolveReport(c *fiber.Ctx) error {
+	return closeReport(c, models.ReportStatusResolved)
+}
+
+// DismissReport closes a report as unfounded.
+func DismissReport(c *fiber.Ctx) error {
+	return closeReport(c, models.ReportStatusDismissed)
+}
+
+func closeReport(c *fiber.Ctx, status string) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid report id"})
+	}
+
+	var payload *models.CloseReportInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	report, err := utils.CloseReport(uint64(id), status, strings.TrimSpace(payload.Resolution), user.ID)
+	if err != nil {
+		return reportError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   report,
+	})
+}
+
+func reportError(c *fiber.Ctx, err error) error {
+	switch err {
+	case utils.ErrReportRateLimited:
+		utils.SetRetryAfter(c, utils.ReportRateWindow)
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	case utils.ErrReportDuplicate, utils.ErrReportClosed:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	case utils.ErrReportTargetMissing, utils.ErrReportNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	case utils.ErrReportOwnTarget:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Could not process report"})
+}
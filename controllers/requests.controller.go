@@ -1,12 +1,27 @@
 package controllers
 
 import (
+	"log"
+	"strings"
+
 	"hyperpage/models"
 	"hyperpage/utils"
 
 	"github.com/gofiber/fiber/v2"
+	uuid "github.com/satori/go.uuid"
 )
 
+// complaintBody is a complaint of the "ComplaintUser" and "ComplaintPost"
+// modes. target_id and reason are optional for older clients: the target
+// defaults to name and the reason to "other".
+type complaintBody struct {
+	Name     string `json:"name"`
+	Descr    string `json:"descr"`
+	Type     string `json:"type"`
+	TargetID string `json:"target_id"`
+	Reason   string `json:"reason"`
+}
+
 func Userq(c *fiber.Ctx) error {
 
 	mode := c.Query("mode")
@@ -49,16 +64,13 @@ func Userq(c *fiber.Ctx) error {
 			Descr:   requestBody.Descr,
 		}
 	case "ComplaintUser":
-		var requestBody struct {
-			Name  string `json:"name"`
-			Descr string `json:"descr"`
-			Type  string `json:"type"`
-		}
+		var requestBody complaintBody
 		if err := c.BodyParser(&requestBody); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Failed to parse JSON body",
 			})
 		}
+		fileComplaint(c, models.ReportTargetUser, &requestBody)
 		emailData = &utils.ComplainUser{
 			Subject: "Complaint on the user",
 			Name:    requestBody.Name,
@@ -66,16 +78,13 @@ func Userq(c *fiber.Ctx) error {
 			Type:    requestBody.Type,
 		}
 	case "ComplaintPost":
-		var requestBody struct {
-			Name  string `json:"name"`
-			Descr string `json:"descr"`
-			Type  string `json:"type"`
-		}
+		var requestBody complaintBody
 		if err := c.BodyParser(&requestBody); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Failed to parse JSON body",
 			})
 		}
+		fileComplaint(c, models.ReportTargetPost, &requestBody)
 		emailData = &utils.ComplainPost{
 			Subject: "Complaint on the post",
 			Name:    requestBody.Name,
@@ -113,3 +122,34 @@ func Userq(c *fiber.Ctx) error {
 
 	return c.SendStatus(fiber.StatusOK)
 }
+
+// fileComplaint also stores a complaint as a report, with the rate limit,
+// de-duplication and triage of CreateReport, when the caller is signed in
+// and the target can be found. Anonymous complaints and the ones naming a
+// target by its title only reach the support address, as before.
+func fileComplaint(c *fiber.Ctx, targetType string, body *complaintBody) {
+	reporterID, err := uuid.FromString(signedInUserID(c))
+	if err != nil {
+		return
+	}
+
+	input := &models.CreateReportInput{
+		TargetType: targetType,
+		TargetID:   strings.TrimSpace(body.TargetID),
+		Reason:     body.Reason,
+		Details:    body.Descr,
+	}
+	if input.TargetID == "" {
+		input.TargetID = strings.TrimSpace(body.Name)
+	}
+	if input.Reason == "" {
+		input.Reason = "other"
+	}
+	if errors := models.ValidateStruct(input); errors != nil {
+		return
+	}
+
+	if _, err := utils.CreateReport(reporterID, input); err != nil && err != utils.ErrReportTargetMissing {
+		log.Printf("complaint: report %s %s: %s", targetType, input.TargetID, err)
+	}
+}
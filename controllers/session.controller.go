@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type sessionResponse struct {
+	utils.Session
+	Current bool `json:"current"`
+}
+
+func GetSessions(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+	currentSessionID, _ := c.Locals("session_id").(string)
+
+	sessions, err := utils.ListSessions(user.ID.String())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to retrieve sessions",
+		})
+	}
+
+	res := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, sessionResponse{
+			Session: session,
+			Current: session.ID == currentSessionID,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   res,
+	})
+}
+
+func RevokeSession(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+	sessionID := c.Params("id")
+
+	if err := utils.RevokeSession(user.ID.String(), sessionID); err != nil {
+		if err == utils.ErrSessionNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Session not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to revoke session",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeAllSessions logs the user out everywhere. With ?keepCurrent=true the
+// session making the request survives.
+func RevokeAllSessions(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	keepSessionID := ""
+	if c.QueryBool("keepCurrent") {
+		keepSessionID, _ = c.Locals("session_id").(string)
+	}
+
+	revoked, err := utils.RevokeAllSessions(user.ID.String(), keepSessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to revoke sessions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Sessions revoked successfully",
+		"revoked": revoked,
+	})
+}
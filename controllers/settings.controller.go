@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"log"
+
 	"hyperpage/initializers"
 	"hyperpage/models"
+	"hyperpage/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -95,6 +98,9 @@ func AddLang(c *fiber.Ctx) error {
 		})
 	}
 
+	// Existing content is translated into the new language in the background
+	go utils.TranslateAllContent()
+
 	// Return success response
 	return c.JSON(AddLangResponse{
 		Status: "success",
@@ -130,6 +136,9 @@ func DeleteLang(c *fiber.Ctx) error {
 			"message": "Failed to delete the language",
 		})
 	}
+	if err := utils.DeleteLanguageTranslations(existingLang.Code); err != nil {
+		log.Printf("settings: delete translations into %s: %s", existingLang.Code, err)
+	}
 
 	// Return success response
 	return c.JSON(DeleteLangResponse{
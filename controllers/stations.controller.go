@@ -1,53 +1,423 @@
 package controllers
 
 import (
+	"strconv"
+
 	"github.com/gofiber/fiber/v2"
 
 	"hyperpage/initializers"
 	"hyperpage/models"
+	"hyperpage/utils"
 )
 
+type stationJSON struct {
+	ID        uint     `json:"id"`
+	Name      string   `json:"name"`
+	Line      string   `json:"line,omitempty"`
+	Hex       string   `json:"hex,omitempty"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+}
+
+type stationLineJSON struct {
+	Line     string        `json:"line"`
+	Hex      string        `json:"hex"`
+	Stations []stationJSON `json:"stations"`
+}
+
+type stationCityJSON struct {
+	CityID uint              `json:"city_id"`
+	Lines  []stationLineJSON `json:"lines"`
+}
+
+// GetStations lists the stations grouped by city and line, named in
+// ?language=. ?city= takes a city ID.
 func GetStations(c *fiber.Ctx) error {
-	// get all city names from the database
-	var stationsNames []string
-	if err := initializers.DB.Model(&models.Stations{}).Pluck("name", &stationsNames).Error; err != nil {
+	language := c.Query("language")
+	if language == "" {
+		language = "en"
+	}
+
+	query := initializers.DB.Preload("Translations", "language = ?", language)
+	if city := c.Query("city"); city != "" {
+		query = query.Where("city_id = ?", city)
+	}
+
+	var stations []models.Stations
+	if err := query.Order("city_id, line, name, id").Find(&stations).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Could not fetch city names from database",
+			"message": "Could not fetch stations from database",
+		})
+	}
+
+	res := []stationCityJSON{}
+	for i := range stations {
+		s := &stations[i]
+		name, line := stationNames(s)
+
+		if len(res) == 0 || res[len(res)-1].CityID != s.CityID {
+			res = append(res, stationCityJSON{CityID: s.CityID})
+		}
+		city := &res[len(res)-1]
+		// Lines are grouped by their default name, which sorts them
+		if len(city.Lines) == 0 || stations[i-1].Line != s.Line {
+			city.Lines = append(city.Lines, stationLineJSON{Line: line, Hex: s.Hex})
+		}
+		lineJSON := &city.Lines[len(city.Lines)-1]
+		lineJSON.Stations = append(lineJSON.Stations, stationJSON{
+			ID:        s.ID,
+			Name:      name,
+			Latitude:  s.Latitude,
+			Longitude: s.Longitude,
 		})
 	}
 
-	// return the city names as a JSON response
 	return c.JSON(fiber.Map{
 		"status": "success",
-		"data":   stationsNames,
+		"data":   res,
 	})
 }
 
+// GetNameStation searches stations by their default or translated name.
+// ?lang= picks the translations returned and searched, ?city= narrows the
+// search to a city.
 func GetNameStation(c *fiber.Ctx) error {
-	// Get the name query parameter
 	name := c.Query("name")
+	lang := c.Query("lang")
 
-	// Check if the name is provided
-	if name == "" {
+	if name == "" || lang == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Name parameter is required",
+			"message": "Both 'name' and 'lang' parameters are required",
+		})
+	}
+
+	limitNumber, err := strconv.Atoi(c.Query("limit", "10"))
+	if err != nil || limitNumber < 1 {
+		limitNumber = 10
+	}
+
+	skipNumber, err := strconv.Atoi(c.Query("skip", "0"))
+	if err != nil || skipNumber < 0 {
+		skipNumber = 0
+	}
+
+	translated := initializers.DB.Table("station_translations").
+		Select("station_id").
+		Where("name ILIKE ? AND language = ?", "%"+name+"%", lang)
+	query := initializers.DB.Model(&models.Stations{}).
+		Where("stations.name ILIKE ? OR stations.id IN (?)", "%"+name+"%", translated)
+	if city := c.Query("city"); city != "" {
+		query = query.Where("stations.city_id = ?", city)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to fetch total count from the database",
 		})
 	}
 
-	// Find the cities with names similar to the search query (case-insensitive)
 	var stations []models.Stations
-	if err := initializers.DB.Where("name ILIKE ?", "%"+name+"%").Find(&stations).Error; err != nil {
+	if err := query.
+		Preload("Translations", "language = ?", lang).
+		Order("stations.city_id, stations.line, stations.name, stations.id").
+		Offset(skipNumber).Limit(limitNumber).
+		Find(&stations).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"status":  "error",
-			"message": "Failed to fetch cities from database",
+			"message": "Failed to fetch stations from the database",
 		})
 	}
 
-	// Return the matched cities as a JSON response
 	return c.JSON(fiber.Map{
 		"status": "success",
 		"data":   stations,
+		"meta": fiber.Map{
+			"limit": limitNumber,
+			"skip":  skipNumber,
+			"total": total,
+		},
+	})
+}
+
+func CreateStation(c *fiber.Ctx) error {
+	var newStation models.Stations
+	if err := c.BodyParser(&newStation); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid request data",
+		})
+	}
+
+	if newStation.Name == "" || newStation.CityID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Name and CityID are required",
+		})
+	}
+	if err := utils.ValidateCoordinates(newStation.Latitude, newStation.Longitude); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	var city models.City
+	if err := initializers.DB.First(&city, newStation.CityID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "City not found",
+		})
+	}
+
+	newStation.Translations = nil
+	if err := initializers.DB.Create(&newStation).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to add the new station",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "New station added successfully",
+		"data":    newStation,
+	})
+}
+
+func UpdateStation(c *fiber.Ctx) error {
+	var station models.Stations
+	if err := initializers.DB.First(&station, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Station not found",
+		})
+	}
+
+	var updatedStation models.Stations
+	if err := c.BodyParser(&updatedStation); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid request data",
+		})
+	}
+
+	latitude, longitude := station.Latitude, station.Longitude
+	if updatedStation.Latitude != nil || updatedStation.Longitude != nil {
+		latitude, longitude = updatedStation.Latitude, updatedStation.Longitude
+	}
+	if err := utils.ValidateCoordinates(latitude, longitude); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	updatedStation.ID = 0
+	updatedStation.Translations = nil
+	if err := initializers.DB.Model(&station).Updates(&updatedStation).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update the station",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Station updated successfully",
+		"data":    station,
+	})
+}
+
+// DeleteStation deletes a station with its translations and its links to
+// blogs and profiles.
+func DeleteStation(c *fiber.Ctx) error {
+	var station models.Stations
+	if err := initializers.DB.First(&station, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Station not found",
+		})
+	}
+
+	for _, table := range []string{"blog_stations", "profiles_stations"} {
+		if err := initializers.DB.Exec("DELETE FROM "+table+" WHERE stations_id = ?", station.ID).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Failed to unlink the station",
+			})
+		}
+	}
+
+	if err := initializers.DB.Where("station_id = ?", station.ID).Delete(&models.StationTranslation{}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete station translations",
+		})
+	}
+
+	if err := initializers.DB.Delete(&station).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete the station",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Station and associated translations deleted successfully",
+		"data":    nil,
 	})
 }
+
+func CreateStationTranslation(c *fiber.Ctx) error {
+	var newTranslation models.StationTranslation
+	if err := c.BodyParser(&newTranslation); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid request data",
+		})
+	}
+
+	if newTranslation.StationID == 0 || newTranslation.Language == "" || newTranslation.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "StationID, Language and Name are required",
+		})
+	}
+
+	var station models.Stations
+	if err := initializers.DB.First(&station, newTranslation.StationID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Station not found",
+		})
+	}
+
+	// One translation per language, a second one replaces the first
+	var existing models.StationTranslation
+	if err := initializers.DB.Where("station_id = ? AND language = ?", station.ID, newTranslation.Language).First(&existing).Error; err == nil {
+		newTranslation.ID = existing.ID
+	}
+
+	if err := initializers.DB.Save(&newTranslation).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to add the new translation",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "New translation added successfully",
+		"data":    newTranslation,
+	})
+}
+
+func UpdateStationTranslation(c *fiber.Ctx) error {
+	translationID := c.Query("translationID")
+	if translationID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Translation ID is required",
+		})
+	}
+
+	var translation models.StationTranslation
+	if err := initializers.DB.First(&translation, translationID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Translation not found",
+		})
+	}
+
+	var updatedTranslation models.StationTranslation
+	if err := c.BodyParser(&updatedTranslation); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Invalid request data",
+		})
+	}
+
+	updatedTranslation.ID = 0
+	updatedTranslation.StationID = 0
+	updatedTranslation.Language = ""
+	if err := initializers.DB.Model(&translation).Updates(&updatedTranslation).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to update the translation",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Translation updated successfully",
+		"data":    translation,
+	})
+}
+
+func DeleteStationTranslation(c *fiber.Ctx) error {
+	translationID := c.Query("translationID")
+	if translationID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Translation ID is required",
+		})
+	}
+
+	var translation models.StationTranslation
+	if err := initializers.DB.First(&translation, translationID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Translation not found",
+		})
+	}
+
+	if err := initializers.DB.Delete(&translation).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Failed to delete the translation",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Translation deleted successfully",
+		"data":    nil,
+	})
+}
+
+// stationsJSON lists the stations linked to a blog, with their line.
+func stationsJSON(stations []models.Stations) []stationJSON {
+	res := make([]stationJSON, len(stations))
+	for i := range stations {
+		name, line := stationNames(&stations[i])
+		res[i] = stationJSON{
+			ID:        stations[i].ID,
+			Name:      name,
+			Line:      line,
+			Hex:       stations[i].Hex,
+			Latitude:  stations[i].Latitude,
+			Longitude: stations[i].Longitude,
+		}
+	}
+	return res
+}
+
+// stationNames returns the names of a station and its line in the language
+// of its preloaded translation, or the default ones.
+func stationNames(s *models.Stations) (string, string) {
+	name, line := s.Name, s.Line
+	if len(s.Translations) > 0 {
+		if s.Translations[0].Name != "" {
+			name = s.Translations[0].Name
+		}
+		if s.Translations[0].Line != "" {
+			line = s.Translations[0].Line
+		}
+	}
+	return name, line
+}
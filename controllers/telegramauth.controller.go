@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// TelegramAuth signs in with the Telegram Login Widget. The user owning the
+// Telegram ID is signed in; an unknown ID gets a new, already activated account.
+func TelegramAuth(c *fiber.Ctx) error {
+	var payload models.TelegramAuthInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	config, _ := initializers.LoadConfig(".")
+
+	fields := map[string]string{
+		"id":         strconv.FormatInt(payload.ID, 10),
+		"first_name": payload.FirstName,
+		"last_name":  payload.LastName,
+		"username":   payload.Username,
+		"photo_url":  payload.PhotoURL,
+		"auth_date":  strconv.FormatInt(payload.AuthDate, 10),
+	}
+
+	if err := utils.VerifyTelegramLogin(fields, payload.Hash, config.TELEGRAM_TOKEN, time.Now()); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+	if err := utils.MarkTelegramLoginUsed(payload.Hash); err == utils.ErrTelegramAuthUsed {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"status": "error", "message": "Something bad happened"})
+	}
+
+	var user models.User
+	err := initializers.DB.Where("tid = ?", payload.ID).First(&user).Error
+	if err == gorm.ErrRecordNotFound {
+		name := payload.Username
+		if name == "" {
+			name = strings.TrimSpace(payload.FirstName + " " + payload.LastName)
+		}
+
+		// Telegram does not share the email address, so the account gets a
+		// placeholder on a reserved domain until the user sets a real one.
+		email := fmt.Sprintf("tg%d@telegram.invalid", payload.ID)
+
+		newUser, err := registerExternalUser(name, email, "telegram", fields["id"])
+		if err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"status": "error", "message": "Something bad happened"})
+		}
+		user = *newUser
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Internal server error"})
+	}
+
+	if user.Banned {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": "Account is banned"})
+	}
+
+	user.Tid = payload.ID
+	user.TelegramActivated = true
+	if payload.Username != "" {
+		user.TelegramName = &payload.Username
+	}
+
+	if err := initializers.DB.Model(&user).Updates(map[string]interface{}{
+		"tid":                payload.ID,
+		"telegram_activated": true,
+		"telegram_name":      user.TelegramName,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Failed to link telegram account"})
+	}
+
+	return beginSignIn(c, &user, payload.Session)
+}
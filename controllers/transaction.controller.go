@@ -8,23 +8,51 @@ import (
 	"hyperpage/utils"
 )
 
+var transactionKeyset = utils.Keyset{Name: "transactions", Columns: []string{"created_at", "id"}, Desc: true}
+
 func GetTransactions(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.UserResponse)
 
-	// get the balance of the authenticated user
-	var transaction []models.Transaction
-
-	
-	err := utils.Paginate(c, initializers.DB.Where("user_id = ?", user.ID).Order("created_at DESC").First(&transaction), &transaction)
+	params, err := utils.ParsePageParams(c)
 	if err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"status":  "error",
-				"message": "Element not found",
-			})
-		}
-
-    return c.JSON(fiber.Map{
-        "status": "success",
-        "data":   transaction,
-    })
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	query := initializers.DB.Where("user_id = ?", user.ID)
+
+	var count int64
+	if err := query.Model(&models.Transaction{}).Count(&count).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
+	}
+
+	transactions, page, err := utils.FindPage(query, transactionKeyset, params, func(t *models.Transaction) []interface{} {
+		return []interface{}{t.CreatedAt, t.ID}
+	})
+	if err == utils.ErrCursorInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve data",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   transactions,
+		"meta": page.Meta(fiber.Map{
+			"total": count,
+			"limit": params.Limit,
+			"skip":  params.Skip,
+		}),
+	})
 }
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetBlogTranslationOverrides lists the author's translations of a blog.
+func GetBlogTranslationOverrides(c *fiber.Ctx) error {
+	blog, ok := translatableBlog(c)
+	if !ok {
+		return nil
+	}
+	return translationOverrides(c, models.TranslationEntityBlog, blog.ID)
+}
+
+// SetBlogTranslationOverride replaces the machine translation of a blog field
+// in one language.
+func SetBlogTranslationOverride(c *fiber.Ctx) error {
+	blog, ok := translatableBlog(c)
+	if !ok {
+		return nil
+	}
+	return setTranslationOverride(c, models.TranslationEntityBlog, blog.ID)
+}
+
+// DeleteBlogTranslationOverride goes back to the machine translation.
+func DeleteBlogTranslationOverride(c *fiber.Ctx) error {
+	blog, ok := translatableBlog(c)
+	if !ok {
+		return nil
+	}
+	return deleteTranslationOverride(c, models.TranslationEntityBlog, blog.ID)
+}
+
+// GetProfileTranslationOverrides lists the user's translations of their profile.
+func GetProfileTranslationOverrides(c *fiber.Ctx) error {
+	profile, ok := translatableProfile(c)
+	if !ok {
+		return nil
+	}
+	return translationOverrides(c, models.TranslationEntityProfile, profile.ID)
+}
+
+// SetProfileTranslationOverride replaces the machine translation of a profile
+// field in one language.
+func SetProfileTranslationOverride(c *fiber.Ctx) error {
+	profile, ok := translatableProfile(c)
+	if !ok {
+		return nil
+	}
+	return setTranslationOverride(c, models.TranslationEntityProfile, profile.ID)
+}
+
+// DeleteProfileTranslationOverride goes back to the machine translation.
+func DeleteProfileTranslationOverride(c *fiber.Ctx) error {
+	profile, ok := translatableProfile(c)
+	if !ok {
+		return nil
+	}
+	return deleteTranslationOverride(c, models.TranslationEntityProfile, profile.ID)
+}
+
+func translationOverrides(c *fiber.Ctx, entity string, id uint64) error {
+	var overrides []models.TranslationOverride
+	if err := initializers.DB.Where("entity = ? AND entity_id = ?", entity, id).Order("field, lang").Find(&overrides).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not retrieve translations",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   overrides,
+	})
+}
+
+func setTranslationOverride(c *fiber.Ctx, entity string, id uint64) error {
+	user := c.Locals("user").(models.UserResponse)
+
+	var payload *models.TranslationOverrideInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	override, err := utils.SetTranslationOverride(entity, id, payload, user.ID)
+	if err == utils.ErrTranslationField {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not save translation",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   override,
+	})
+}
+
+func deleteTranslationOverride(c *fiber.Ctx, entity string, id uint64) error {
+	err := utils.DeleteTranslationOverride(entity, id, c.Params("field"), c.Params("lang"))
+	if err == utils.ErrTranslationField {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Could not delete translation",
+		})
+	}
+
+	return c.JSON(fiber.Map{"status": "success"})
+}
+
+// translatableBlog loads the blog of the :id parameter and checks that the
+// user may edit it. On failure the response is already written.
+func translatableBlog(c *fiber.Ctx) (*models.Blog, bool) {
+	user := c.Locals("user").(models.UserResponse)
+
+	var blog models.Blog
+	if err := initializers.DB.Select("id", "user_id").First(&blog, "id = ?", c.Params("id")).Error; err != nil {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Element not found",
+		})
+		return nil, false
+	}
+
+	if !hasScopeAny(c) && blog.UserID != user.ID {
+		c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Unauthorized",
+		})
+		return nil, false
+	}
+
+	return &blog, true
+}
+
+func translatableProfile(c *fiber.Ctx) (*models.Profile, bool) {
+	user := c.Locals("user").(models.UserResponse)
+
+	var profile models.Profile
+	if err := initializers.DB.Select("id").First(&profile, "user_id = ?", user.ID).Error; err != nil {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Profile not found",
+		})
+		return nil, false
+	}
+
+	return &profile, true
+}
@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SetupTwoFactor generates a new TOTP secret for the current user. Two-factor
+// authentication stays disabled until EnableTwoFactor confirms a code.
+func SetupTwoFactor(c *fiber.Ctx) error {
+	userResp := c.Locals("user").(models.UserResponse)
+
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", userResp.ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "User not found"})
+	}
+
+	if user.TwoFactorEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "fail", "message": "Two-factor authentication is already enabled"})
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to generate secret"})
+	}
+
+	if err := initializers.DB.Model(&user).Update("two_factor_secret", secret).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to save secret"})
+	}
+
+	config, _ := initializers.LoadConfig(".")
+	issuer := config.TOTPIssuer
+	if issuer == "" {
+		issuer = "MYRUONLINE"
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data": fiber.Map{
+			"secret": secret,
+			"uri":    utils.TOTPProvisioningURI(secret, issuer, user.Email),
+		},
+	})
+}
+
+// EnableTwoFactor confirms the secret from SetupTwoFactor and returns the
+// recovery codes. They are only shown once.
+func EnableTwoFactor(c *fiber.Ctx) error {
+	userResp := c.Locals("user").(models.UserResponse)
+
+	var payload models.TwoFactorCodeInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", userResp.ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "User not found"})
+	}
+
+	if user.TwoFactorEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"status": "fail", "message": "Two-factor authentication is already enabled"})
+	}
+
+	if user.TwoFactorSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Two-factor setup was not started"})
+	}
+
+	if _, ok := utils.ValidateTOTP(user.TwoFactorSecret, payload.Code, time.Now()); !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": "Invalid two-factor code"})
+	}
+
+	codes, hashes, err := utils.GenerateRecoveryCodes()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to generate recovery codes"})
+	}
+
+	user.TwoFactorEnabled = true
+	user.TwoFactorRecoveryCodes = hashes
+	if err := initializers.DB.Save(&user).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to enable two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Two-factor authentication enabled",
+		"data":    fiber.Map{"recovery_codes": codes},
+	})
+}
+
+func DisableTwoFactor(c *fiber.Ctx) error {
+	userResp := c.Locals("user").(models.UserResponse)
+
+	var payload models.TwoFactorDisableInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", userResp.ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "User not found"})
+	}
+
+	if !user.TwoFactorEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Two-factor authentication is not enabled"})
+	}
+
+	if err := utils.VerifyPassword(user.Password, payload.Password); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": "Invalid password"})
+	}
+
+	ok, err := checkSecondFactor(&user, payload.Code)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": "Invalid two-factor code"})
+	}
+
+	if err := clearTwoFactor(&user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to disable two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after a valid TOTP code.
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userResp := c.Locals("user").(models.UserResponse)
+
+	var payload models.TwoFactorCodeInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", userResp.ID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "User not found"})
+	}
+
+	if !user.TwoFactorEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Two-factor authentication is not enabled"})
+	}
+
+	step, ok := utils.ValidateTOTP(user.TwoFactorSecret, payload.Code, time.Now())
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": "Invalid two-factor code"})
+	}
+	if err := utils.MarkTOTPStepUsed(user.ID.String(), step); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	codes, hashes, err := utils.GenerateRecoveryCodes()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to generate recovery codes"})
+	}
+
+	if err := initializers.DB.Model(&user).Update("two_factor_recovery_codes", models.RecoveryCodes(hashes)).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to save recovery codes"})
+	}
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"data":   fiber.Map{"recovery_codes": codes},
+	})
+}
+
+// VerifyTwoFactor is the second login step. It exchanges the mfa pending
+// token from SignInUser and a TOTP or recovery code for the normal tokens.
+func VerifyTwoFactor(c *fiber.Ctx) error {
+	var payload models.TwoFactorVerifyInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "message": "Invalid request body"})
+	}
+
+	if errors := models.ValidateStruct(payload); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "fail", "errors": errors})
+	}
+
+	pending, err := utils.GetMFAPending(payload.MFAToken)
+	if err == utils.ErrMFATokenInvalid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Internal server error"})
+	}
+
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", pending.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.DeleteMFAPending(payload.MFAToken)
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": "the user belonging to this token no longer exists"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "fail", "message": "Internal server error"})
+	}
+
+	ok, err := checkSecondFactor(&user, payload.Code)
+	if err == nil && !ok {
+		err = utils.RegisterMFAFailure(payload.MFAToken)
+		if err == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": "Invalid two-factor code"})
+		}
+	}
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+
+	utils.DeleteMFAPending(payload.MFAToken)
+
+	return completeSignIn(c, &user, pending.Session)
+}
+
+// AdminResetTwoFactor turns off two-factor authentication for a user who lost
+// their device and recovery codes, and signs them out everywhere.
+func AdminResetTwoFactor(c *fiber.Ctx) error {
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"status": "fail", "message": "User not found"})
+	}
+
+	if err := clearTwoFactor(&user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to reset two-factor authentication"})
+	}
+
+	if _, err := utils.RevokeAllSessions(user.ID.String(), ""); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"status": "error", "message": "Failed to revoke sessions"})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Two-factor authentication reset"})
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code. A matching recovery code is consumed.
+func checkSecondFactor(user *models.User, code string) (bool, error) {
+	if step, ok := utils.ValidateTOTP(user.TwoFactorSecret, code, time.Now()); ok {
+		if err := utils.MarkTOTPStepUsed(user.ID.String(), step); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	return consumeRecoveryCode(user, utils.HashRecoveryCode(code))
+}
+
+// consumeRecoveryCode removes the recovery code with hash from the user. The
+// user row is locked while the codes are rewritten, so two requests racing
+// with the same code cannot both use it.
+func consumeRecoveryCode(user *models.User, hash string) (bool, error) {
+	consumed := false
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var locked models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "two_factor_recovery_codes").
+			First(&locked, "id = ?", user.ID).Error; err != nil {
+			return err
+		}
+
+		for i, stored := range locked.TwoFactorRecoveryCodes {
+			if stored != hash {
+				continue
+			}
+
+			remaining := make(models.RecoveryCodes, 0, len(locked.TwoFactorRecoveryCodes)-1)
+			remaining = append(remaining, locked.TwoFactorRecoveryCodes[:i]...)
+			remaining = append(remaining, locked.TwoFactorRecoveryCodes[i+1:]...)
+
+			result := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("two_factor_recovery_codes", remaining)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 1 {
+				consumed = true
+				user.TwoFactorRecoveryCodes = remaining
+			}
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return consumed, nil
+}
+
+func clearTwoFactor(user *models.User) error {
+	user.TwoFactorEnabled = false
+	user.TwoFactorSecret = ""
+	user.TwoFactorRecoveryCodes = models.RecoveryCodes{}
+
+	return initializers.DB.Model(user).Updates(map[string]interface{}{
+		"two_factor_enabled":        false,
+		"two_factor_secret":         "",
+		"two_factor_recovery_codes": user.TwoFactorRecoveryCodes,
+	}).Error
+}
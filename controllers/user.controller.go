@@ -431,7 +431,14 @@ func GetMe(c *fiber.Ctx) error {
 	// }
 	// fmt.Println(user)
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": fiber.Map{"user": user, "balance": balance, "storage": roundedSize}})
+	// Profile coordinates are left out of every other response
+	location := fiber.Map{}
+	if len(user.Profile) > 0 {
+		location["latitude"] = user.Profile[0].Latitude
+		location["longitude"] = user.Profile[0].Longitude
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "success", "data": fiber.Map{"user": user, "balance": balance, "storage": roundedSize, "location": location}})
 
 }
 
@@ -470,102 +477,22 @@ func deleteDirectory(directoryName string) error {
 	return nil
 }
 
-// Define the route for deleting a user and its relations
+// DeleteUserWithRelations schedules the account for deletion. It is purged
+// after utils.AccountDeletionGracePeriod unless the user signs in again.
 func DeleteUserWithRelations(c *fiber.Ctx) error {
 	userId := c.Locals("user").(models.UserResponse)
 
-	// Fetch the user from the database
-	var user models.User
-	if err := initializers.DB.
-		Preload("Billing").
-		Preload("Profile").
-		Preload("Blogs").
-		First(&user, "id = ?", userId.ID).Error; err != nil {
-		// Handle the error (e.g., user not found)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
-	}
-	// Begin a database transaction
-	tx := initializers.DB.Begin()
-
-	var profileID string
-	if err := initializers.DB.Model(&models.Profile{}).Where("user_id = ?", userId.ID).Select("id").Row().Scan(&profileID); err != nil {
-		// Handle the error (e.g., profile not found)
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User's profile not found"})
-	}
-
-	// Fetch the paths for profile_photos to be deleted
-	var files []string
-	if err := initializers.DB.Table("profile_photos").Where("profile_id = ?", profileID).Pluck("files", &files).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve profile photo paths"})
-	}
-
-	// Delete the directories on the server
-	for _, path := range files {
-		directoryName := extractDirectoryName(path)
-		if directoryName != "" {
-			err := deleteDirectory(directoryName)
-			if err != nil {
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete directories on the server"})
-			}
-		}
-	}
-	// Delete related entities using the profileID and user.ID before deleting the user
-	relatedEntities := []string{
-		"profiles_guilds",
-		"profiles_city",
-		"profiles_hashtags",
-		"profile_photos",
-		"billings",
-		"online_storages",
-		"transactions",
-		"blogs",
-		"user_relation",
-		"votes",
-		"codes",
-		"domains",
-		"payments",
-	}
-	for _, table := range relatedEntities {
-		whereColumn := "user_id"
-		id := user.ID.String()
-		if table == "profiles_guilds" || table == "profiles_city" || table == "profiles_hashtags" || table == "profile_photos" {
-			whereColumn = "profile_id"
-			id = profileID
-		}
-
-		if err := tx.Exec("DELETE FROM "+table+" WHERE "+whereColumn+" = ?", id).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete related entities from " + table})
-		}
-
-		if table == "user_relation" {
-			whereColumn = "following_id"
-			if err := tx.Exec("DELETE FROM "+table+" WHERE "+whereColumn+" = ?", id).Error; err != nil {
-				tx.Rollback()
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete related entities from " + table})
-			}
-		}
-	}
-
-	// Delete the associated profiles records
-	if err := tx.Delete(&user.Profile).Error; err != nil {
-		// Rollback the transaction if an error occurs
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete user's profiles"})
-	}
-
-	// Delete the user and its related records
-	if err := tx.Delete(&user).Error; err != nil {
-		// Rollback the transaction if an error occurs
-		tx.Rollback()
+	purgeAt, err := utils.ScheduleAccountDeletion(userId.ID)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete user"})
 	}
 
-	// Commit the transaction
-	tx.Commit()
+	c.ClearCookie("access_token")
 
-	// Return a success response
-	return c.JSON(fiber.Map{"message": "User and related profiles deleted successfully"})
+	return c.JSON(fiber.Map{
+		"message": "Account scheduled for deletion, sign in before the purge date to restore it",
+		"purgeAt": purgeAt,
+	})
 }
 
 // Function to delete all user accounts where IsBot is true, along with their related records
@@ -610,6 +537,7 @@ func DeleteAllBotUsersWithRelations(c *fiber.Ctx) error {
 		relatedEntities := []string{
 			"profiles_guilds",
 			"profiles_city",
+			"profiles_stations",
 			"profiles_hashtags",
 			"profile_photos",
 			"billings",
@@ -625,7 +553,7 @@ func DeleteAllBotUsersWithRelations(c *fiber.Ctx) error {
 		for _, table := range relatedEntities {
 			whereColumn := "user_id"
 			id := user.ID.String()
-			if table == "profiles_guilds" || table == "profiles_city" || table == "profiles_hashtags" || table == "profile_photos" {
+			if table == "profiles_guilds" || table == "profiles_city" || table == "profiles_stations" || table == "profiles_hashtags" || table == "profile_photos" {
 				whereColumn = "profile_id"
 				id = profileID
 			}
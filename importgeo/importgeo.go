@@ -0,0 +1,159 @@
+// Command importgeo sets the coordinates of cities from a GeoNames dump
+// (allCountries.txt, cities500.txt or a country file, tab separated). A city
+// is matched by its country code and one of its translated names against
+// the populated places of the dump, the most populous one winning.
+//
+//	go run ./importgeo -file cities500.txt [-overwrite]
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Columns of the GeoNames "geoname" table.
+const (
+	geoNameColumn           = 1
+	geoASCIINameColumn      = 2
+	geoAlternateNamesColumn = 3
+	geoLatitudeColumn       = 4
+	geoLongitudeColumn      = 5
+	geoFeatureClassColumn   = 6
+	geoCountryCodeColumn    = 8
+	geoPopulationColumn     = 14
+	geoColumns              = 15
+)
+
+type geoPlace struct {
+	Latitude   float64
+	Longitude  float64
+	Population int64
+}
+
+func init() {
+	config, err := initializers.LoadConfig(".")
+	if err != nil {
+		log.Fatal("? Could not load environment variables", err)
+	}
+
+	initializers.ConnectDB(&config)
+}
+
+func main() {
+	file := flag.String("file", "", "GeoNames dump to import")
+	overwrite := flag.Bool("overwrite", false, "replace coordinates that are already set")
+	flag.Parse()
+
+	if *file == "" {
+		log.Fatal("? -file is required")
+	}
+
+	var cities []models.City
+	if err := initializers.DB.Preload("Translations").Find(&cities).Error; err != nil {
+		log.Fatal("? Could not load cities: ", err)
+	}
+
+	// The names wanted per country, so only those places are kept in memory
+	wanted := map[string]bool{}
+	for _, city := range cities {
+		for _, translation := range city.Translations {
+			wanted[geoKey(city.CountryCode, translation.Name)] = true
+		}
+	}
+
+	places, err := readGeoPlaces(*file, wanted)
+	if err != nil {
+		log.Fatal("? Could not read ", *file, ": ", err)
+	}
+
+	var updated, skipped, unmatched int
+	for _, city := range cities {
+		if city.Latitude != nil && city.Longitude != nil && !*overwrite {
+			skipped++
+			continue
+		}
+
+		var best *geoPlace
+		for _, translation := range city.Translations {
+			if place, ok := places[geoKey(city.CountryCode, translation.Name)]; ok {
+				if best == nil || place.Population > best.Population {
+					best = place
+				}
+			}
+		}
+		if best == nil {
+			unmatched++
+			log.Printf("No coordinates for city %d (%s)", city.ID, city.CountryCode)
+			continue
+		}
+
+		if err := initializers.DB.Model(&models.City{}).Where("id = ?", city.ID).Updates(map[string]interface{}{
+			"latitude":  best.Latitude,
+			"longitude": best.Longitude,
+		}).Error; err != nil {
+			log.Fatal("? Could not update city ", city.ID, ": ", err)
+		}
+		updated++
+	}
+
+	fmt.Printf("? Cities updated: %d, already set: %d, not found: %d\n", updated, skipped, unmatched)
+}
+
+// readGeoPlaces streams the dump and keeps, for every wanted key, the most
+// populous populated place (feature class P) carrying that name.
+func readGeoPlaces(path string, wanted map[string]bool) (map[string]*geoPlace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	places := map[string]*geoPlace{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < geoColumns || fields[geoFeatureClassColumn] != "P" {
+			continue
+		}
+
+		lat, err := strconv.ParseFloat(fields[geoLatitudeColumn], 64)
+		if err != nil {
+			continue
+		}
+		lng, err := strconv.ParseFloat(fields[geoLongitudeColumn], 64)
+		if err != nil {
+			continue
+		}
+		population, _ := strconv.ParseInt(fields[geoPopulationColumn], 10, 64)
+		place := &geoPlace{Latitude: lat, Longitude: lng, Population: population}
+
+		names := []string{fields[geoNameColumn], fields[geoASCIINameColumn]}
+		if fields[geoAlternateNamesColumn] != "" {
+			names = append(names, strings.Split(fields[geoAlternateNamesColumn], ",")...)
+		}
+		seen := map[string]bool{}
+		for _, name := range names {
+			key := geoKey(fields[geoCountryCodeColumn], name)
+			if seen[key] || !wanted[key] {
+				continue
+			}
+			seen[key] = true
+			if current, ok := places[key]; !ok || population > current.Population {
+				places[key] = place
+			}
+		}
+	}
+	return places, scanner.Err()
+}
+
+func geoKey(countryCode, name string) string {
+	return strings.ToUpper(strings.TrimSpace(countryCode)) + "|" + strings.ToLower(strings.TrimSpace(name))
+}
@@ -22,6 +22,10 @@ func ConnectDB(config *Config) {
 		os.Exit(1)
 	}
 
+	if err := models.RegisterTranslationCallbacks(DB); err != nil {
+		log.Fatal("Failed to register the translation callbacks! \n", err.Error())
+	}
+
 	DB.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"")
 	// DB.Logger = logger.Default.LogMode(logger.Info)
 
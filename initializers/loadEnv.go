@@ -7,7 +7,8 @@ import (
 )
 
 type Config struct {
-	IMGStorePath string `mapstructure:"IMG_STORE_PATH"`
+	IMGStorePath    string `mapstructure:"IMG_STORE_PATH"`
+	ExportStorePath string `mapstructure:"EXPORT_STORE_PATH"`
 
 	DBHost           string `mapstructure:"POSTGRES_HOST"`
 	DBUserName       string `mapstructure:"POSTGRES_USER"`
@@ -19,10 +20,11 @@ type Config struct {
 	TELEGRAM_CHANNEL int    `mapsstructure:"TELEGRAM_CHANNEL"`
 	SERVER_URL       string `mapsstructure:"SERVER_URL"`
 
-	ClientOrigin string `mapstructure:"CLIENT_ORIGIN"`
-	RedisUri     string `mapstructure:"REDIS_URL"`
-	Amqpurl      string `mapstructure:"AMQP_URL"`
-	RabbitMQUri  string `mapstructure:"RABBITMQ_URL"`
+	ClientOrigin   string `mapstructure:"CLIENT_ORIGIN"`
+	RedisUri       string `mapstructure:"REDIS_URL"`
+	Amqpurl        string `mapstructure:"AMQP_URL"`
+	RabbitMQUri    string `mapstructure:"RABBITMQ_URL"`
+	TrustedProxies string `mapstructure:"TRUSTED_PROXIES"`
 
 	AccessTokenPrivateKey  string        `mapstructure:"ACCESS_TOKEN_PRIVATE_KEY"`
 	AccessTokenPublicKey   string        `mapstructure:"ACCESS_TOKEN_PUBLIC_KEY"`
@@ -33,6 +35,24 @@ type Config struct {
 	AccessTokenMaxAge      int           `mapstructure:"ACCESS_TOKEN_MAXAGE"`
 	RefreshTokenMaxAge     int           `mapstructure:"REFRESH_TOKEN_MAXAGE"`
 
+	TOTPIssuer string `mapstructure:"TOTP_ISSUER"`
+
+	OIDCIssuer       string `mapstructure:"OIDC_ISSUER"`
+	OIDCClientID     string `mapstructure:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string `mapstructure:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL  string `mapstructure:"OIDC_REDIRECT_URL"`
+	OIDCScopes       string `mapstructure:"OIDC_SCOPES"`
+
+	TokenSecret string `mapstructure:"TOKEN_SECRET"`
+
+	ModerationEnabled   bool `mapstructure:"MODERATION_ENABLED"`
+	ReportHideThreshold int  `mapstructure:"REPORT_HIDE_THRESHOLD"`
+
+	Translator string `mapstructure:"TRANSLATOR"`
+
+	BaseCurrency      string `mapstructure:"BASE_CURRENCY"`
+	CurrencyRatesFile string `mapstructure:"CURRENCY_RATES_FILE"`
+
 	EmailFrom string `mapstructure:"EMAIL_FROM"`
 	SMTPHost  string `mapstructure:"SMTP_HOST"`
 	SMTPPass  string `mapstructure:"SMTP_PASS"`
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CheckAPIKey authenticates the X-API-Key header and requires scope.
+func CheckAPIKey(scope string) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		presented := c.Get("X-API-Key")
+		if presented == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": "API key is required"})
+		}
+
+		now := time.Now()
+		key, err := utils.AuthenticateAPIKey(presented, scope, now)
+		if err == utils.ErrAPIKeyScope {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": "API key is missing the " + scope + " scope"})
+		} else if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+		}
+
+		initializers.DB.Model(key).UpdateColumn("last_used_at", now)
+
+		c.Locals("api_key", models.FilterAPIKeyRecord(key))
+
+		return c.Next()
+	}
+}
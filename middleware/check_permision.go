@@ -1,45 +1,93 @@
 package middleware
 
-// import (
-// 	"fmt"
-// 	"hyperpage/models"
-
-// 	"github.com/gofiber/fiber/v2"
-// )
-
-// type PermissionMiddleware struct {
-// 	Action     string
-// 	Resource   string
-// 	Permission string
-// }
-
-// func CheckPermission(permission PermissionMiddleware) func(c *fiber.Ctx) error {
-// 	return func(c *fiber.Ctx) error {
-// 		user := c.Locals("user")
-// 		if user == nil {
-// 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Unauthorized"})
-// 		}
-// 		if user != nil {
-//             userResp := user.(models.UserResponse)
-//             userObj := models.User{
-//                 Role:     userResp.Role,
-//             }
-// 			// Extract user's role
-// 			role := userObj.Role
-
-// 			// Check if the role has the required permission
-// 			if hasPermission(role, permission.Action, permission.Resource, permission.Permission) {
-// 				return c.Next()
-// 			}
-// 		}
-
-// 		// If user does not have the required permission, return an error message or redirect to an appropriate page
-// 		return c.SendStatus(fiber.StatusForbidden)
-// 	}
-// }
-
-// func hasPermission(role models.Role, action string, resource string, permission string) bool {
-// 	// Check if role has the required permission for the given action and resource
-// 	// You can implement your own logic here, such as using a database or a map to store permissions
-// 	return true
-// }
\ No newline at end of file
+import (
+	"hyperpage/initializers"
+	"hyperpage/models"
+	"hyperpage/utils"
+
+	"github.com/gofiber/fiber/v2"
+	uuid "github.com/satori/go.uuid"
+)
+
+// OwnerResolver returns the owner of the record addressed by the request.
+// found is false when the request does not address a record or it does not
+// exist; the handler reports that case itself.
+type OwnerResolver func(c *fiber.Ctx) (owner uuid.UUID, found bool)
+
+// ownerResolvers enforce scope "own" for resources addressed by :id: a blog,
+// and a profile document for the profile routes. The other resources whose
+// routes take an :id (lang, city, station, guild, apikey, report, ...) have
+// no owner, so CheckPermission refuses scope "own" on those routes. Routes
+// without :id, such as the blog lists, leave "own" to the handler through
+// Locals("permission_scope").
+var ownerResolvers = map[string]OwnerResolver{
+	"blog": func(c *fiber.Ctx) (uuid.UUID, bool) {
+		id := c.Params("id")
+		if id == "" {
+			return uuid.Nil, false
+		}
+		var blog models.Blog
+		if err := initializers.DB.Select("user_id").Where("id = ?", id).First(&blog).Error; err != nil {
+			return uuid.Nil, false
+		}
+		return blog.UserID, true
+	},
+	"profile": func(c *fiber.Ctx) (uuid.UUID, bool) {
+		id := c.Params("id")
+		if id == "" {
+			return uuid.Nil, false
+		}
+		var owner struct{ UserID uuid.UUID }
+		if err := initializers.DB.Model(&models.ProfileDocuments{}).
+			Select("profiles.user_id").
+			Joins("JOIN profiles ON profiles.id = profile_documents.profile_id").
+			Where("profile_documents.id = ?", id).
+			Take(&owner).Error; err != nil {
+			return uuid.Nil, false
+		}
+		return owner.UserID, true
+	},
+}
+
+var permissionScope = utils.PermissionScope
+
+// CheckPermission allows the request when the user's role holds action on
+// resource. With scope "own" a record addressed by the route must belong to
+// the user. The granted scope is stored in Locals("permission_scope").
+func CheckPermission(resource, action string) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		user, ok := c.Locals("user").(models.UserResponse)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "You must be logged in to access this resource"})
+		}
+
+		scope, granted, err := permissionScope(user.Role, resource, action)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Failed to check permissions"})
+		}
+		if !granted {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "You are not authorized to access this resource",
+			})
+		}
+
+		if scope == models.PermissionScopeOwn {
+			resolve, ok := ownerResolvers[resource]
+			if !ok && c.Params("id") != "" {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"message": "You are not authorized to access this resource",
+				})
+			}
+			if ok {
+				if owner, found := resolve(c); found && owner != user.ID {
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+						"message": "You are not authorized to access this resource",
+					})
+				}
+			}
+		}
+
+		c.Locals("permission_scope", scope)
+		return c.Next()
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"hyperpage/models"
+
+	"github.com/gofiber/fiber/v2"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestCheckPermission(t *testing.T) {
+	owner := uuid.NewV4()
+	other := uuid.NewV4()
+
+	previousScope := permissionScope
+	previousResolver := ownerResolvers["blog"]
+	t.Cleanup(func() {
+		permissionScope = previousScope
+		ownerResolvers["blog"] = previousResolver
+	})
+	ownerResolvers["blog"] = func(c *fiber.Ctx) (uuid.UUID, bool) {
+		switch c.Params("id") {
+		case "1":
+			return owner, true
+		case "2":
+			return other, true
+		}
+		return uuid.Nil, false
+	}
+
+	tests := []struct {
+		name     string
+		user     *models.UserResponse
+		scope    string
+		granted  bool
+		err      error
+		resource string
+		path     string
+		want     int
+	}{
+		{name: "signed out", resource: "blog", path: "/blog", want: fiber.StatusUnauthorized},
+		{name: "not granted", user: &models.UserResponse{ID: owner}, resource: "blog", path: "/blog", want: fiber.StatusForbidden},
+		{name: "lookup failed", user: &models.UserResponse{ID: owner}, err: errors.New("redis down"), resource: "blog", path: "/blog", want: fiber.StatusInternalServerError},
+		{name: "any", user: &models.UserResponse{ID: owner}, scope: "any", granted: true, resource: "blog", path: "/blog/2", want: fiber.StatusOK},
+		{name: "own record", user: &models.UserResponse{ID: owner}, scope: "own", granted: true, resource: "blog", path: "/blog/1", want: fiber.StatusOK},
+		{name: "record of another user", user: &models.UserResponse{ID: owner}, scope: "own", granted: true, resource: "blog", path: "/blog/2", want: fiber.StatusForbidden},
+		{name: "missing record", user: &models.UserResponse{ID: owner}, scope: "own", granted: true, resource: "blog", path: "/blog/3", want: fiber.StatusOK},
+		{name: "own list", user: &models.UserResponse{ID: owner}, scope: "own", granted: true, resource: "blog", path: "/blog", want: fiber.StatusOK},
+		{name: "own without resolver", user: &models.UserResponse{ID: owner}, scope: "own", granted: true, resource: "city", path: "/city/1", want: fiber.StatusForbidden},
+		{name: "own without record", user: &models.UserResponse{ID: owner}, scope: "own", granted: true, resource: "chat", path: "/chat", want: fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			permissionScope = func(role, resource, action string) (string, bool, error) {
+				return tt.scope, tt.granted, tt.err
+			}
+
+			app := fiber.New()
+			setUser := func(c *fiber.Ctx) error {
+				if tt.user != nil {
+					c.Locals("user", *tt.user)
+				}
+				return c.Next()
+			}
+			handler := func(c *fiber.Ctx) error {
+				if c.Locals("permission_scope") != tt.scope {
+					t.Errorf("permission_scope = %v, want %q", c.Locals("permission_scope"), tt.scope)
+				}
+				return c.SendStatus(fiber.StatusOK)
+			}
+			check := CheckPermission(tt.resource, "update")
+			app.Get("/"+tt.resource, setUser, check, handler)
+			app.Get("/"+tt.resource+"/:id", setUser, check, handler)
+
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
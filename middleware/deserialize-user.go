@@ -39,6 +39,14 @@ func DeserializeUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": err.Error()})
 	}
 
+	active, err := utils.IsSessionActive(tokenClaims.SessionID)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"status": "fail", "message": err.Error()})
+	}
+	if !active {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"status": "fail", "message": "Token has been revoked"})
+	}
+
 	var user models.User
 	err = initializers.DB.Preload("Followings").
 		Preload("Followers").
@@ -54,6 +62,7 @@ func DeserializeUser(c *fiber.Ctx) error {
 
 	c.Locals("user", models.FilterUserRecord(&user, language))
 	c.Locals("access_token_uuid", tokenClaims.TokenUuid)
+	c.Locals("session_id", tokenClaims.SessionID)
 
 	return c.Next()
 }
@@ -22,6 +22,7 @@ func init() {
 	}
 
 	initializers.ConnectDB(&config)
+	initializers.ConnectRedis(&config)
 }
 
 func main() {
@@ -62,6 +63,12 @@ func main() {
 	if err := initializers.DB.AutoMigrate(&models.CityTranslation{}); err != nil {
 		panic(err)
 	}
+	if err := initializers.DB.AutoMigrate(&models.Stations{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.StationTranslation{}); err != nil {
+		panic(err)
+	}
 	if err := initializers.DB.AutoMigrate(&models.Payments{}); err != nil {
 		panic(err)
 	}
@@ -122,6 +129,62 @@ func main() {
 	if err := initializers.DB.AutoMigrate(&models.Streaming{}); err != nil {
 		panic(err)
 	}
+	if err := initializers.DB.AutoMigrate(&models.APIKey{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.AccessRole{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.Permission{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.RolePermission{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.DataExport{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.AccountDeletionLog{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.BlogRevision{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.Report{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.TranslationOverride{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.ContentTranslation{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.SavedSearchMatch{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.BlogHourlyStat{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.BlogDailyStat{}); err != nil {
+		panic(err)
+	}
+	if err := initializers.DB.AutoMigrate(&models.CurrencyRate{}); err != nil {
+		panic(err)
+	}
+
+	if err := utils.MigrateTranslations(); err != nil {
+		panic(err)
+	}
+
+	if err := utils.MigrateBlogSearch(); err != nil {
+		panic(err)
+	}
+	if err := utils.MigrateBlogCurrency(); err != nil {
+		panic(err)
+	}
+	if err := utils.SeedPermissions(); err != nil {
+		panic(err)
+	}
 
 	// Check if there are any users in the database
 	var userCount int64
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// BlogStatusPendingDeletion hides active blogs of an account scheduled for
+// deletion until it is restored or purged.
+const BlogStatusPendingDeletion = "PENDING_DELETION"
+
+// AccountDeletionLog is the audit record of a purged account. It keeps no
+// personal data besides the user ID.
+type AccountDeletionLog struct {
+	ID          uint64    `gorm:"primaryKey" json:"id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
+	RequestedAt time.Time `gorm:"not null" json:"requestedAt"`
+	PurgedAt    time.Time `gorm:"not null" json:"purgedAt"`
+	Status      string    `gorm:"type:varchar(20);not null" json:"status"`
+	Error       string    `json:"error,omitempty"`
+}
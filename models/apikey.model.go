@@ -0,0 +1,77 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Scopes an API key can be granted.
+const (
+	ScopeBotsWrite  = "bots:write"
+	ScopeBotsDelete = "bots:delete"
+)
+
+var APIKeyScopes = []string{ScopeBotsWrite, ScopeBotsDelete}
+
+// APIKey is a service credential for automation. Only the SHA-256 hash of
+// the key is stored; Prefix is the public part used to look it up.
+type APIKey struct {
+	ID         uint64     `gorm:"primaryKey"`
+	Name       string     `gorm:"not null"`
+	Prefix     string     `gorm:"type:varchar(32);uniqueIndex;not null"`
+	KeyHash    string     `gorm:"type:varchar(64);not null" json:"-"`
+	Scopes     string     `gorm:"not null"`
+	CreatedBy  uuid.UUID  `gorm:"type:uuid;not null"`
+	ExpiresAt  *time.Time `gorm:"index"`
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time `gorm:"index"`
+	CreatedAt  time.Time  `gorm:"not null"`
+	UpdatedAt  time.Time  `gorm:"not null"`
+}
+
+type APIKeyResponse struct {
+	ID         uint64     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  uuid.UUID  `json:"createdBy"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type CreateAPIKeyInput struct {
+	Name          string   `json:"name" validate:"required,min=3,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=bots:write bots:delete"`
+	ExpiresInDays int      `json:"expiresInDays" validate:"min=0,max=3650"`
+}
+
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func FilterAPIKeyRecord(key *APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.ScopeList(),
+		CreatedBy:  key.CreatedBy,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
@@ -9,66 +9,82 @@ import (
 )
 
 type Blog struct {
-	ID               uint64         `gorm:"primaryKey"`
-	Title            string         `gorm:"not null"`
-	Votes            []Vote         `gorm:"foreignKey:BlogID"`
-	MultilangTitle   MultilangTitle `gorm:"embedded;embeddedPrefix:multilang_title_"`
-	Descr            string         `gorm:"not null"`
-	MultilangDescr   MultilangTitle `gorm:"embedded;embeddedPrefix:multilang_descr_"`
-	Slug             string         `gorm:"not null"`
-	Content          string         `gorm:"null"`
-	MultilangContent MultilangTitle `gorm:"embedded;embeddedPrefix:multilang_content_"`
-	Status           string         `gorm:"not null"`
-	Lang             string         `gorm:"not null;default:en"`
-	Sticker          string         `gorm:"not null;default:standart"`
-	City             []City         `gorm:"many2many:blog_city;"`
-	Catygory         []Guilds       `gorm:"many2many:blog_guilds;"`
-	UniqId           string         `gorm:"not null;default:0"`
-	Days             int            `gorm:"not null;default:3"`
-	Views            int            `gorm:"not null;default:0"`
-	Total            float64        `gorm:"null"`
-	TmId             float64        `gorm:"not null;default:0"`
-	Photos           []BlogPhoto    `json:"photos"`
-	NotAds           bool           `gorm:"not null;default:true"`
-	User             User           `gorm:"foreignKey:UserID"`
-	UserAvatar       string         `gorm:"not null"`
-	Pined            bool           `gorm:"not null;default:false"`
-	UserID           uuid.UUID      `gorm:"type:uuid;not null"`
-	CreatedAt        time.Time      `gorm:"not null"`
-	UpdatedAt        time.Time      `gorm:"not null"`
-	DeletedAt        *time.Time     `gorm:"index"`
-	ExpiredAt        *time.Time     `gorm:"index"`
-	Hashtags         []Hashtags     `gorm:"many2many:blog_hashtags;"`
+	ID               uint64      `gorm:"primaryKey"`
+	Title            string      `gorm:"not null"`
+	Votes            []Vote      `gorm:"foreignKey:BlogID"`
+	MultilangTitle   Multilang   `gorm:"-"`
+	Descr            string      `gorm:"not null"`
+	MultilangDescr   Multilang   `gorm:"-"`
+	Slug             string      `gorm:"not null"`
+	Content          string      `gorm:"null"`
+	MultilangContent Multilang   `gorm:"-"`
+	Status           string      `gorm:"not null"`
+	Lang             string      `gorm:"not null;default:en"`
+	Sticker          string      `gorm:"not null;default:standart"`
+	City             []City      `gorm:"many2many:blog_city;"`
+	Stations         []Stations  `gorm:"many2many:blog_stations;" json:"stations"`
+	Catygory         []Guilds    `gorm:"many2many:blog_guilds;"`
+	UniqId           string      `gorm:"not null;default:0"`
+	Days             int         `gorm:"not null;default:3"`
+	Views            int         `gorm:"not null;default:0"`
+	Total            float64     `gorm:"null"`
+	Currency         string      `gorm:"size:3;not null;default:''" json:"currency"`
+	TmId             float64     `gorm:"not null;default:0"`
+	Photos           []BlogPhoto `json:"photos"`
+	NotAds           bool        `gorm:"not null;default:true"`
+	User             User        `gorm:"foreignKey:UserID"`
+	UserAvatar       string      `gorm:"not null"`
+	Pined            bool        `gorm:"not null;default:false"`
+	UserID           uuid.UUID   `gorm:"type:uuid;not null"`
+	CreatedAt        time.Time   `gorm:"not null"`
+	UpdatedAt        time.Time   `gorm:"not null"`
+	DeletedAt        *time.Time  `gorm:"index"`
+	ExpiredAt        *time.Time  `gorm:"index"`
+	PublishAt        *time.Time  `gorm:"index" json:"publish_at"`
+	UnpublishAt      *time.Time  `gorm:"index" json:"unpublish_at"`
+	RejectionReason  string      `gorm:"null" json:"rejection_reason"`
+	ReviewedAt       *time.Time  `gorm:"null" json:"reviewed_at"`
+	ReviewedBy       *uuid.UUID  `gorm:"type:uuid;null" json:"reviewed_by"`
+	Hashtags         []Hashtags  `gorm:"many2many:blog_hashtags;"`
+	Latitude         *float64    `gorm:"null" json:"latitude"`
+	Longitude        *float64    `gorm:"null" json:"longitude"`
 }
 
+// A blog created with a future publish_at waits in BlogStatusScheduled
+// until the scheduler activates it. Cancelled ones are kept for the owner.
+const (
+	BlogStatusScheduled = "SCHEDULED"
+	BlogStatusCancelled = "CANCELLED"
+)
+
 type BlogResponse struct {
-	ID               uint64         `json:"id"`
-	Title            string         `json:"title"`
-	Votes            []Vote         `json:"votes" gorm:"foreignKey:BlogID"`
-	MultilangTitle   MultilangTitle `json:"multilangtitle"`
-	MultilangDescr   MultilangTitle `json:"multilangdescr"`
-	MultilangContent MultilangTitle `json:"multilangcontent"`
-	Catygory         []string       `json:"catygory"`
-	Days             int            `json:"days"`
-	Views            int            `json:"views"`
-	Descr            string         `json:"descr"`
-	Slug             string         `json:"slug"`
-	Content          string         `json:"content"`
-	Status           string         `json:"status"`
-	UniqId           string         `json:"uniqId"`
-	Lang             string         `json:"lang"`
-	City             []string       `json:"city"`
-	Sticker          string         `json:"sticker"`
-	Total            float64        `json:"total"`
-	Pined            bool           `json:"pined"`
-	UserID           uuid.UUID      `json:"userId"`
-	TmId             float64        `gorm:"tId"`
-	CreatedAt        time.Time      `json:"createdAt"`
-	UpdatedAt        time.Time      `json:"updatedAt"`
-	DeletedAt        *time.Time     `json:"deletedAt"`
-	ExpiredAt        *time.Time     `json:"expiredAt"`
-	Photos           []BlogPhoto    `json:"photos"`
-	User             UserResponse   `json:"user"`
+	ID               uint64       `json:"id"`
+	Title            string       `json:"title"`
+	Votes            []Vote       `json:"votes" gorm:"foreignKey:BlogID"`
+	MultilangTitle   Multilang    `json:"multilangtitle"`
+	MultilangDescr   Multilang    `json:"multilangdescr"`
+	MultilangContent Multilang    `json:"multilangcontent"`
+	Catygory         []string     `json:"catygory"`
+	Days             int          `json:"days"`
+	Views            int          `json:"views"`
+	Descr            string       `json:"descr"`
+	Slug             string       `json:"slug"`
+	Content          string       `json:"content"`
+	Status           string       `json:"status"`
+	UniqId           string       `json:"uniqId"`
+	Lang             string       `json:"lang"`
+	City             []string     `json:"city"`
+	Sticker          string       `json:"sticker"`
+	Total            float64      `json:"total"`
+	Pined            bool         `json:"pined"`
+	UserID           uuid.UUID    `json:"userId"`
+	TmId             float64      `gorm:"tId"`
+	CreatedAt        time.Time    `json:"createdAt"`
+	UpdatedAt        time.Time    `json:"updatedAt"`
+	DeletedAt        *time.Time   `json:"deletedAt"`
+	ExpiredAt        *time.Time   `json:"expiredAt"`
+	Photos           []BlogPhoto  `json:"photos"`
+	User             UserResponse `json:"user"`
 
 	Hashtags []string `json:"hashtags"`
 }
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/datatypes"
+)
+
+// BlogRevision is the state of a blog before an update. Numbers grow per
+// blog; photos are kept as references to the stored files.
+type BlogRevision struct {
+	ID               uint64                                  `gorm:"primaryKey" json:"id"`
+	BlogID           uint64                                  `gorm:"not null;uniqueIndex:idx_blog_revision_number" json:"blogId"`
+	Number           int                                     `gorm:"not null;uniqueIndex:idx_blog_revision_number" json:"number"`
+	EditorID         uuid.UUID                               `gorm:"type:uuid;not null" json:"editorId"`
+	Title            string                                  `gorm:"not null" json:"title"`
+	Descr            string                                  `gorm:"not null" json:"descr"`
+	Content          string                                  `gorm:"null" json:"content"`
+	MultilangTitle   Multilang                               `gorm:"type:jsonb" json:"multilangTitle"`
+	MultilangDescr   Multilang                               `gorm:"type:jsonb" json:"multilangDescr"`
+	MultilangContent Multilang                               `gorm:"type:jsonb" json:"multilangContent"`
+	Hashtags         datatypes.JSONType[[]string]            `json:"hashtags"`
+	Cities           datatypes.JSONType[[]uint]              `json:"cities"`
+	Categories       datatypes.JSONType[[]uint]              `json:"categories"`
+	Photos           datatypes.JSONType[[]BlogRevisionPhoto] `json:"photos"`
+	CreatedAt        time.Time                               `gorm:"not null" json:"createdAt"`
+}
+
+// BlogRevisionPhoto keeps the files column of a blog photo as it was.
+type BlogRevisionPhoto struct {
+	ID    uint64          `json:"id"`
+	Files json.RawMessage `json:"files"`
+}
+
+// BlogRevisionChange is one changed field between two revisions.
+type BlogRevisionChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
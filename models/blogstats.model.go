@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// BlogHourlyStat holds the activity counters of a blog for one UTC hour.
+type BlogHourlyStat struct {
+	BlogID      uint64    `gorm:"primaryKey;autoIncrement:false" json:"blog_id"`
+	Hour        time.Time `gorm:"primaryKey;index" json:"hour"`
+	Views       int64     `gorm:"not null;default:0" json:"views"`
+	Impressions int64     `gorm:"not null;default:0" json:"impressions"`
+	Favorites   int64     `gorm:"not null;default:0" json:"favorites"`
+	Votes       int64     `gorm:"not null;default:0" json:"votes"`
+	Chats       int64     `gorm:"not null;default:0" json:"chats"`
+}
+
+// BlogDailyStat sums the hourly counters of a UTC day and adds the number
+// of unique visitors, which cannot be summed.
+type BlogDailyStat struct {
+	BlogID         uint64    `gorm:"primaryKey;autoIncrement:false" json:"blog_id"`
+	Day            time.Time `gorm:"primaryKey;type:date" json:"day"`
+	Views          int64     `gorm:"not null;default:0" json:"views"`
+	UniqueVisitors int64     `gorm:"not null;default:0" json:"unique_visitors"`
+	Impressions    int64     `gorm:"not null;default:0" json:"impressions"`
+	Favorites      int64     `gorm:"not null;default:0" json:"favorites"`
+	Votes          int64     `gorm:"not null;default:0" json:"votes"`
+	Chats          int64     `gorm:"not null;default:0" json:"chats"`
+}
+
+// BlogStatsPoint is one step of the time series of /blog/:id/stats.
+// UniqueVisitors is only counted per day.
+type BlogStatsPoint struct {
+	Time           time.Time `json:"time"`
+	Views          int64     `json:"views"`
+	UniqueVisitors *int64    `json:"unique_visitors,omitempty"`
+	Impressions    int64     `json:"impressions"`
+	Favorites      int64     `json:"favorites"`
+	Votes          int64     `json:"votes"`
+	Chats          int64     `json:"chats"`
+}
@@ -8,6 +8,8 @@ type City struct {
 	ID           uint              `gorm:"primary_key"`
 	CountryCode  string            `gorm:"not null"`
 	Hex          string            `gorm:"not null"`
+	Latitude     *float64          `gorm:"null"`
+	Longitude    *float64          `gorm:"null"`
 	UpdatedAt    time.Time         `gorm:"not null"`
 	DeletedAt    *time.Time        `gorm:"index"`
 	Translations []CityTranslation `gorm:"foreignkey:CityID"`
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// CurrencyRate is the value of one unit of a currency in the base currency,
+// whose own rate is 1. Source tells rates set by an admin from the ones
+// loaded from the rates file.
+type CurrencyRate struct {
+	Code      string    `gorm:"primaryKey;size:3" json:"code"`
+	Rate      float64   `gorm:"not null" json:"rate"`
+	Source    string    `gorm:"not null;default:manual" json:"source"`
+	UpdatedAt time.Time `gorm:"not null" json:"updated_at"`
+}
+
+const (
+	CurrencyRateSourceManual = "manual"
+	CurrencyRateSourceFeed   = "feed"
+)
+
+type CurrencyRateInput struct {
+	Code string  `json:"code" validate:"required,len=3,alpha"`
+	Rate float64 `json:"rate" validate:"required,gt=0"`
+}
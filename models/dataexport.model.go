@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Data export states.
+const (
+	DataExportPending    = "pending"
+	DataExportProcessing = "processing"
+	DataExportReady      = "ready"
+	DataExportFailed     = "failed"
+	DataExportExpired    = "expired"
+)
+
+// DataExport is a personal data archive requested by a user.
+type DataExport struct {
+	ID        uint64     `gorm:"primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	Status    string     `gorm:"type:varchar(20);not null;default:'pending'" json:"status"`
+	Language  string     `gorm:"type:varchar(10);not null;default:'en'" json:"-"`
+	FileName  string     `json:"-"`
+	Size      int64      `json:"size"`
+	Error     string     `json:"-"`
+	ReadyAt   *time.Time `json:"readyAt"`
+	ExpiresAt *time.Time `gorm:"index" json:"expiresAt"`
+	CreatedAt time.Time  `gorm:"not null" json:"createdAt"`
+	UpdatedAt time.Time  `gorm:"not null" json:"updatedAt"`
+}
@@ -1,10 +1,122 @@
 package models
 
-type MultilangTitle struct {
-	En string `gorm:"null"`
-	Ru string `gorm:"null"`
-	Ka string `gorm:"null"`
-	Es string `gorm:"null"`
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
 
-	// Add more language fields as needed
+// DefaultLanguage is tried after the requested language and before the
+// original text.
+const DefaultLanguage = "en"
+
+// Multilang holds the translations of a text keyed by Langs.Code. In JSON
+// it also carries the En, Ru, Ka and Es keys of the former fixed columns,
+// which older clients still read and send.
+type Multilang map[string]string
+
+var legacyLanguageKeys = map[string]string{
+	"En": "en",
+	"Ru": "ru",
+	"Ka": "ka",
+	"Es": "es",
+}
+
+func (m Multilang) MarshalJSON() ([]byte, error) {
+	out := make(map[string]string, len(m)+len(legacyLanguageKeys))
+	for code, text := range m {
+		out[code] = text
+	}
+	for key, code := range legacyLanguageKeys {
+		out[key] = m[code]
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON accepts language codes and the legacy keys; a code wins
+// over the legacy key of the same language.
+func (m *Multilang) UnmarshalJSON(data []byte) error {
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	out := Multilang{}
+	for key, code := range legacyLanguageKeys {
+		if text := raw[key]; text != "" {
+			out[code] = text
+		}
+	}
+	for key, text := range raw {
+		if _, legacy := legacyLanguageKeys[key]; legacy {
+			continue
+		}
+		if _, set := out[key]; !set || text != "" {
+			out[key] = text
+		}
+	}
+	*m = out
+	return nil
+}
+
+// Resolve returns the text in language. It falls back to the base language
+// ("pt-br" to "pt"), then to DefaultLanguage, and finally to the original
+// text source written in sourceLang.
+func (m Multilang) Resolve(language, sourceLang, source string) string {
+	for _, code := range languageFallbacks(language) {
+		if code == NormalizeLanguage(sourceLang) {
+			return source
+		}
+		if text := m[code]; text != "" {
+			return text
+		}
+	}
+	return source
+}
+
+// NormalizeLanguage lowercases a language code. "ke" is used for Georgian by
+// the email templates and older clients.
+func NormalizeLanguage(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "ke" {
+		return "ka"
+	}
+	return code
+}
+
+func languageFallbacks(language string) []string {
+	language = NormalizeLanguage(language)
+	codes := []string{}
+	if language != "" {
+		codes = append(codes, language)
+		if i := strings.IndexAny(language, "-_"); i > 0 {
+			codes = append(codes, language[:i])
+		}
+	}
+	return append(codes, DefaultLanguage)
+}
+
+func (m Multilang) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(map[string]string(m))
+	return string(data), err
+}
+
+func (m *Multilang) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = Multilang{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("multilang: cannot scan %T", value)
+	}
+	return json.Unmarshal(data, m)
 }
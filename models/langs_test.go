@@ -0,0 +1,91 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMultilangResolve(t *testing.T) {
+	m := Multilang{"en": "Flat", "pt": "Apartamento", "ka": "ბინა", "ru": ""}
+
+	tests := []struct {
+		name       string
+		language   string
+		sourceLang string
+		want       string
+	}{
+		{name: "exact", language: "pt", sourceLang: "es", want: "Apartamento"},
+		{name: "region to base language", language: "pt-BR", sourceLang: "es", want: "Apartamento"},
+		{name: "underscore region", language: "pt_br", sourceLang: "es", want: "Apartamento"},
+		{name: "ke is Georgian", language: "ke", sourceLang: "es", want: "ბინა"},
+		{name: "empty translation falls back", language: "ru", sourceLang: "es", want: "Flat"},
+		{name: "unknown language", language: "de", sourceLang: "es", want: "Flat"},
+		{name: "no language", language: "", sourceLang: "es", want: "Flat"},
+		{name: "source language", language: "es", sourceLang: "es", want: "Piso"},
+		{name: "default is the source language", language: "de", sourceLang: "en", want: "Piso"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.Resolve(tt.language, tt.sourceLang, "Piso"); got != tt.want {
+				t.Fatalf("Resolve = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := (Multilang{}).Resolve("de", "ru", "Квартира"); got != "Квартира" {
+		t.Fatalf("no translations: Resolve = %q", got)
+	}
+}
+
+func TestMultilangLegacyJSON(t *testing.T) {
+	data, err := json.Marshal(Multilang{"en": "Flat", "ru": "Квартира", "pt": "Apartamento"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]string
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"en": "Flat", "ru": "Квартира", "pt": "Apartamento",
+		"En": "Flat", "Ru": "Квартира", "Ka": "", "Es": "",
+	}
+	if len(out) != len(want) {
+		t.Fatalf("MarshalJSON = %s", data)
+	}
+	for key, text := range want {
+		if out[key] != text {
+			t.Fatalf("MarshalJSON = %s, want %v", data, want)
+		}
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want Multilang
+	}{
+		{name: "codes", body: `{"en":"Flat","pt":"Apartamento"}`, want: Multilang{"en": "Flat", "pt": "Apartamento"}},
+		{name: "legacy keys", body: `{"En":"Flat","Ka":"ბინა","Es":""}`, want: Multilang{"en": "Flat", "ka": "ბინა"}},
+		{name: "code wins", body: `{"En":"Old","en":"Flat"}`, want: Multilang{"en": "Flat"}},
+		{name: "empty code keeps legacy", body: `{"Ru":"Квартира","ru":""}`, want: Multilang{"ru": "Квартира"}},
+		{name: "round trip", body: string(data), want: Multilang{"en": "Flat", "ru": "Квартира", "pt": "Apartamento"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Multilang
+			if err := json.Unmarshal([]byte(tt.body), &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("UnmarshalJSON = %v, want %v", got, tt.want)
+			}
+			for code, text := range tt.want {
+				if got[code] != text {
+					t.Fatalf("UnmarshalJSON = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
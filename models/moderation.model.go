@@ -0,0 +1,18 @@
+package models
+
+// With moderation enabled a new or edited blog waits in
+// BlogStatusPendingReview until a moderator approves it, or rejects it with
+// a reason.
+const (
+	BlogStatusPendingReview = "PENDING_REVIEW"
+	BlogStatusRejected      = "REJECTED"
+)
+
+type ModerationDecisionInput struct {
+	IDs    []uint64 `json:"ids" validate:"required,min=1,max=100"`
+	Reason string   `json:"reason" validate:"max=500"`
+}
+
+type TrustUserInput struct {
+	Trusted bool `json:"trusted"`
+}
@@ -0,0 +1,130 @@
+package models
+
+import "time"
+
+// Scopes a role can hold a permission with. "own" limits the action to
+// records the user owns, "any" allows it on every record.
+const (
+	PermissionScopeAny = "any"
+	PermissionScopeOwn = "own"
+)
+
+// AccessRole is a role users can be assigned through User.Role.
+type AccessRole struct {
+	ID          uint64    `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `gorm:"not null" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"not null" json:"updatedAt"`
+}
+
+// Permission is an action on a resource, e.g. "update" on "blog".
+type Permission struct {
+	ID          uint64    `gorm:"primaryKey" json:"id"`
+	Resource    string    `gorm:"type:varchar(50);uniqueIndex:idx_permission_resource_action;not null" json:"resource"`
+	Action      string    `gorm:"type:varchar(50);uniqueIndex:idx_permission_resource_action;not null" json:"action"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `gorm:"not null" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"not null" json:"updatedAt"`
+}
+
+// RolePermission grants a permission to a role with a scope.
+type RolePermission struct {
+	ID           uint64     `gorm:"primaryKey" json:"id"`
+	Role         string     `gorm:"type:varchar(50);uniqueIndex:idx_role_permission;not null" json:"role"`
+	PermissionID uint64     `gorm:"uniqueIndex:idx_role_permission;not null" json:"permissionId"`
+	Permission   Permission `gorm:"foreignKey:PermissionID;constraint:OnDelete:CASCADE" json:"permission"`
+	Scope        string     `gorm:"type:varchar(10);default:'any';not null" json:"scope"`
+	CreatedAt    time.Time  `gorm:"not null" json:"createdAt"`
+	UpdatedAt    time.Time  `gorm:"not null" json:"updatedAt"`
+}
+
+type CreateRoleInput struct {
+	Name        string `json:"name" validate:"required,min=2,max=50,alphanum"`
+	Description string `json:"description" validate:"max=255"`
+}
+
+type GrantPermissionInput struct {
+	Role     string `json:"role" validate:"required"`
+	Resource string `json:"resource" validate:"required"`
+	Action   string `json:"action" validate:"required"`
+	Scope    string `json:"scope" validate:"required,oneof=any own"`
+}
+
+type PermissionGrant struct {
+	Resource string
+	Action   string
+	Scope    string
+}
+
+// DefaultRoles are created by the migration.
+var DefaultRoles = []AccessRole{
+	{Name: "admin", Description: "Full access"},
+	{Name: "user", Description: "Registered user"},
+	{Name: "vip", Description: "Registered user with a paid plan"},
+}
+
+// DefaultPermissions lists every permission checked by the routes.
+var DefaultPermissions = []Permission{
+	{Resource: "lang", Action: "create"},
+	{Resource: "lang", Action: "update"},
+	{Resource: "lang", Action: "delete"},
+	{Resource: "city", Action: "create"},
+	{Resource: "city", Action: "update"},
+	{Resource: "city", Action: "delete"},
+	{Resource: "city", Action: "translate"},
+	{Resource: "station", Action: "create"},
+	{Resource: "station", Action: "update"},
+	{Resource: "station", Action: "delete"},
+	{Resource: "station", Action: "translate"},
+	{Resource: "currency", Action: "update"},
+	{Resource: "currency", Action: "delete"},
+	{Resource: "guild", Action: "create"},
+	{Resource: "guild", Action: "update"},
+	{Resource: "guild", Action: "delete"},
+	{Resource: "guild", Action: "translate"},
+	{Resource: "account", Action: "update"},
+	{Resource: "profile", Action: "read"},
+	{Resource: "profile", Action: "update"},
+	{Resource: "blog", Action: "list"},
+	{Resource: "blog", Action: "create"},
+	{Resource: "blog", Action: "read"},
+	{Resource: "blog", Action: "update"},
+	{Resource: "blog", Action: "delete"},
+	{Resource: "chat", Action: "use"},
+	{Resource: "twofactor", Action: "reset"},
+	{Resource: "authlock", Action: "read"},
+	{Resource: "authlock", Action: "delete"},
+	{Resource: "apikey", Action: "read"},
+	{Resource: "apikey", Action: "create"},
+	{Resource: "apikey", Action: "delete"},
+	{Resource: "permission", Action: "read"},
+	{Resource: "permission", Action: "update"},
+	{Resource: "moderation", Action: "review"},
+	{Resource: "report", Action: "read"},
+	{Resource: "report", Action: "update"},
+}
+
+var memberGrants = []PermissionGrant{
+	{Resource: "account", Action: "update", Scope: PermissionScopeOwn},
+	{Resource: "profile", Action: "read", Scope: PermissionScopeOwn},
+	{Resource: "profile", Action: "update", Scope: PermissionScopeOwn},
+	{Resource: "blog", Action: "list", Scope: PermissionScopeOwn},
+	{Resource: "blog", Action: "create", Scope: PermissionScopeOwn},
+	{Resource: "blog", Action: "read", Scope: PermissionScopeOwn},
+	{Resource: "blog", Action: "update", Scope: PermissionScopeOwn},
+	{Resource: "blog", Action: "delete", Scope: PermissionScopeOwn},
+	{Resource: "chat", Action: "use", Scope: PermissionScopeOwn},
+}
+
+// DefaultRoleGrants is applied when a permission is first created. Admin
+// holds every permission with scope "any".
+var DefaultRoleGrants = map[string][]PermissionGrant{
+	"user": memberGrants,
+	"vip":  memberGrants,
+}
+
+// PermissionKey is the lookup key of a permission in a role's grant set.
+func PermissionKey(resource, action string) string {
+	return resource + ":" + action
+}
@@ -31,6 +31,14 @@ func (m *Meta) Scan(src interface{}) error {
 	return json.Unmarshal(data, m)
 }
 
+// Alert modes of a saved filter: new matching blogs are announced right
+// away or in a daily digest.
+const (
+	SavedSearchAlertsOff     = "off"
+	SavedSearchAlertsInstant = "instant"
+	SavedSearchAlertsDaily   = "daily"
+)
+
 type Presavedfilters struct {
 	ID        uint64     `gorm:"primaryKey"`
 	UserID    uuid.UUID  `gorm:"type:uuid;not null"`
@@ -39,4 +47,23 @@ type Presavedfilters struct {
 	Meta      Meta       `gorm:"type:jsonb"`
 	UpdatedAt time.Time  `gorm:"autoUpdateTime"`
 	DeletedAt *time.Time `gorm:"index"`
+	// Blogs created after AlertsCheckedAt have not been matched yet
+	Alerts          string `gorm:"not null;default:'off';index"`
+	AlertsCheckedAt *time.Time
+}
+
+// SavedSearchMatch records that a blog matched a saved filter, so that it is
+// announced only once. NotifiedAt is empty until a daily digest has
+// included it.
+type SavedSearchMatch struct {
+	ID         uint64     `gorm:"primaryKey" json:"id"`
+	FilterID   uint64     `gorm:"not null;uniqueIndex:idx_saved_search_match" json:"filter_id"`
+	BlogID     uint64     `gorm:"not null;uniqueIndex:idx_saved_search_match" json:"blog_id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	NotifiedAt *time.Time `gorm:"index" json:"notified_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type SavedSearchAlertsInput struct {
+	Alerts string `json:"alerts" validate:"required,oneof=off instant daily"`
 }
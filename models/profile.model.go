@@ -44,23 +44,30 @@ func (s Streamings) Value() (driver.Value, error) {
 }
 
 type Profile struct {
-	ID             uint64         `gorm:"primaryKey"`
-	UserID         uuid.UUID      `gorm:"type:uuid;not null;unique"`
-	Firstname      string         `gorm:"not null"`
-	Tcid           int64          `gorm:"null;"`
-	Descr          string         `gorm:"not null"`
-	MultilangDescr MultilangTitle `gorm:"embedded;embeddedPrefix:multilang_Descr_"`
+	ID             uint64    `gorm:"primaryKey"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null;unique"`
+	Firstname      string    `gorm:"not null"`
+	Tcid           int64     `gorm:"null;"`
+	Descr          string    `gorm:"not null"`
+	MultilangDescr Multilang `gorm:"-"`
 
 	City      []City               `gorm:"many2many:profiles_city;"`
+	Stations  []Stations           `gorm:"many2many:profiles_stations;" json:"stations"`
 	Guilds    []Guilds             `gorm:"many2many:profiles_guilds;"`
 	Hashtags  []HashtagsForProfile `gorm:"many2many:profiles_hashtags;"`
 	Photos    []ProfilePhoto       `json:"photos"`
 	Documents []ProfileDocuments   `json:"documents"`
 	Service   []ProfileService     `json:"service"`
 
-	Additional          string         `json:"additional"`
-	MultilangAdditional MultilangTitle `gorm:"embedded;embeddedPrefix:multilang_Additional_"`
-	Lang                string         `gorm:"not null;default:en"`
+	Additional          string    `json:"additional"`
+	MultilangAdditional Multilang `gorm:"-"`
+	Lang                string    `gorm:"not null;default:en"`
+
+	// The coordinates are only shown to the owner, see GetMe
+	Latitude  *float64 `gorm:"null" json:"-"`
+	Longitude *float64 `gorm:"null" json:"-"`
+	// Distance is set by listings sorted by distance, in kilometres
+	Distance *float64 `gorm:"-" json:"distance_km,omitempty"`
 
 	CreatedAt time.Time  `gorm:"not null"`
 	UpdatedAt time.Time  `gorm:"not null"`
@@ -74,7 +81,7 @@ type ProfileResponse struct {
 	ID                  uint64             `gorm:"not null"`
 	Firstname           string             `gorm:"not null"`
 	Descr               string             `gorm:"not null"`
-	MultilangDescr      MultilangTitle     `json:"multilangtitle"`
+	MultilangDescr      Multilang          `json:"multilangtitle"`
 	Tcid                int64              `gorm:"null"`
 	City                []string           `gorm:"city"`
 	Guilds              []string           `json:"guilds"`
@@ -83,6 +90,10 @@ type ProfileResponse struct {
 	Documents           []ProfileDocuments `json:"documents"`
 	Service             []ProfileService   `json:"service"`
 	Additional          string             `json:"additional"`
-	MultilangAdditional MultilangTitle     `json:"multilangadditional"`
+	MultilangAdditional Multilang          `json:"multilangadditional"`
+	LocalDescr          string             `json:"localdescr"`
+	LocalAdditional     string             `json:"localadditional"`
 	Streaming           Streamings         `gorm:"type:json;default:null" json:"streaming"`
+	Latitude            *float64           `json:"-"`
+	Longitude           *float64           `json:"-"`
 }
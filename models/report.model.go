@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Targets a report can be filed against. TargetID holds the blog, user,
+// chat message or profile ID as text.
+const (
+	ReportTargetPost    = "post"
+	ReportTargetUser    = "user"
+	ReportTargetMessage = "message"
+	ReportTargetProfile = "profile"
+)
+
+// Report statuses. A report is open until an admin resolves or dismisses it.
+const (
+	ReportStatusOpen      = "OPEN"
+	ReportStatusAssigned  = "ASSIGNED"
+	ReportStatusResolved  = "RESOLVED"
+	ReportStatusDismissed = "DISMISSED"
+)
+
+// BlogStatusHidden hides a blog reported by too many users until an admin
+// dismisses the reports.
+const BlogStatusHidden = "HIDDEN"
+
+type Report struct {
+	ID         uint64     `gorm:"primaryKey" json:"id"`
+	ReporterID uuid.UUID  `gorm:"type:uuid;not null;index" json:"reporterId"`
+	TargetType string     `gorm:"type:varchar(20);not null;index:idx_report_target" json:"targetType"`
+	TargetID   string     `gorm:"type:varchar(64);not null;index:idx_report_target" json:"targetId"`
+	Reason     string     `gorm:"type:varchar(20);not null" json:"reason"`
+	Details    string     `gorm:"type:text" json:"details"`
+	Status     string     `gorm:"type:varchar(20);not null;default:'OPEN';index" json:"status"`
+	AssigneeID *uuid.UUID `gorm:"type:uuid" json:"assigneeId"`
+	Resolution string     `gorm:"type:text" json:"resolution"`
+	ResolvedBy *uuid.UUID `gorm:"type:uuid" json:"resolvedBy"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+	CreatedAt  time.Time  `gorm:"not null" json:"createdAt"`
+	UpdatedAt  time.Time  `gorm:"not null" json:"updatedAt"`
+}
+
+type CreateReportInput struct {
+	TargetType string `json:"target_type" validate:"required,oneof=post user message profile"`
+	TargetID   string `json:"target_id" validate:"required,max=64"`
+	Reason     string `json:"reason" validate:"required,oneof=spam fraud offensive prohibited duplicate other"`
+	Details    string `json:"details" validate:"max=1000"`
+}
+
+type AssignReportInput struct {
+	AssigneeID *uuid.UUID `json:"assignee_id"`
+}
+
+type CloseReportInput struct {
+	Resolution string `json:"resolution" validate:"max=1000"`
+}
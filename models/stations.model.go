@@ -1,8 +1,24 @@
 package models
 
+// Stations is a metro station of a city. Line is the name of its line and
+// Hex the colour of the line; Name and Line are the default names, used
+// when there is no translation.
 type Stations struct {
-    ID         uint   `gorm:"primary_key"`
-    Hex        string
-    Line   	   string
-    Name       string
+	ID           uint `gorm:"primary_key"`
+	Hex          string
+	Name         string
+	Line         string               `gorm:"index"`
+	CityID       uint                 `gorm:"index"`
+	Latitude     *float64             `gorm:"null"`
+	Longitude    *float64             `gorm:"null"`
+	Translations []StationTranslation `gorm:"foreignkey:StationID"`
+}
+
+// StationTranslation is the name of a station and of its line in a language.
+type StationTranslation struct {
+	ID        uint   `json:"id" gorm:"primary_key"`
+	StationID uint   `json:"StationID" gorm:"index"` // link id
+	Language  string `json:"Language"`
+	Name      string `json:"Name"`
+	Line      string `json:"Line"`
 }
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"reflect"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+// Entities with translated fields.
+const (
+	TranslationEntityBlog    = "blog"
+	TranslationEntityProfile = "profile"
+)
+
+// ContentTranslation is the text of one field of a blog or profile in one
+// language of the langs table.
+type ContentTranslation struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	Entity    string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_content_translation" json:"entity"`
+	EntityID  uint64    `gorm:"not null;uniqueIndex:idx_content_translation" json:"entityId"`
+	Field     string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_content_translation" json:"field"`
+	Lang      string    `gorm:"type:varchar(10);not null;uniqueIndex:idx_content_translation;index" json:"lang"`
+	Text      string    `gorm:"type:text;not null" json:"text"`
+	UpdatedAt time.Time `gorm:"not null" json:"updatedAt"`
+}
+
+// TranslationOverride is a translation entered by the author. It replaces
+// the machine translation of a field as long as the source text hashes to
+// SourceHash.
+type TranslationOverride struct {
+	ID         uint64    `gorm:"primaryKey" json:"id"`
+	Entity     string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_translation_override" json:"entity"`
+	EntityID   uint64    `gorm:"not null;uniqueIndex:idx_translation_override" json:"entityId"`
+	Field      string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_translation_override" json:"field"`
+	Lang       string    `gorm:"type:varchar(10);not null;uniqueIndex:idx_translation_override" json:"lang"`
+	Text       string    `gorm:"type:text;not null" json:"text"`
+	SourceHash string    `gorm:"type:varchar(64);not null" json:"sourceHash"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null" json:"userId"`
+	CreatedAt  time.Time `gorm:"not null" json:"createdAt"`
+	UpdatedAt  time.Time `gorm:"not null" json:"updatedAt"`
+}
+
+type TranslationOverrideInput struct {
+	Field string `json:"field" validate:"required,max=20"`
+	Lang  string `json:"lang" validate:"required,max=10"`
+	Text  string `json:"text" validate:"required"`
+}
+
+// RegisterTranslationCallbacks makes every query returning blogs or
+// profiles load their translations, with one query per result set.
+func RegisterTranslationCallbacks(db *gorm.DB) error {
+	return db.Callback().Query().After("gorm:after_query").Register("translations:load", loadTranslations)
+}
+
+func loadTranslations(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+
+	switch db.Statement.Schema.ModelType {
+	case reflect.TypeOf(Blog{}):
+		blogs := []*Blog{}
+		ids := []uint64{}
+		for _, row := range queryResults(db, reflect.TypeOf(Blog{})) {
+			if b := row.(*Blog); b.ID != 0 {
+				blogs = append(blogs, b)
+				ids = append(ids, b.ID)
+			}
+		}
+		if len(ids) == 0 {
+			return
+		}
+
+		translations, err := findTranslations(db, TranslationEntityBlog, ids)
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		for _, b := range blogs {
+			fields := translations[b.ID]
+			b.MultilangTitle = fields["title"]
+			b.MultilangDescr = fields["descr"]
+			b.MultilangContent = fields["content"]
+		}
+
+	case reflect.TypeOf(Profile{}):
+		profiles := []*Profile{}
+		ids := []uint64{}
+		for _, row := range queryResults(db, reflect.TypeOf(Profile{})) {
+			if p := row.(*Profile); p.ID != 0 {
+				profiles = append(profiles, p)
+				ids = append(ids, p.ID)
+			}
+		}
+		if len(ids) == 0 {
+			return
+		}
+
+		translations, err := findTranslations(db, TranslationEntityProfile, ids)
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		for _, p := range profiles {
+			fields := translations[p.ID]
+			p.MultilangDescr = fields["descr"]
+			p.MultilangAdditional = fields["additional"]
+		}
+	}
+}
+
+// queryResults returns pointers to the rows of type typ a query scanned
+// into, whether its destination is a struct or a slice of structs or
+// pointers.
+func queryResults(db *gorm.DB, typ reflect.Type) []interface{} {
+	value := reflect.Indirect(db.Statement.ReflectValue)
+	results := []interface{}{}
+
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			elem := reflect.Indirect(value.Index(i))
+			if elem.Type() == typ && elem.CanAddr() {
+				results = append(results, elem.Addr().Interface())
+			}
+		}
+	case reflect.Struct:
+		if value.Type() == typ && value.CanAddr() {
+			results = append(results, value.Addr().Interface())
+		}
+	}
+	return results
+}
+
+// findTranslations returns the translations of entities keyed by entity ID
+// and field.
+func findTranslations(db *gorm.DB, entity string, ids []uint64) (map[uint64]map[string]Multilang, error) {
+	var rows []ContentTranslation
+	if err := db.Session(&gorm.Session{NewDB: true}).
+		Where("entity = ? AND entity_id IN ?", entity, ids).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	translations := map[uint64]map[string]Multilang{}
+	for _, row := range rows {
+		fields := translations[row.EntityID]
+		if fields == nil {
+			fields = map[string]Multilang{}
+			translations[row.EntityID] = fields
+		}
+		if fields[row.Field] == nil {
+			fields[row.Field] = Multilang{}
+		}
+		fields[row.Field][row.Lang] = row.Text
+	}
+	return translations, nil
+}
@@ -52,6 +52,36 @@ func (t *TimeEntryScanner) Scan(value interface{}) error {
 	}
 }
 
+// RecoveryCodes holds SHA-256 hashes of unused two-factor recovery codes.
+type RecoveryCodes []string
+
+func (r RecoveryCodes) Value() (driver.Value, error) {
+	if r == nil {
+		return "[]", nil
+	}
+	jsonBytes, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(jsonBytes), nil
+}
+
+func (r *RecoveryCodes) Scan(value interface{}) error {
+	if value == nil {
+		*r = nil
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return fmt.Errorf("unsupported Scan type for RecoveryCodes: %T", value)
+	}
+}
+
 type User struct {
 	ID                 uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
 	Seller             bool       `gorm:"type:boolean;default:false;not null"`
@@ -60,7 +90,10 @@ type User struct {
 	Email              string     `gorm:"type:varchar(100);uniqueIndex:idx_email;not null"`
 	Password           string     `gorm:"type:varchar(100);not null"`
 	Role               string     `gorm:"type:varchar(50);default:'user';not null"`
-	Provider           string     `gorm:"type:varchar(50);default:'local';not null"`
+	Provider           string     `gorm:"type:varchar(255);default:'local';not null"`
+	ProviderSubject    string     `gorm:"type:varchar(255);index;null"`
+	OIDCIssuer         string     `gorm:"type:varchar(255);null"`
+	OIDCSubject        string     `gorm:"type:varchar(255);index;null"`
 	Photo              string     `gorm:"not null;default:'default.png'"`
 	Verified           bool       `gorm:"not null;default:false"`
 	Banned             bool       `gorm:"not null;default:false"`
@@ -101,6 +134,12 @@ type User struct {
 	Followings                []*User          `gorm:"many2many:user_relation;joinForeignKey:user_Id;JoinReferences:following_id;"`
 	Followers                 []*User          `gorm:"many2many:user_relation;joinForeignKey:following_id;JoinReferences:user_Id;"`
 	IsBot                     bool             `gorm:"default:false"`
+	DeletionRequestedAt       *time.Time       `gorm:"index"`
+	Trusted                   bool             `gorm:"not null;default:false"`
+
+	TwoFactorEnabled       bool          `gorm:"not null;default:false"`
+	TwoFactorSecret        string        `gorm:"null" json:"-"`
+	TwoFactorRecoveryCodes RecoveryCodes `gorm:"type:json;default:'[]'" json:"-"`
 }
 
 type Role string
@@ -170,14 +209,21 @@ type UserResponse struct {
 	Followings        []*User           `json:"followings"`
 	Followers         []*User           `json:"followers"`
 	TotalFollowers    int64             `json:"totalfollowers"`
+	TwoFactorEnabled  bool              `json:"two_factor_enabled"`
 }
 
 func FilterUserRecord(user *User, language string) UserResponse {
 	var profileResponses []ProfileResponse
 	for _, profile := range user.Profile {
 		profileResponse := ProfileResponse{
-			ID:    profile.ID,
-			Descr: profile.Descr,
+			ID:                  profile.ID,
+			Descr:               profile.Descr,
+			MultilangDescr:      profile.MultilangDescr,
+			MultilangAdditional: profile.MultilangAdditional,
+			LocalDescr:          profile.MultilangDescr.Resolve(language, profile.Lang, profile.Descr),
+			LocalAdditional:     profile.MultilangAdditional.Resolve(language, profile.Lang, profile.Additional),
+			Latitude:            profile.Latitude,
+			Longitude:           profile.Longitude,
 		}
 
 		guilds := make([]string, 0, len(profile.Guilds))
@@ -258,9 +304,67 @@ func FilterUserRecord(user *User, language string) UserResponse {
 		Followings:       user.Followings,
 		Followers:        user.Followers,
 		TotalFollowers:   user.TotalFollowers,
+		TwoFactorEnabled: user.TwoFactorEnabled,
 	}
 }
 
+type TwoFactorCodeInput struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type TwoFactorVerifyInput struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type TwoFactorDisableInput struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type OIDCCallbackInput struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+// OIDCLinkInput confirms the password of an existing account before it is
+// linked to the identity provider.
+type OIDCLinkInput struct {
+	LinkToken string `json:"link_token" validate:"required"`
+	Password  string `json:"password" validate:"required"`
+}
+
+// TelegramAuthInput is the payload of the Telegram Login Widget. Session is
+// ours and not part of the signed data.
+type TelegramAuthInput struct {
+	ID        int64  `json:"id" validate:"required"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+	PhotoURL  string `json:"photo_url"`
+	AuthDate  int64  `json:"auth_date" validate:"required"`
+	Hash      string `json:"hash" validate:"required"`
+	Session   string `json:"session"`
+}
+
+type MagicLinkInput struct {
+	Email   string `json:"email" validate:"required,email"`
+	Session string `json:"session"`
+}
+
+type EmailLinkTokenInput struct {
+	Token   string `json:"token" validate:"required"`
+	Session string `json:"session"`
+}
+
+// ChangeEmailInput asks for the password of local accounts and for a
+// second factor code when two-factor authentication is enabled.
+type ChangeEmailInput struct {
+	NewEmail string `json:"newEmail" validate:"required,email,max=100"`
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
 type ForgotPasswordInput struct {
 	Email string `json:"email" binding:"required"`
 }
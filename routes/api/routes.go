@@ -10,21 +10,23 @@ import (
 	"hyperpage/controllers"
 	"hyperpage/initializers"
 	"hyperpage/middleware"
+	"hyperpage/models"
 )
 
 func Register(micro *fiber.App) {
 	micro.Route("/settings", func(router fiber.Router) {
 		router.Get("/base", controllers.GetBaseSystemData)
 		router.Get("/langs", controllers.Langs)
-		router.Post("/addlang", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.AddLang)
-		router.Delete("/deletelang/:id", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.DeleteLang)
-		router.Patch("/updatelang/:id", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.UpdateLang)
+		router.Post("/addlang", middleware.DeserializeUser, middleware.CheckPermission("lang", "create"), controllers.AddLang)
+		router.Delete("/deletelang/:id", middleware.DeserializeUser, middleware.CheckPermission("lang", "delete"), controllers.DeleteLang)
+		router.Patch("/updatelang/:id", middleware.DeserializeUser, middleware.CheckPermission("lang", "update"), controllers.UpdateLang)
 	})
 
 	micro.Route("/presavedfilter", func(router fiber.Router) {
 		router.Get("/get", middleware.DeserializeUser, controllers.GetPresavedfilters)
 		router.Post("/post", middleware.DeserializeUser, controllers.CreatePresavedfilter)
 		router.Patch("/patch/:id", middleware.DeserializeUser, controllers.PatchPresavedFilter)
+		router.Patch("/alerts/:id", middleware.DeserializeUser, controllers.PatchPresavedFilterAlerts)
 		router.Delete("/delete/:id", middleware.DeserializeUser, controllers.DeletePresavedFilter)
 	})
 
@@ -53,6 +55,25 @@ func Register(micro *fiber.App) {
 		router.Get("/refresh/:refreshToken", controllers.RefreshAccessToken)
 		router.Post("/checkTokenExp", controllers.CheckTokenExp)
 		router.Get("/check", middleware.DeserializeUser, controllers.GetUserDetails)
+		router.Get("/sessions", middleware.DeserializeUser, controllers.GetSessions)
+		router.Delete("/sessions", middleware.DeserializeUser, controllers.RevokeAllSessions)
+		router.Delete("/sessions/:id", middleware.DeserializeUser, controllers.RevokeSession)
+		router.Post("/2fa/setup", middleware.DeserializeUser, controllers.SetupTwoFactor)
+		router.Post("/2fa/enable", middleware.DeserializeUser, controllers.EnableTwoFactor)
+		router.Post("/2fa/disable", middleware.DeserializeUser, controllers.DisableTwoFactor)
+		router.Post("/2fa/recovery-codes", middleware.DeserializeUser, controllers.RegenerateRecoveryCodes)
+		router.Post("/2fa/verify", controllers.VerifyTwoFactor)
+		router.Post("/telegram", controllers.TelegramAuth)
+		router.Get("/oidc/login", controllers.OIDCLogin)
+		router.Post("/oidc/callback", controllers.OIDCCallback)
+		router.Post("/oidc/link", controllers.OIDCLinkAccount)
+		router.Post("/magic-link", controllers.RequestMagicLink)
+		router.Post("/magic-link/verify", controllers.MagicLinkSignIn)
+		router.Post("/email/change", middleware.DeserializeUser, middleware.CheckPermission("account", "update"), controllers.RequestEmailChange)
+		router.Post("/email/confirm", controllers.ConfirmEmailChange)
+		router.Post("/2fa/reset/:id", middleware.DeserializeUser, middleware.CheckPermission("twofactor", "reset"), controllers.AdminResetTwoFactor)
+		router.Get("/locks", middleware.DeserializeUser, middleware.CheckPermission("authlock", "read"), controllers.GetAuthLocks)
+		router.Delete("/locks", middleware.DeserializeUser, middleware.CheckPermission("authlock", "delete"), controllers.ClearAuthLocks)
 	})
 
 	micro.Route("/followers", func(router fiber.Router) {
@@ -73,9 +94,12 @@ func Register(micro *fiber.App) {
 	micro.Route("/users", func(router fiber.Router) {
 		router.Get("/myTime", controllers.MyTime)
 		router.Post("/deletme", middleware.DeserializeUser, controllers.DeleteUserWithRelations)
+		router.Post("/export", middleware.DeserializeUser, controllers.RequestDataExport)
+		router.Get("/export", middleware.DeserializeUser, controllers.GetDataExports)
+		router.Get("/export/download/:id", controllers.DownloadDataExport)
 		router.Post("/setvip", middleware.DeserializeUser, controllers.SetVipUser)
-		router.Patch("/changeName", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.ChangeNickName)
-		router.Patch("/setTokenDeivce", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.SetTokenIOSdevice)
+		router.Patch("/changeName", middleware.DeserializeUser, middleware.CheckPermission("account", "update"), controllers.ChangeNickName)
+		router.Patch("/setTokenDeivce", middleware.DeserializeUser, middleware.CheckPermission("account", "update"), controllers.SetTokenIOSdevice)
 		router.Get("/notifications", middleware.DeserializeUser, controllers.GetNotifications)
 		router.Patch("/notifications/:id/read", middleware.DeserializeUser, controllers.MarkNotificationAsRead)
 		router.Delete("/notifications/:id", middleware.DeserializeUser, controllers.DeleteNotification)
@@ -111,48 +135,72 @@ func Register(micro *fiber.App) {
 	micro.Route("/cities", func(router fiber.Router) {
 		router.Get("/all", controllers.GetCities)
 		router.Get("/query", controllers.GetName)
-		router.Post("/create", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.CreateCity)
-		router.Delete("/remove/:id", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.DeleteCity)
-		router.Patch("/update/:id", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.UpdateCity)
-		router.Get("/get", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.GetCityTranslation)
+		router.Post("/create", middleware.DeserializeUser, middleware.CheckPermission("city", "create"), controllers.CreateCity)
+		router.Delete("/remove/:id", middleware.DeserializeUser, middleware.CheckPermission("city", "delete"), controllers.DeleteCity)
+		router.Patch("/update/:id", middleware.DeserializeUser, middleware.CheckPermission("city", "update"), controllers.UpdateCity)
+		router.Get("/get", middleware.DeserializeUser, middleware.CheckPermission("city", "translate"), controllers.GetCityTranslation)
 	})
 
 	micro.Route("/citiestranslator", func(router fiber.Router) {
-		router.Post("/create", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.CreateCityTranslation)
-		router.Delete("/remove", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.DeleteCityTranslation)
-		router.Patch("/update", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.UpdateCityTranslation)
+		router.Post("/create", middleware.DeserializeUser, middleware.CheckPermission("city", "translate"), controllers.CreateCityTranslation)
+		router.Delete("/remove", middleware.DeserializeUser, middleware.CheckPermission("city", "translate"), controllers.DeleteCityTranslation)
+		router.Patch("/update", middleware.DeserializeUser, middleware.CheckPermission("city", "translate"), controllers.UpdateCityTranslation)
+	})
+
+	micro.Route("/currency", func(router fiber.Router) {
+		router.Get("/rates", controllers.GetCurrencyRates)
+		router.Put("/rates", middleware.DeserializeUser, middleware.CheckPermission("currency", "update"), controllers.SetCurrencyRate)
+		router.Post("/rates/reload", middleware.DeserializeUser, middleware.CheckPermission("currency", "update"), controllers.ReloadCurrencyRates)
+		router.Delete("/rates/:code", middleware.DeserializeUser, middleware.CheckPermission("currency", "delete"), controllers.DeleteCurrencyRate)
+	})
+
+	micro.Route("/stations", func(router fiber.Router) {
+		router.Get("/all", controllers.GetStations)
+		router.Get("/query", controllers.GetNameStation)
+		router.Post("/create", middleware.DeserializeUser, middleware.CheckPermission("station", "create"), controllers.CreateStation)
+		router.Delete("/remove/:id", middleware.DeserializeUser, middleware.CheckPermission("station", "delete"), controllers.DeleteStation)
+		router.Patch("/update/:id", middleware.DeserializeUser, middleware.CheckPermission("station", "update"), controllers.UpdateStation)
+	})
+
+	micro.Route("/stationstranslator", func(router fiber.Router) {
+		router.Post("/create", middleware.DeserializeUser, middleware.CheckPermission("station", "translate"), controllers.CreateStationTranslation)
+		router.Delete("/remove", middleware.DeserializeUser, middleware.CheckPermission("station", "translate"), controllers.DeleteStationTranslation)
+		router.Patch("/update", middleware.DeserializeUser, middleware.CheckPermission("station", "translate"), controllers.UpdateStationTranslation)
 	})
 
 	micro.Route("/guilds", func(router fiber.Router) {
 		router.Get("/all", controllers.GetGuilds)
 		router.Get("/getAll", controllers.GetGuildsAll)
-		router.Post("/create", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.CreateGuild)
-		router.Delete("/remove/:id", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.DeleteGuild)
-		router.Patch("/update/:id", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.UpdateGuild)
+		router.Post("/create", middleware.DeserializeUser, middleware.CheckPermission("guild", "create"), controllers.CreateGuild)
+		router.Delete("/remove/:id", middleware.DeserializeUser, middleware.CheckPermission("guild", "delete"), controllers.DeleteGuild)
+		router.Patch("/update/:id", middleware.DeserializeUser, middleware.CheckPermission("guild", "update"), controllers.UpdateGuild)
 
 		router.Get("/name", controllers.GetGuildName)
 		router.Get("/namecustom", controllers.GetGuildNameA)
 	})
 
 	micro.Route("/guildstranslator", func(router fiber.Router) {
-		router.Post("/create", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.CreateGuildTranslation)
-		router.Delete("/remove", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.DeleteGuildTranslation)
-		router.Patch("/update", middleware.DeserializeUser, middleware.CheckRole([]string{"admin"}), controllers.UpdateGuildTranslation)
+		router.Post("/create", middleware.DeserializeUser, middleware.CheckPermission("guild", "translate"), controllers.CreateGuildTranslation)
+		router.Delete("/remove", middleware.DeserializeUser, middleware.CheckPermission("guild", "translate"), controllers.DeleteGuildTranslation)
+		router.Patch("/update", middleware.DeserializeUser, middleware.CheckPermission("guild", "translate"), controllers.UpdateGuildTranslation)
 	})
 
 	micro.Route("/profile", func(router fiber.Router) {
-		router.Get("/get", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.GetProfile)
-		router.Patch("/save", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.UpdateProfile)
-		router.Patch("/saveAdditional", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.UpdateProfileAdditional)
-		router.Patch("/photos", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.UpdateProfilePhotos)
-		router.Post("/documents", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.NewProfileDocuments)
-		router.Patch("/documents", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.UpdateProfileDocuments)
-		router.Delete("/documents/:id", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.DeleteProfileDocuments)
+		router.Get("/get", middleware.DeserializeUser, middleware.CheckPermission("profile", "read"), controllers.GetProfile)
+		router.Patch("/save", middleware.DeserializeUser, middleware.CheckPermission("profile", "update"), controllers.UpdateProfile)
+		router.Patch("/saveAdditional", middleware.DeserializeUser, middleware.CheckPermission("profile", "update"), controllers.UpdateProfileAdditional)
+		router.Get("/translations", middleware.DeserializeUser, middleware.CheckPermission("profile", "update"), controllers.GetProfileTranslationOverrides)
+		router.Put("/translations", middleware.DeserializeUser, middleware.CheckPermission("profile", "update"), controllers.SetProfileTranslationOverride)
+		router.Delete("/translations/:field/:lang", middleware.DeserializeUser, middleware.CheckPermission("profile", "update"), controllers.DeleteProfileTranslationOverride)
+		router.Patch("/photos", middleware.DeserializeUser, middleware.CheckPermission("profile", "update"), controllers.UpdateProfilePhotos)
+		router.Post("/documents", middleware.DeserializeUser, middleware.CheckPermission("profile", "update"), controllers.NewProfileDocuments)
+		router.Patch("/documents", middleware.DeserializeUser, middleware.CheckPermission("profile", "update"), controllers.UpdateProfileDocuments)
+		router.Delete("/documents/:id", middleware.DeserializeUser, middleware.CheckPermission("profile", "update"), controllers.DeleteProfileDocuments)
 		router.Post("/streaming/", controllers.UpdateProfileStreaming)
 		router.Delete("/streaming/:id", controllers.DeleteProfileStreaming)
 		router.Post("/streaming/donat", middleware.DeserializeUser, controllers.SendDonat)
 
-		router.Get("/getdocuments", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.GetDocuments)
+		router.Get("/getdocuments", middleware.DeserializeUser, middleware.CheckPermission("profile", "read"), controllers.GetDocuments)
 	})
 
 	micro.Route("/profiles", func(router fiber.Router) {
@@ -167,17 +215,17 @@ func Register(micro *fiber.App) {
 	})
 
 	micro.Route("/profilehashtags", func(router fiber.Router) {
-		router.Post("/addhashtag", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.AddHashTagProfile)
+		router.Post("/addhashtag", middleware.DeserializeUser, middleware.CheckPermission("profile", "update"), controllers.AddHashTagProfile)
 		router.Get("/findTag", controllers.SearchHashTagProfile)
 		router.Get("/get", controllers.Get10RandomTags)
 
 	})
 
 	micro.Route("/blog", func(router fiber.Router) {
-		router.Get("/list", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.GetAllBlogs)
-		router.Post("/makearchive/:id", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.SendToArchive)
+		router.Get("/list", middleware.DeserializeUser, middleware.CheckPermission("blog", "list"), controllers.GetAllBlogs)
+		router.Post("/makearchive/:id", middleware.DeserializeUser, middleware.CheckPermission("blog", "update"), controllers.SendToArchive)
 		router.Post("/search", middleware.DeserializeUser, controllers.SearchBlogByTitle)
-		router.Post("/addblogtime", middleware.DeserializeUser, controllers.AddBlogTime)
+		router.Post("/addblogtime", middleware.DeserializeUser, middleware.CheckPermission("blog", "update"), controllers.AddBlogTime)
 		router.Post("/addhashtag", middleware.DeserializeUser, controllers.AddHashTag)
 		router.Get("/findTag", controllers.SearchHashTag)
 		router.Get("/taketags", controllers.Get10RandomBlogHashtags)
@@ -197,34 +245,43 @@ func Register(micro *fiber.App) {
 		router.Get("/random", controllers.GetRandom)
 
 		router.Get("/:id", controllers.GetBlogById)
-		router.Post("/create", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), middleware.CheckProfileFilled(), controllers.CreateBlog)
+		router.Get("/:id/related", controllers.GetRelatedBlogs)
+		router.Post("/create", middleware.DeserializeUser, middleware.CheckPermission("blog", "create"), middleware.CheckProfileFilled(), controllers.CreateBlog)
 		router.Post("/create/photos", middleware.DeserializeUser, controllers.CreateBlogPhoto)
-		router.Get("/edit/:id", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.EditBlogGetId)
-		router.Patch("/patch/:id", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.UpdateBlog)
-		router.Delete("/delete/:id", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.DeleteBlog)
+		router.Get("/edit/:id", middleware.DeserializeUser, middleware.CheckPermission("blog", "read"), controllers.EditBlogGetId)
+		router.Patch("/patch/:id", middleware.DeserializeUser, middleware.CheckPermission("blog", "update"), controllers.UpdateBlog)
+		router.Post("/cancel/:id", middleware.DeserializeUser, middleware.CheckPermission("blog", "update"), controllers.CancelScheduledBlog)
+		router.Get("/:id/stats", middleware.DeserializeUser, middleware.CheckPermission("blog", "read"), controllers.GetBlogStats)
+		router.Get("/:id/revisions", middleware.DeserializeUser, middleware.CheckPermission("blog", "read"), controllers.GetBlogRevisions)
+		router.Get("/:id/revisions/diff", middleware.DeserializeUser, middleware.CheckPermission("blog", "read"), controllers.DiffBlogRevisions)
+		router.Post("/:id/revisions/:number/restore", middleware.DeserializeUser, middleware.CheckPermission("blog", "update"), controllers.RestoreBlogRevision)
+		router.Get("/:id/translations", middleware.DeserializeUser, middleware.CheckPermission("blog", "update"), controllers.GetBlogTranslationOverrides)
+		router.Put("/:id/translations", middleware.DeserializeUser, middleware.CheckPermission("blog", "update"), controllers.SetBlogTranslationOverride)
+		router.Delete("/:id/translations/:field/:lang", middleware.DeserializeUser, middleware.CheckPermission("blog", "update"), controllers.DeleteBlogTranslationOverride)
+		router.Delete("/delete/:id", middleware.DeserializeUser, middleware.CheckPermission("blog", "delete"), controllers.DeleteBlog)
 	})
 
 	micro.Route("/chat", func(router fiber.Router) {
-		router.Get("/room/:roomId", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.GetRoomDetailsForDM)
-		router.Get("/rooms", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.GetSubscribedRoomsForDM)
-		router.Get("/newRooms", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.GetNewUnsubscribedRoomsForDM)
-		router.Get("/archivedRooms", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.GetUnsubscribedNotNewRoomsForDM)
-		router.Post("/createRoom", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.CreateChatRoomForDM)
-		router.Patch("/subscribe/:roomId", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.SubscribeNewRoomForDM)
-		router.Patch("/unsubscribe/:roomId", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.UnsubscribeRoomForDM)
-
-		router.Get("/message/:roomId", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.GetChatMessagesForDM)
-		router.Post("/message/:roomId", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.SendMessageForDM)
-		router.Patch("/message/:messageId", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.EditMessageForDM)
-		router.Delete("/message/:messageId", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.DeleteMessageForDM)
+		router.Get("/room/:roomId", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.GetRoomDetailsForDM)
+		router.Get("/rooms", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.GetSubscribedRoomsForDM)
+		router.Get("/newRooms", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.GetNewUnsubscribedRoomsForDM)
+		router.Get("/archivedRooms", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.GetUnsubscribedNotNewRoomsForDM)
+		router.Post("/createRoom", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.CreateChatRoomForDM)
+		router.Patch("/subscribe/:roomId", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.SubscribeNewRoomForDM)
+		router.Patch("/unsubscribe/:roomId", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.UnsubscribeRoomForDM)
+
+		router.Get("/message/:roomId", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.GetChatMessagesForDM)
+		router.Post("/message/:roomId", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.SendMessageForDM)
+		router.Patch("/message/:messageId", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.EditMessageForDM)
+		router.Delete("/message/:messageId", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.DeleteMessageForDM)
 		// Marks a message as read by the recipient
-		router.Patch("/read/:roomId", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.MarkMessageAsReadForDM)
-		router.Patch("/unread/:roomId/:status", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.MarkMessageAsUnReadForDM)
+		router.Patch("/read/:roomId", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.MarkMessageAsReadForDM)
+		router.Patch("/unread/:roomId/:status", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.MarkMessageAsUnReadForDM)
 	})
 
 	micro.Route("/contrifugoToken", func(router fiber.Router) {
-		router.Get("/connection", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.GetCentrifugoConnectionToken)
-		router.Get("/subscription", middleware.DeserializeUser, middleware.CheckRole([]string{"admin", "user", "vip"}), controllers.GetCentrifugoSubscriptionToken)
+		router.Get("/connection", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.GetCentrifugoConnectionToken)
+		router.Get("/subscription", middleware.DeserializeUser, middleware.CheckPermission("chat", "use"), controllers.GetCentrifugoSubscriptionToken)
 	})
 
 	micro.Route("/files", func(router fiber.Router) {
@@ -252,10 +309,40 @@ func Register(micro *fiber.App) {
 	})
 
 	micro.Route("/managebot", func(router fiber.Router) {
-		router.Post("/registerbot", controllers.SignUpBot)
-		router.Post("/deletebots", controllers.DeleteAllBotUsersWithRelations)
-		router.Patch("/updateprofile", controllers.UpdateBotProfile)
-		router.Patch("/updateadditionalinfo", controllers.UpdateBotProfileAdditional)
+		router.Post("/registerbot", middleware.CheckAPIKey(models.ScopeBotsWrite), controllers.SignUpBot)
+		router.Post("/deletebots", middleware.CheckAPIKey(models.ScopeBotsDelete), controllers.DeleteAllBotUsersWithRelations)
+		router.Patch("/updateprofile", middleware.CheckAPIKey(models.ScopeBotsWrite), controllers.UpdateBotProfile)
+		router.Patch("/updateadditionalinfo", middleware.CheckAPIKey(models.ScopeBotsWrite), controllers.UpdateBotProfileAdditional)
+	})
+
+	micro.Route("/apikeys", func(router fiber.Router) {
+		router.Get("/all", middleware.DeserializeUser, middleware.CheckPermission("apikey", "read"), controllers.GetAPIKeys)
+		router.Post("/create", middleware.DeserializeUser, middleware.CheckPermission("apikey", "create"), controllers.CreateAPIKey)
+		router.Delete("/revoke/:id", middleware.DeserializeUser, middleware.CheckPermission("apikey", "delete"), controllers.RevokeAPIKey)
+	})
+
+	micro.Route("/permissions", func(router fiber.Router) {
+		router.Get("/all", middleware.DeserializeUser, middleware.CheckPermission("permission", "read"), controllers.GetPermissions)
+		router.Get("/roles", middleware.DeserializeUser, middleware.CheckPermission("permission", "read"), controllers.GetRoles)
+		router.Post("/roles", middleware.DeserializeUser, middleware.CheckPermission("permission", "update"), controllers.CreateRole)
+		router.Delete("/roles/:name", middleware.DeserializeUser, middleware.CheckPermission("permission", "update"), controllers.DeleteRole)
+		router.Post("/grants", middleware.DeserializeUser, middleware.CheckPermission("permission", "update"), controllers.GrantPermission)
+		router.Delete("/grants/:id", middleware.DeserializeUser, middleware.CheckPermission("permission", "update"), controllers.RevokePermission)
+	})
+
+	micro.Route("/moderation", func(router fiber.Router) {
+		router.Get("/blogs", middleware.DeserializeUser, middleware.CheckPermission("moderation", "review"), controllers.GetModerationQueue)
+		router.Post("/blogs/approve", middleware.DeserializeUser, middleware.CheckPermission("moderation", "review"), controllers.ApproveBlogs)
+		router.Post("/blogs/reject", middleware.DeserializeUser, middleware.CheckPermission("moderation", "review"), controllers.RejectBlogs)
+		router.Patch("/trusted/:userId", middleware.DeserializeUser, middleware.CheckPermission("moderation", "review"), controllers.SetUserTrusted)
+	})
+
+	micro.Route("/reports", func(router fiber.Router) {
+		router.Post("/create", middleware.DeserializeUser, controllers.CreateReport)
+		router.Get("/all", middleware.DeserializeUser, middleware.CheckPermission("report", "read"), controllers.GetReports)
+		router.Patch("/:id/assign", middleware.DeserializeUser, middleware.CheckPermission("report", "update"), controllers.AssignReport)
+		router.Post("/:id/resolve", middleware.DeserializeUser, middleware.CheckPermission("report", "update"), controllers.ResolveReport)
+		router.Post("/:id/dismiss", middleware.DeserializeUser, middleware.CheckPermission("report", "update"), controllers.DismissReport)
 	})
 
 	micro.All("*", func(c *fiber.Ctx) error {
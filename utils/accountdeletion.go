@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+// Deleting an account only marks it pending deletion: its active blogs are
+// hidden and its sessions revoked. Signing in within the grace period
+// restores it; PurgeDeletedAccounts hard-deletes it afterwards.
+const AccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// ScheduleAccountDeletion marks the account pending deletion and returns the
+// time after which it will be purged.
+func ScheduleAccountDeletion(userID uuid.UUID) (time.Time, error) {
+	now := time.Now()
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"deletion_requested_at": now,
+			"online":                false,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Blog{}).
+			Where("user_id = ? AND status = ?", userID, "ACTIVE").
+			Update("status", models.BlogStatusPendingDeletion).Error
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("account deletion: schedule: %w", err)
+	}
+
+	if _, err := RevokeAllSessions(userID.String(), ""); err != nil {
+		log.Printf("account deletion: revoke sessions: %s", err)
+	}
+
+	return now.Add(AccountDeletionGracePeriod), nil
+}
+
+// RestoreAccount cancels a pending deletion. Blogs that expired in the
+// meantime go to the archive.
+func RestoreAccount(user *models.User) error {
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("deletion_requested_at", nil).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Blog{}).
+			Where("user_id = ? AND status = ?", user.ID, models.BlogStatusPendingDeletion).
+			Update("status", gorm.Expr("CASE WHEN expired_at < ? THEN 'ARCHIVED' ELSE 'ACTIVE' END", time.Now())).Error
+	})
+	if err != nil {
+		return fmt.Errorf("account deletion: restore: %w", err)
+	}
+
+	user.DeletionRequestedAt = nil
+	return nil
+}
+
+// PurgeDeletedAccounts hard-deletes accounts whose grace period is over and
+// records an audit entry for each.
+func PurgeDeletedAccounts() {
+	var users []models.User
+	if err := initializers.DB.
+		Where("deletion_requested_at < ?", time.Now().Add(-AccountDeletionGracePeriod)).
+		Find(&users).Error; err != nil {
+		log.Printf("account deletion: %s", err)
+		return
+	}
+
+	for i := range users {
+		user := &users[i]
+
+		entry := models.AccountDeletionLog{
+			UserID:      user.ID,
+			RequestedAt: *user.DeletionRequestedAt,
+			Status:      "purged",
+		}
+
+		if err := PurgeUser(user); err != nil {
+			log.Printf("account deletion: purge %s: %s", user.ID, err)
+			entry.Status = "failed"
+			entry.Error = err.Error()
+		}
+
+		entry.PurgedAt = time.Now()
+		if err := initializers.DB.Create(&entry).Error; err != nil {
+			log.Printf("account deletion: audit %s: %s", user.ID, err)
+		}
+	}
+}
+
+// PurgeUser deletes the user, its related records and uploaded files.
+func PurgeUser(user *models.User) error {
+	config, _ := initializers.LoadConfig(".")
+
+	// An account can be deleted before its profile was ever created
+	var profileID string
+	hasProfile := true
+	err := initializers.DB.Model(&models.Profile{}).Where("user_id = ?", user.ID).Select("id").Row().Scan(&profileID)
+	if errors.Is(err, sql.ErrNoRows) {
+		hasProfile = false
+	} else if err != nil {
+		return fmt.Errorf("load profile: %w", err)
+	}
+
+	var exports []models.DataExport
+	initializers.DB.Where("user_id = ? AND file_name <> ''", user.ID).Find(&exports)
+
+	// Delete related entities using the profileID and user.ID before deleting the user
+	relatedEntities := []string{
+		"profiles_guilds",
+		"profiles_city",
+		"profiles_stations",
+		"profiles_hashtags",
+		"profile_photos",
+		"billings",
+		"online_storages",
+		"transactions",
+		"blogs",
+		"user_relation",
+		"votes",
+		"codes",
+		"domains",
+		"payments",
+		"data_exports",
+		"translation_overrides",
+		"saved_search_matches",
+		"presavedfilters",
+	}
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM blog_revisions WHERE blog_id IN (SELECT id FROM blogs WHERE user_id = ?)", user.ID).Error; err != nil {
+			return fmt.Errorf("delete blog revisions: %w", err)
+		}
+		if err := tx.Exec(
+			"DELETE FROM content_translations WHERE entity = ? AND entity_id IN (SELECT id FROM blogs WHERE user_id = ?)",
+			models.TranslationEntityBlog, user.ID,
+		).Error; err != nil {
+			return fmt.Errorf("delete translations: %w", err)
+		}
+		if hasProfile {
+			if err := tx.Exec("DELETE FROM content_translations WHERE entity = ? AND entity_id = ?", models.TranslationEntityProfile, profileID).Error; err != nil {
+				return fmt.Errorf("delete translations: %w", err)
+			}
+		}
+		for _, table := range []string{"blog_hourly_stats", "blog_daily_stats"} {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE blog_id IN (SELECT id FROM blogs WHERE user_id = ?)", user.ID).Error; err != nil {
+				return fmt.Errorf("delete blog stats: %w", err)
+			}
+		}
+		if err := tx.Exec("DELETE FROM blog_stations WHERE blog_id IN (SELECT id FROM blogs WHERE user_id = ?)", user.ID).Error; err != nil {
+			return fmt.Errorf("delete blog stations: %w", err)
+		}
+		if err := tx.Exec("DELETE FROM reports WHERE reporter_id = ?", user.ID).Error; err != nil {
+			return fmt.Errorf("delete reports: %w", err)
+		}
+
+		for _, table := range relatedEntities {
+			whereColumn := "user_id"
+			id := user.ID.String()
+			if table == "profiles_guilds" || table == "profiles_city" || table == "profiles_stations" || table == "profiles_hashtags" || table == "profile_photos" {
+				if !hasProfile {
+					continue
+				}
+				whereColumn = "profile_id"
+				id = profileID
+			}
+
+			if err := tx.Exec("DELETE FROM "+table+" WHERE "+whereColumn+" = ?", id).Error; err != nil {
+				return fmt.Errorf("delete related entities from %s: %w", table, err)
+			}
+
+			if table == "user_relation" {
+				if err := tx.Exec("DELETE FROM "+table+" WHERE following_id = ?", id).Error; err != nil {
+					return fmt.Errorf("delete related entities from %s: %w", table, err)
+				}
+			}
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Profile{}).Error; err != nil {
+			return fmt.Errorf("delete profile: %w", err)
+		}
+
+		if err := tx.Delete(user).Error; err != nil {
+			return fmt.Errorf("delete user: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Files are removed only once the rows are gone
+	if user.Storage != "" {
+		if err := os.RemoveAll(filepath.Join(config.IMGStorePath, user.Storage)); err != nil {
+			log.Printf("account deletion: remove storage of %s: %s", user.ID, err)
+		}
+	}
+	for _, export := range exports {
+		os.Remove(filepath.Join(dataExportDir(), export.FileName))
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+)
+
+// API keys look like "pxk_<prefix>_<secret>". The prefix identifies the key
+// in the database, the whole string is only ever stored hashed.
+const apiKeyTag = "pxk"
+
+var (
+	ErrAPIKeyInvalid = errors.New("Invalid API key")
+	ErrAPIKeyRevoked = errors.New("API key has been revoked")
+	ErrAPIKeyExpired = errors.New("API key has expired")
+	ErrAPIKeyScope   = errors.New("API key is missing the required scope")
+)
+
+// findAPIKey loads the key with a lookup prefix.
+var findAPIKey = func(prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := initializers.DB.Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GenerateAPIKey returns the plain key, its lookup prefix and its hash.
+func GenerateAPIKey() (string, string, string, error) {
+	prefixBytes := make([]byte, 6)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", "", fmt.Errorf("apikey: generate: %w", err)
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", "", fmt.Errorf("apikey: generate: %w", err)
+	}
+
+	prefix := apiKeyTag + "_" + hex.EncodeToString(prefixBytes)
+	key := prefix + "_" + hex.EncodeToString(secretBytes)
+
+	return key, prefix, HashAPIKey(key), nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix extracts the lookup prefix from a presented key.
+func APIKeyPrefix(key string) (string, bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != apiKeyTag || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[0] + "_" + parts[1], true
+}
+
+// AuthenticateAPIKey returns the stored key matching a presented one when it
+// is neither revoked nor expired at now and grants scope.
+func AuthenticateAPIKey(presented, scope string, now time.Time) (*models.APIKey, error) {
+	prefix, ok := APIKeyPrefix(presented)
+	if !ok {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	key, err := findAPIKey(prefix)
+	if err != nil {
+		return nil, ErrAPIKeyInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(HashAPIKey(presented))) != 1 {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	if key.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(now) {
+		return nil, ErrAPIKeyExpired
+	}
+	if !key.HasScope(scope) {
+		return key, ErrAPIKeyScope
+	}
+
+	return key, nil
+}
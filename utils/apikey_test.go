@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"hyperpage/models"
+)
+
+func stubAPIKeys(t *testing.T, keys ...*models.APIKey) {
+	t.Helper()
+
+	previous := findAPIKey
+	findAPIKey = func(prefix string) (*models.APIKey, error) {
+		for _, key := range keys {
+			if key.Prefix == prefix {
+				return key, nil
+			}
+		}
+		return nil, errors.New("record not found")
+	}
+	t.Cleanup(func() { findAPIKey = previous })
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, prefix+"_") {
+		t.Fatalf("key %q does not start with its prefix %q", key, prefix)
+	}
+	if got, ok := APIKeyPrefix(key); !ok || got != prefix {
+		t.Fatalf("APIKeyPrefix = %q, %v; want %q", got, ok, prefix)
+	}
+	if hash != HashAPIKey(key) || strings.Contains(hash, key) {
+		t.Fatalf("hash %q is not the hash of the key", hash)
+	}
+
+	other, _, otherHash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key || otherHash == hash {
+		t.Fatal("two generated keys are equal")
+	}
+}
+
+func TestAPIKeyPrefix(t *testing.T) {
+	tests := []struct {
+		key    string
+		prefix string
+		ok     bool
+	}{
+		{key: "pxk_abc_secret", prefix: "pxk_abc", ok: true},
+		{key: "pxk_abc"},
+		{key: "pxk__secret"},
+		{key: "pxk_abc_"},
+		{key: "other_abc_secret"},
+		{key: "pxk_abc_sec_ret"},
+		{key: ""},
+	}
+
+	for _, tt := range tests {
+		prefix, ok := APIKeyPrefix(tt.key)
+		if prefix != tt.prefix || ok != tt.ok {
+			t.Errorf("APIKeyPrefix(%q) = %q, %v; want %q, %v", tt.key, prefix, ok, tt.prefix, tt.ok)
+		}
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	newKey := func(scopes string, modify func(*models.APIKey)) (*models.APIKey, string) {
+		plain, prefix, hash, err := GenerateAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := &models.APIKey{Prefix: prefix, KeyHash: hash, Scopes: scopes}
+		if modify != nil {
+			modify(key)
+		}
+		return key, plain
+	}
+
+	active, activePlain := newKey(models.ScopeBotsWrite, nil)
+	both, bothPlain := newKey(models.ScopeBotsWrite+" "+models.ScopeBotsDelete, func(k *models.APIKey) { k.ExpiresAt = &future })
+	revoked, revokedPlain := newKey(models.ScopeBotsWrite, func(k *models.APIKey) { k.RevokedAt = &past })
+	expired, expiredPlain := newKey(models.ScopeBotsWrite, func(k *models.APIKey) { k.ExpiresAt = &past })
+	stubAPIKeys(t, active, both, revoked, expired)
+
+	activePrefix, _ := APIKeyPrefix(activePlain)
+
+	tests := []struct {
+		name      string
+		presented string
+		scope     string
+		want      error
+	}{
+		{name: "active", presented: activePlain, scope: models.ScopeBotsWrite},
+		{name: "second scope", presented: bothPlain, scope: models.ScopeBotsDelete},
+		{name: "missing scope", presented: activePlain, scope: models.ScopeBotsDelete, want: ErrAPIKeyScope},
+		{name: "wrong secret", presented: activePrefix + "_" + strings.Repeat("0", 64), scope: models.ScopeBotsWrite, want: ErrAPIKeyInvalid},
+		{name: "unknown prefix", presented: "pxk_000000000000_secret", scope: models.ScopeBotsWrite, want: ErrAPIKeyInvalid},
+		{name: "malformed", presented: "not a key", scope: models.ScopeBotsWrite, want: ErrAPIKeyInvalid},
+		{name: "revoked", presented: revokedPlain, scope: models.ScopeBotsWrite, want: ErrAPIKeyRevoked},
+		{name: "expired", presented: expiredPlain, scope: models.ScopeBotsWrite, want: ErrAPIKeyExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := AuthenticateAPIKey(tt.presented, tt.scope, now)
+			if err != tt.want {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+			if err == nil && key.KeyHash != HashAPIKey(tt.presented) {
+				t.Fatalf("returned key %+v", key)
+			}
+		})
+	}
+}
@@ -66,3 +66,64 @@ func DeductAmountFromUserBalance(userID uuid.UUID, amount float64, total float64
 
 	return nil
 }
+
+// RefundElementCharges returns the open deductions made for an element to
+// the user's balance and records the refund. It returns the refunded amount.
+func RefundElementCharges(userID uuid.UUID, module string, elementId uint64) (float64, error) {
+	var refunded float64
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		refunded, err = refundElementCharges(tx, userID, module, elementId)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return refunded, nil
+}
+
+// refundElementCharges is RefundElementCharges within the transaction tx.
+func refundElementCharges(tx *gorm.DB, userID uuid.UUID, module string, elementId uint64) (float64, error) {
+	var charges []models.Transaction
+	if err := tx.Where("user_id = ? AND module = ? AND element_id = ? AND type = ? AND status = ?",
+		userID, module, elementId, "deduction", "OPENED").Find(&charges).Error; err != nil {
+		return 0, err
+	}
+	if len(charges) == 0 {
+		return 0, nil
+	}
+
+	var refunded float64
+	ids := make([]uint64, len(charges))
+	for i, charge := range charges {
+		ids[i] = charge.ID
+		refunded += charge.Amount
+	}
+
+	if err := tx.Model(&models.Transaction{}).Where("id IN ?", ids).Update("status", "REFUNDED").Error; err != nil {
+		return 0, err
+	}
+
+	if err := tx.Model(&models.Billing{}).Where("user_id = ?", userID).
+		Update("amount", gorm.Expr("amount + ?", refunded)).Error; err != nil {
+		return 0, err
+	}
+
+	err := tx.Create(&models.Transaction{
+		UserID:      userID,
+		Amount:      refunded,
+		Status:      "CLOSED_1",
+		Module:      module,
+		ElementId:   elementId,
+		Total:       "0",
+		Description: "Возврат за отменённую публикацию объявления",
+		Type:        "refund",
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return refunded, nil
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	"gorm.io/gorm"
+)
+
+// Filter dimensions of the blog listing. A facet is counted with every
+// filter applied except the one of its own dimension.
+const (
+	BlogFilterCity     = "city"
+	BlogFilterCategory = "category"
+	BlogFilterHashtag  = "hashtag"
+	BlogFilterMoney    = "money"
+	BlogFilterStation  = "station"
+)
+
+// A blog is near a station when it is linked to it or, having its own
+// coordinates, lies within StationNearbyKm of it.
+const StationNearbyKm = 1.0
+
+// BlogFilterKeys are the query parameters of /blog/listAll, also used as
+// the keys of a saved filter's Meta.
+var BlogFilterKeys = []string{BlogFilterCity, BlogFilterCategory, BlogFilterHashtag, "title", BlogFilterMoney, "currency", BlogFilterStation, "lat", "lng", "radius_km"}
+
+// BlogFilters are the filters of /blog/listAll resolved to IDs.
+type BlogFilters struct {
+	Language string
+	CityID   uint
+	GuildID  uint
+	Hashtags []string
+	Title    string
+	MinTotal *float64
+	MaxTotal *float64
+	Geo      *GeoFilter
+
+	// Prices are converted to Currency, whose rate is CurrencyRate
+	Currency     string
+	CurrencyRate float64
+	Rates        map[string]float64
+
+	StationID   uint
+	StationNear *GeoFilter
+}
+
+// ParseBlogFilters resolves the filter values keyed by BlogFilterKeys. City
+// and category are names in language; "all" or an empty value leaves a
+// dimension unfiltered. money is a price range in currency, the base
+// currency by default. station is a station ID. lat, lng and radius_km give
+// a GeoFilter.
+func ParseBlogFilters(values map[string]string, language string) (*BlogFilters, error) {
+	filters := &BlogFilters{Language: language}
+
+	if city := values[BlogFilterCity]; city != "" && city != "all" {
+		var cityTranslation models.CityTranslation
+		initializers.DB.Where("name = ? AND language = ?", city, language).First(&cityTranslation)
+		filters.CityID = cityTranslation.CityID
+	}
+
+	if category := values[BlogFilterCategory]; category != "" && category != "all" {
+		var guildTranslation models.GuildTranslation
+		initializers.DB.Where("name = ? AND language = ?", category, language).First(&guildTranslation)
+		filters.GuildID = guildTranslation.GuildID
+	}
+
+	if hashtags := values[BlogFilterHashtag]; hashtags != "" && hashtags != "all" {
+		for _, tag := range strings.Split(hashtags, ",") {
+			filters.Hashtags = append(filters.Hashtags, strings.TrimSpace(tag))
+		}
+	}
+
+	if title := values["title"]; title != "" && title != "all" {
+		filters.Title = title
+	}
+
+	rates, err := CurrencyRates()
+	if err != nil {
+		return nil, err
+	}
+	filters.Rates = rates
+	filters.Currency = NormalizeCurrency(values["currency"])
+	if filters.Currency == "" {
+		filters.Currency = BaseCurrency()
+	}
+	rate, ok := rates[filters.Currency]
+	if !ok {
+		return nil, ErrCurrencyUnknown
+	}
+	filters.CurrencyRate = rate
+
+	if money := values[BlogFilterMoney]; money != "" && money != "all" {
+		if strings.Contains(money, "-") {
+			totalRange := strings.Split(money, "-")
+			if len(totalRange) != 2 {
+				return nil, fmt.Errorf("invalid total range format")
+			}
+
+			lowerTotal, err := strconv.Atoi(strings.TrimSpace(totalRange[0]))
+			if err != nil {
+				return nil, err
+			}
+			upperTotal, err := strconv.Atoi(strings.TrimSpace(totalRange[1]))
+			if err != nil {
+				return nil, err
+			}
+
+			lower, upper := float64(lowerTotal), float64(upperTotal)
+			filters.MinTotal, filters.MaxTotal = &lower, &upper
+		} else {
+			totalInt, err := strconv.Atoi(money)
+			if err != nil {
+				return nil, err
+			}
+			lower := float64(totalInt)
+			filters.MinTotal = &lower
+		}
+	}
+
+	if station := values[BlogFilterStation]; station != "" && station != "all" {
+		stationID, err := strconv.ParseUint(station, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid station")
+		}
+		filters.StationID = uint(stationID)
+
+		var found models.Stations
+		if err := initializers.DB.Select("id", "latitude", "longitude").First(&found, stationID).Error; err == nil &&
+			found.Latitude != nil && found.Longitude != nil {
+			filters.StationNear = &GeoFilter{Lat: *found.Latitude, Lng: *found.Longitude, RadiusKm: StationNearbyKm}
+		}
+	}
+
+	geo, err := ParseGeoFilter(values["lat"], values["lng"], values["radius_km"])
+	if err != nil {
+		return nil, err
+	}
+	filters.Geo = geo
+
+	return filters, nil
+}
+
+// Apply adds every filter except the one of dimension except to query.
+func (f *BlogFilters) Apply(query *gorm.DB, except string) *gorm.DB {
+	if f.Hashtags != nil && except != BlogFilterHashtag {
+		subQuery := initializers.DB.Table("blog_hashtags bh").
+			Select("bh.blog_id").
+			Joins("JOIN hashtags h ON bh.hashtags_id = h.id").
+			Where("h.hashtag IN (?)", f.Hashtags)
+		query = query.Where("blogs.id IN (?)", subQuery)
+	}
+
+	if f.CityID != 0 && except != BlogFilterCity {
+		subQuery := initializers.DB.Table("blog_city").
+			Select("blog_id").
+			Where("city_id = ?", f.CityID)
+		query = query.Where("blogs.id IN (?)", subQuery)
+	}
+
+	if f.GuildID != 0 && except != BlogFilterCategory {
+		subQuery := initializers.DB.Table("blog_guilds").
+			Select("blog_id").
+			Where("guilds_id = ?", f.GuildID)
+		query = query.Where("blogs.id IN (?)", subQuery)
+	}
+
+	if f.Title != "" {
+		query = MatchBlogs(query, f.Title, f.Language)
+	}
+
+	if f.StationID != 0 && except != BlogFilterStation {
+		linked := initializers.DB.Table("blog_stations").
+			Select("blog_id").
+			Where("stations_id = ?", f.StationID)
+		near := initializers.DB.Where("blogs.id IN (?)", linked)
+		if f.StationNear != nil {
+			near = near.Or(f.StationNear.Within(initializers.DB, BlogPreciseLocation))
+		}
+		query = query.Where(near)
+	}
+
+	if f.Geo != nil {
+		query = f.Geo.Within(query, BlogLocation)
+	}
+
+	if except != BlogFilterMoney {
+		if f.MinTotal != nil {
+			query = query.Where(BlogPriceSQL+" >= ?", f.CurrencyRate, *f.MinTotal)
+		}
+		if f.MaxTotal != nil {
+			query = query.Where(BlogPriceSQL+" <= ?", f.CurrencyRate, *f.MaxTotal)
+		}
+	}
+
+	return query
+}
+
+// MatchingIDs selects the IDs of active blogs matching all filters but except.
+func (f *BlogFilters) MatchingIDs(except string) *gorm.DB {
+	return f.Apply(initializers.DB.Table("blogs").Select("blogs.id").Where("blogs.status = ?", "ACTIVE"), except)
+}
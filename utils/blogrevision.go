@@ -0,0 +1,431 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	"github.com/jackc/pgtype"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Every blog update first stores the previous state as a revision. Photo
+// files are only removed from disk once neither the blog nor any of its
+// revisions references them; older revisions beyond BlogRevisionLimit are
+// pruned on the next update.
+const BlogRevisionLimit = 20
+
+var ErrBlogRevisionNotFound = errors.New("revision not found")
+
+// SnapshotBlog stores the current state of blog as its next revision. The
+// blog row stays locked until the revision is stored, so concurrent edits
+// take numbers one after the other.
+func SnapshotBlog(blogID uint64, editorID uuid.UUID) (*models.BlogRevision, error) {
+	var revision *models.BlogRevision
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			First(&models.Blog{}, "id = ?", blogID).Error; err != nil {
+			return fmt.Errorf("load blog: %w", err)
+		}
+
+		var blog models.Blog
+		if err := tx.
+			Preload("Hashtags").
+			Preload("City").
+			Preload("Catygory").
+			Preload("Photos").
+			First(&blog, "id = ?", blogID).Error; err != nil {
+			return fmt.Errorf("load blog: %w", err)
+		}
+
+		revision = blogRevisionOf(&blog)
+		revision.EditorID = editorID
+
+		var last int
+		if err := tx.Model(&models.BlogRevision{}).
+			Where("blog_id = ?", blogID).
+			Select("COALESCE(MAX(number), 0)").
+			Row().Scan(&last); err != nil {
+			return err
+		}
+		revision.Number = last + 1
+
+		if err := tx.Create(revision).Error; err != nil {
+			return fmt.Errorf("create: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("blog revision: %w", err)
+	}
+
+	return revision, nil
+}
+
+// GetBlogRevision returns revision number of a blog.
+func GetBlogRevision(blogID uint64, number int) (*models.BlogRevision, error) {
+	var revision models.BlogRevision
+	err := initializers.DB.Where("blog_id = ? AND number = ?", blogID, number).First(&revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrBlogRevisionNotFound
+	}
+	return &revision, err
+}
+
+// CurrentBlogRevision returns the current state of a blog in the form of a
+// revision with number 0, so it can be compared with stored ones.
+func CurrentBlogRevision(blogID uint64) (*models.BlogRevision, error) {
+	var blog models.Blog
+	if err := initializers.DB.
+		Preload("Hashtags").
+		Preload("City").
+		Preload("Catygory").
+		Preload("Photos").
+		First(&blog, "id = ?", blogID).Error; err != nil {
+		return nil, err
+	}
+	return blogRevisionOf(&blog), nil
+}
+
+// DiffBlogRevisions lists the fields that differ between from and to.
+func DiffBlogRevisions(from, to *models.BlogRevision) []models.BlogRevisionChange {
+	changes := []models.BlogRevisionChange{}
+	add := func(field string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			changes = append(changes, models.BlogRevisionChange{Field: field, From: a, To: b})
+		}
+	}
+
+	add("title", from.Title, to.Title)
+	add("descr", from.Descr, to.Descr)
+	add("content", from.Content, to.Content)
+	for _, ml := range []struct {
+		field    string
+		from, to models.Multilang
+	}{
+		{"multilang_title", from.MultilangTitle, to.MultilangTitle},
+		{"multilang_descr", from.MultilangDescr, to.MultilangDescr},
+		{"multilang_content", from.MultilangContent, to.MultilangContent},
+	} {
+		codes := []string{}
+		for code := range ml.from {
+			codes = append(codes, code)
+		}
+		for code := range ml.to {
+			if _, ok := ml.from[code]; !ok {
+				codes = append(codes, code)
+			}
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			add(ml.field+"."+code, ml.from[code], ml.to[code])
+		}
+	}
+	add("hashtags", sortedStrings(from.Hashtags.Data()), sortedStrings(to.Hashtags.Data()))
+	add("cities", sortedUints(from.Cities.Data()), sortedUints(to.Cities.Data()))
+	add("categories", sortedUints(from.Categories.Data()), sortedUints(to.Categories.Data()))
+	add("photos", revisionPhotoPaths(from), revisionPhotoPaths(to))
+
+	return changes
+}
+
+// RestoreBlogRevision puts blog back into the state of revision. The state
+// it replaces is stored as a new revision first, so a restore can be undone.
+// The blog gets status, as after any edit.
+func RestoreBlogRevision(blogID uint64, revision *models.BlogRevision, editorID uuid.UUID, status string) error {
+	if _, err := SnapshotBlog(blogID, editorID); err != nil {
+		return err
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		blog := models.Blog{ID: blogID}
+
+		if err := tx.Model(&blog).Updates(map[string]interface{}{
+			"title":   revision.Title,
+			"descr":   revision.Descr,
+			"content": revision.Content,
+			"status":  status,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("entity = ? AND entity_id = ?", models.TranslationEntityBlog, blogID).
+			Delete(&models.ContentTranslation{}).Error; err != nil {
+			return err
+		}
+		for field, values := range map[string]models.Multilang{
+			"title":   revision.MultilangTitle,
+			"descr":   revision.MultilangDescr,
+			"content": revision.MultilangContent,
+		} {
+			if err := SaveTranslations(tx, models.TranslationEntityBlog, blogID, field, values); err != nil {
+				return err
+			}
+		}
+
+		hashtags := []models.Hashtags{}
+		for _, tag := range revision.Hashtags.Data() {
+			hashtag := models.Hashtags{}
+			if err := tx.Where("hashtag = ?", tag).FirstOrCreate(&hashtag, models.Hashtags{Hashtag: tag}).Error; err != nil {
+				return err
+			}
+			hashtags = append(hashtags, hashtag)
+		}
+		if err := tx.Model(&blog).Association("Hashtags").Replace(hashtags); err != nil {
+			return err
+		}
+
+		cities := []models.City{}
+		for _, id := range revision.Cities.Data() {
+			cities = append(cities, models.City{ID: id})
+		}
+		if err := tx.Model(&blog).Association("City").Replace(cities); err != nil {
+			return err
+		}
+
+		categories := []models.Guilds{}
+		for _, id := range revision.Categories.Data() {
+			categories = append(categories, models.Guilds{ID: id})
+		}
+		if err := tx.Model(&blog).Association("Catygory").Replace(categories); err != nil {
+			return err
+		}
+
+		// Photos added after the revision are dropped, the others get their
+		// files back; rows deleted meanwhile are recreated with the old ID.
+		ids := []uint64{}
+		for _, photo := range revision.Photos.Data() {
+			ids = append(ids, photo.ID)
+
+			var files pgtype.JSONB
+			if err := files.Set([]byte(photo.Files)); err != nil {
+				return err
+			}
+
+			row := models.BlogPhoto{ID: photo.ID}
+			result := tx.Model(&row).Where("blog_id = ?", blogID).Update("files", files)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				now := time.Now()
+				if err := tx.Create(&models.BlogPhoto{
+					ID:        photo.ID,
+					BlogID:    blogID,
+					CreatedAt: now,
+					UpdatedAt: now,
+					Files:     files,
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		drop := tx.Where("blog_id = ?", blogID)
+		if len(ids) > 0 {
+			drop = drop.Where("id NOT IN ?", ids)
+		}
+		return drop.Delete(&models.BlogPhoto{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("blog revision: restore: %w", err)
+	}
+
+	// Languages added since the revision was taken are translated again
+	if err := TranslateFields(models.TranslationEntityBlog, blogID, "title", "descr", "content"); err != nil {
+		log.Printf("blog revision: translate %d: %s", blogID, err)
+	}
+
+	if err := InvalidateRelatedBlogs(blogID); err != nil {
+		log.Printf("blog revision: related %d: %s", blogID, err)
+	}
+
+	PruneBlogRevisions(blogID)
+	return nil
+}
+
+// PruneBlogRevisions deletes all but the newest BlogRevisionLimit
+// revisions of a blog together with files only they referenced.
+func PruneBlogRevisions(blogID uint64) {
+	var old []models.BlogRevision
+	if err := initializers.DB.
+		Where("blog_id = ?", blogID).
+		Order("number DESC").
+		Offset(BlogRevisionLimit).
+		Find(&old).Error; err != nil {
+		log.Printf("blog revision: prune %d: %s", blogID, err)
+		return
+	}
+	if len(old) == 0 {
+		return
+	}
+
+	var paths []string
+	ids := make([]uint64, len(old))
+	for i := range old {
+		ids[i] = old[i].ID
+		paths = append(paths, revisionPhotoPaths(&old[i])...)
+	}
+
+	if err := initializers.DB.Where("id IN ?", ids).Delete(&models.BlogRevision{}).Error; err != nil {
+		log.Printf("blog revision: prune %d: %s", blogID, err)
+		return
+	}
+
+	ReleaseBlogFiles(blogID, paths)
+}
+
+// DeleteBlogRevisions removes the history of a deleted blog and the files
+// only it referenced. The blog photos must be deleted before.
+func DeleteBlogRevisions(blogID uint64) error {
+	var revisions []models.BlogRevision
+	if err := initializers.DB.Where("blog_id = ?", blogID).Find(&revisions).Error; err != nil {
+		return err
+	}
+
+	var paths []string
+	for i := range revisions {
+		paths = append(paths, revisionPhotoPaths(&revisions[i])...)
+	}
+
+	if err := initializers.DB.Where("blog_id = ?", blogID).Delete(&models.BlogRevision{}).Error; err != nil {
+		return err
+	}
+
+	ReleaseBlogFiles(blogID, paths)
+	return nil
+}
+
+// ReleaseBlogFiles deletes those of paths that neither the blog photos nor
+// a revision of the blog reference any more.
+func ReleaseBlogFiles(blogID uint64, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+
+	var photos []models.BlogPhoto
+	var revisions []models.BlogRevision
+	if err := initializers.DB.Where("blog_id = ?", blogID).Find(&photos).Error; err != nil {
+		log.Printf("blog revision: release files of %d: %s", blogID, err)
+		return
+	}
+	if err := initializers.DB.Where("blog_id = ?", blogID).Find(&revisions).Error; err != nil {
+		log.Printf("blog revision: release files of %d: %s", blogID, err)
+		return
+	}
+
+	used := map[string]bool{}
+	for _, photo := range photos {
+		for _, path := range filePaths(photo.Files.Bytes) {
+			used[path] = true
+		}
+	}
+	for i := range revisions {
+		for _, path := range revisionPhotoPaths(&revisions[i]) {
+			used[path] = true
+		}
+	}
+
+	config, _ := initializers.LoadConfig(".")
+	for _, path := range paths {
+		if path == "" || used[path] {
+			continue
+		}
+		used[path] = true
+		if err := os.Remove(filepath.Join(config.IMGStorePath, path)); err != nil && !os.IsNotExist(err) {
+			log.Printf("blog revision: remove %s: %s", path, err)
+		}
+	}
+}
+
+func blogRevisionOf(blog *models.Blog) *models.BlogRevision {
+	hashtags := make([]string, len(blog.Hashtags))
+	for i, tag := range blog.Hashtags {
+		hashtags[i] = tag.Hashtag
+	}
+
+	cities := make([]uint, len(blog.City))
+	for i, city := range blog.City {
+		cities[i] = city.ID
+	}
+
+	categories := make([]uint, len(blog.Catygory))
+	for i, category := range blog.Catygory {
+		categories[i] = category.ID
+	}
+
+	photos := make([]models.BlogRevisionPhoto, len(blog.Photos))
+	for i, photo := range blog.Photos {
+		files := json.RawMessage("[]")
+		if len(photo.Files.Bytes) > 0 {
+			files = json.RawMessage(photo.Files.Bytes)
+		}
+		photos[i] = models.BlogRevisionPhoto{ID: photo.ID, Files: files}
+	}
+
+	return &models.BlogRevision{
+		BlogID:           blog.ID,
+		Title:            blog.Title,
+		Descr:            blog.Descr,
+		Content:          blog.Content,
+		MultilangTitle:   blog.MultilangTitle,
+		MultilangDescr:   blog.MultilangDescr,
+		MultilangContent: blog.MultilangContent,
+		Hashtags:         datatypes.NewJSONType(hashtags),
+		Cities:           datatypes.NewJSONType(cities),
+		Categories:       datatypes.NewJSONType(categories),
+		Photos:           datatypes.NewJSONType(photos),
+		CreatedAt:        time.Now(),
+	}
+}
+
+func revisionPhotoPaths(revision *models.BlogRevision) []string {
+	paths := []string{}
+	for _, photo := range revision.Photos.Data() {
+		paths = append(paths, filePaths(photo.Files)...)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// filePaths reads the paths of a blog photo files column.
+func filePaths(data []byte) []string {
+	var files []struct {
+		Path string `json:"path"`
+	}
+	_ = json.Unmarshal(data, &files)
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.Path != "" {
+			paths = append(paths, file.Path)
+		}
+	}
+	return paths
+}
+
+func sortedStrings(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func sortedUints(values []uint) []uint {
+	sorted := append([]uint{}, values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"hyperpage/models"
+
+	"gorm.io/datatypes"
+)
+
+func TestDiffBlogRevisions(t *testing.T) {
+	base := func() *models.BlogRevision {
+		return &models.BlogRevision{
+			Title:          "Flat",
+			Descr:          "Two rooms",
+			MultilangTitle: models.Multilang{"en": "Flat", "ru": "Квартира"},
+			Hashtags:       datatypes.NewJSONType([]string{"sea", "city"}),
+			Cities:         datatypes.NewJSONType([]uint{2, 1}),
+			Categories:     datatypes.NewJSONType([]uint{5}),
+			Photos: datatypes.NewJSONType([]models.BlogRevisionPhoto{
+				{ID: 1, Files: json.RawMessage(`[{"path":"a.jpg"}]`)},
+			}),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*models.BlogRevision)
+		want   []models.BlogRevisionChange
+	}{
+		{name: "unchanged", modify: func(*models.BlogRevision) {}, want: []models.BlogRevisionChange{}},
+		{
+			name: "reordered lists",
+			modify: func(r *models.BlogRevision) {
+				r.Hashtags = datatypes.NewJSONType([]string{"city", "sea"})
+				r.Cities = datatypes.NewJSONType([]uint{1, 2})
+			},
+			want: []models.BlogRevisionChange{},
+		},
+		{
+			name:   "title",
+			modify: func(r *models.BlogRevision) { r.Title = "House" },
+			want:   []models.BlogRevisionChange{{Field: "title", From: "Flat", To: "House"}},
+		},
+		{
+			name: "translations",
+			modify: func(r *models.BlogRevision) {
+				r.MultilangTitle = models.Multilang{"en": "Flat", "es": "Piso"}
+			},
+			want: []models.BlogRevisionChange{
+				{Field: "multilang_title.es", From: "", To: "Piso"},
+				{Field: "multilang_title.ru", From: "Квартира", To: ""},
+			},
+		},
+		{
+			name: "categories and photos",
+			modify: func(r *models.BlogRevision) {
+				r.Categories = datatypes.NewJSONType([]uint{5, 6})
+				r.Photos = datatypes.NewJSONType([]models.BlogRevisionPhoto{
+					{ID: 1, Files: json.RawMessage(`[{"path":"a.jpg"}]`)},
+					{ID: 2, Files: json.RawMessage(`[{"path":"b.jpg"}]`)},
+				})
+			},
+			want: []models.BlogRevisionChange{
+				{Field: "categories", From: []uint{5}, To: []uint{5, 6}},
+				{Field: "photos", From: []string{"a.jpg"}, To: []string{"a.jpg", "b.jpg"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := base(), base()
+			tt.modify(to)
+			if got := DiffBlogRevisions(from, to); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("DiffBlogRevisions = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
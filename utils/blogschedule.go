@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	"gorm.io/gorm"
+)
+
+// Blogs can be created with a publish_at in the future and an optional
+// unpublish_at. The publication is paid when it is scheduled, so a
+// cancelled one is refunded. RunBlogSchedule activates due blogs and
+// archives the ones whose unpublish_at has passed; it runs every minute.
+const BlogScheduleInterval = time.Minute
+
+var (
+	ErrPublishAtInPast        = errors.New("publish_at must be in the future")
+	ErrUnpublishBeforePublish = errors.New("unpublish_at must be after the publication time")
+	ErrBlogNotScheduled       = errors.New("blog is not scheduled")
+)
+
+// ValidateBlogSchedule checks the times of a new or changed schedule.
+// publishAt is nil for a blog published immediately.
+func ValidateBlogSchedule(publishAt, unpublishAt *time.Time) error {
+	now := time.Now()
+	if publishAt != nil && !publishAt.After(now) {
+		return ErrPublishAtInPast
+	}
+
+	start := now
+	if publishAt != nil {
+		start = *publishAt
+	}
+	if unpublishAt != nil && !unpublishAt.After(start) {
+		return ErrUnpublishBeforePublish
+	}
+
+	return nil
+}
+
+// BlogExpiry returns when a blog published at from expires. 10 days stands
+// for an unlimited publication.
+func BlogExpiry(from time.Time, days int) time.Time {
+	if days == 10 {
+		return from.AddDate(10, 0, 0)
+	}
+	return from.AddDate(0, 0, days)
+}
+
+func RunBlogSchedule() {
+	PublishScheduledBlogs()
+	UnpublishBlogs()
+}
+
+// PublishScheduledBlogs activates scheduled blogs whose publish time has
+// come. Blogs of accounts pending deletion wait until the account is
+// restored or purged.
+func PublishScheduledBlogs() {
+	var blogs []models.Blog
+	if err := initializers.DB.
+		Joins("JOIN users ON users.id = blogs.user_id").
+		Where("blogs.status = ? AND blogs.publish_at <= ?", models.BlogStatusScheduled, time.Now()).
+		Where("users.deletion_requested_at IS NULL").
+		Find(&blogs).Error; err != nil {
+		log.Printf("blog schedule: %s", err)
+		return
+	}
+
+	for i := range blogs {
+		if err := activateScheduledBlog(&blogs[i]); err != nil {
+			log.Printf("blog schedule: publish %d: %s", blogs[i].ID, err)
+		}
+	}
+}
+
+// UnpublishBlogs archives active blogs whose unpublish_at has passed.
+func UnpublishBlogs() {
+	now := time.Now()
+	if err := initializers.DB.Model(&models.Blog{}).
+		Where("status = ? AND unpublish_at <= ?", "ACTIVE", now).
+		Updates(map[string]interface{}{
+			"status":     "ARCHIVED",
+			"expired_at": now,
+		}).Error; err != nil {
+		log.Printf("blog schedule: unpublish: %s", err)
+	}
+}
+
+func activateScheduledBlog(blog *models.Blog) error {
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", blog.UserID).Error; err != nil {
+		return err
+	}
+
+	// Under pre-moderation the blog goes to the review queue instead, the
+	// expiry is set on approval
+	updates := map[string]interface{}{"status": models.BlogStatusPendingReview}
+	live := !BlogNeedsReview(&user)
+	if live {
+		now := time.Now()
+		// created_at is moved so the blog is listed among the newest
+		updates = map[string]interface{}{
+			"status":     "ACTIVE",
+			"expired_at": BlogExpiry(now, blog.Days),
+			"created_at": now,
+		}
+	}
+
+	// The status condition keeps a blog cancelled in the meantime, or taken
+	// by a concurrent run, from being published
+	result := initializers.DB.Model(&models.Blog{}).
+		Where("id = ? AND status = ?", blog.ID, models.BlogStatusScheduled).
+		Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 || !live {
+		return result.Error
+	}
+
+	return SendBlogMessageToClients("newblog", user.Name)
+}
+
+// CancelScheduledBlog cancels a blog that is not published yet and refunds
+// its publication.
+func CancelScheduledBlog(blog *models.Blog) (float64, error) {
+	var refunded float64
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Blog{}).
+			Where("id = ? AND status = ?", blog.ID, models.BlogStatusScheduled).
+			Update("status", models.BlogStatusCancelled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrBlogNotScheduled
+		}
+
+		var err error
+		refunded, err = refundElementCharges(tx, blog.UserID, "blog", blog.ID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	blog.Status = models.BlogStatusCancelled
+
+	return refunded, nil
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateBlogSchedule(t *testing.T) {
+	at := func(d time.Duration) *time.Time {
+		v := time.Now().Add(d)
+		return &v
+	}
+	inAnHour := at(time.Hour)
+
+	tests := []struct {
+		name        string
+		publishAt   *time.Time
+		unpublishAt *time.Time
+		want        error
+	}{
+		{name: "immediate"},
+		{name: "scheduled", publishAt: at(time.Hour)},
+		{name: "scheduled with end", publishAt: at(time.Hour), unpublishAt: at(2 * time.Hour)},
+		{name: "immediate with end", unpublishAt: at(time.Hour)},
+		{name: "publish in past", publishAt: at(-time.Minute), want: ErrPublishAtInPast},
+		{name: "end before publish", publishAt: at(2 * time.Hour), unpublishAt: at(time.Hour), want: ErrUnpublishBeforePublish},
+		{name: "end at publish", publishAt: inAnHour, unpublishAt: inAnHour, want: ErrUnpublishBeforePublish},
+		{name: "end in past", unpublishAt: at(-time.Minute), want: ErrUnpublishBeforePublish},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateBlogSchedule(tt.publishAt, tt.unpublishAt); err != tt.want {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
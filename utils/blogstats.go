@@ -0,0 +1,309 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Blog activity is counted in Redis per UTC hour and rolled up into
+// blog_hourly_stats and blog_daily_stats every BlogStatsInterval. Unique
+// visitors of a day are estimated with a HyperLogLog of the viewers. The
+// rollup writes absolute counts, so running it again is harmless; an hour is
+// forgotten once it is over and stored.
+//
+// Redis layout:
+//
+//	blog_stats:<blog id>:<yyyymmddhh>     hash of event counters for the hour
+//	blog_visitors:<blog id>:<yyyymmdd>    HyperLogLog of the day's viewers
+//	blog_stats_dirty                      set of <blog id>:<yyyymmddhh> to roll up
+const (
+	BlogStatsInterval = time.Hour
+	// Keys outlive a few failed rollups
+	blogStatsKeyTTL          = 72 * time.Hour
+	blogHourlyStatsRetention = 90 * 24 * time.Hour
+
+	blogStatsKeyPrefix    = "blog_stats:"
+	blogVisitorsKeyPrefix = "blog_visitors:"
+	blogStatsDirtyKey     = "blog_stats_dirty"
+	blogStatsHourLayout   = "2006010215"
+	blogStatsDayLayout    = "20060102"
+)
+
+// Blog activity events.
+const (
+	BlogEventView       = "views"
+	BlogEventImpression = "impressions"
+	BlogEventFavorite   = "favorites"
+	BlogEventVote       = "votes"
+	BlogEventChat       = "chats"
+)
+
+// Stats intervals of /blog/:id/stats and the longest range served for each.
+const (
+	BlogStatsHour = "hour"
+	BlogStatsDay  = "day"
+
+	BlogStatsMaxHours = 31 * 24
+	BlogStatsMaxDays  = 366
+)
+
+var ErrBlogStatsRange = errors.New("invalid stats range")
+
+// RecordBlogView counts a view of the blog page and its viewer among the
+// day's unique visitors.
+func RecordBlogView(blogID uint64, visitor string) {
+	now := time.Now().UTC()
+	visitorsKey := blogVisitorsKeyPrefix + strconv.FormatUint(blogID, 10) + ":" + now.Format(blogStatsDayLayout)
+
+	_, err := initializers.RedisClient.Pipelined(context.TODO(), func(pipe redis.Pipeliner) error {
+		incrBlogEvent(pipe, blogID, BlogEventView, now)
+		pipe.PFAdd(context.TODO(), visitorsKey, visitor)
+		pipe.Expire(context.TODO(), visitorsKey, blogStatsKeyTTL)
+		return nil
+	})
+	if err != nil {
+		log.Printf("blog stats: record view of %d: %s", blogID, err)
+	}
+}
+
+// RecordBlogEvent counts one event of the given kind for each blog.
+func RecordBlogEvent(event string, blogIDs ...uint64) {
+	if len(blogIDs) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	_, err := initializers.RedisClient.Pipelined(context.TODO(), func(pipe redis.Pipeliner) error {
+		for _, id := range blogIDs {
+			incrBlogEvent(pipe, id, event, now)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("blog stats: record %s: %s", event, err)
+	}
+}
+
+// BlogVisitorID identifies the viewer of a public page: the signed-in user,
+// or a hash of the client address and browser.
+func BlogVisitorID(c *fiber.Ctx) string {
+	if user, ok := c.Locals("user").(models.UserResponse); ok {
+		return "user:" + user.ID.String()
+	}
+	sum := sha256.Sum256([]byte(ClientIP(c) + "|" + c.Get(fiber.HeaderUserAgent)))
+	return "anon:" + hex.EncodeToString(sum[:16])
+}
+
+func incrBlogEvent(pipe redis.Pipeliner, blogID uint64, event string, now time.Time) {
+	bucket := strconv.FormatUint(blogID, 10) + ":" + now.Format(blogStatsHourLayout)
+	pipe.HIncrBy(context.TODO(), blogStatsKeyPrefix+bucket, event, 1)
+	pipe.Expire(context.TODO(), blogStatsKeyPrefix+bucket, blogStatsKeyTTL)
+	pipe.SAdd(context.TODO(), blogStatsDirtyKey, bucket)
+}
+
+// RollupBlogStats stores the Redis counters in the hourly and daily tables.
+func RollupBlogStats() {
+	ctx := context.TODO()
+	currentHour := time.Now().UTC().Truncate(time.Hour)
+
+	buckets, err := initializers.RedisClient.SMembers(ctx, blogStatsDirtyKey).Result()
+	if err != nil {
+		log.Printf("blog stats: rollup: %s", err)
+		return
+	}
+
+	days := map[string]models.BlogDailyStat{}
+	for _, bucket := range buckets {
+		blogID, hour, err := parseBlogStatsBucket(bucket)
+		if err != nil {
+			log.Printf("blog stats: rollup: bad bucket %q", bucket)
+			initializers.RedisClient.SRem(ctx, blogStatsDirtyKey, bucket)
+			continue
+		}
+
+		counters, err := initializers.RedisClient.HGetAll(ctx, blogStatsKeyPrefix+bucket).Result()
+		if err != nil {
+			log.Printf("blog stats: rollup %s: %s", bucket, err)
+			continue
+		}
+		if len(counters) > 0 {
+			if err := saveBlogHourlyStat(blogID, hour, counters); err != nil {
+				log.Printf("blog stats: rollup %s: %s", bucket, err)
+				continue
+			}
+			day := hour.Truncate(24 * time.Hour)
+			days[fmt.Sprintf("%d:%s", blogID, day.Format(blogStatsDayLayout))] = models.BlogDailyStat{BlogID: blogID, Day: day}
+		}
+
+		// The current hour is still being counted
+		if hour.Before(currentHour) {
+			initializers.RedisClient.SRem(ctx, blogStatsDirtyKey, bucket)
+		}
+	}
+
+	for _, day := range days {
+		if err := saveBlogDailyStat(day.BlogID, day.Day); err != nil {
+			log.Printf("blog stats: rollup day %d %s: %s", day.BlogID, day.Day.Format(blogStatsDayLayout), err)
+		}
+	}
+
+	if err := initializers.DB.Where("hour < ?", time.Now().Add(-blogHourlyStatsRetention)).
+		Delete(&models.BlogHourlyStat{}).Error; err != nil {
+		log.Printf("blog stats: prune: %s", err)
+	}
+}
+
+func parseBlogStatsBucket(bucket string) (uint64, time.Time, error) {
+	blog, hour, ok := strings.Cut(bucket, ":")
+	if !ok {
+		return 0, time.Time{}, fmt.Errorf("no hour")
+	}
+	blogID, err := strconv.ParseUint(blog, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	at, err := time.ParseInLocation(blogStatsHourLayout, hour, time.UTC)
+	return blogID, at, err
+}
+
+func saveBlogHourlyStat(blogID uint64, hour time.Time, counters map[string]string) error {
+	count := func(event string) int64 {
+		n, _ := strconv.ParseInt(counters[event], 10, 64)
+		return n
+	}
+
+	stat := models.BlogHourlyStat{
+		BlogID:      blogID,
+		Hour:        hour,
+		Views:       count(BlogEventView),
+		Impressions: count(BlogEventImpression),
+		Favorites:   count(BlogEventFavorite),
+		Votes:       count(BlogEventVote),
+		Chats:       count(BlogEventChat),
+	}
+	return initializers.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "blog_id"}, {Name: "hour"}},
+		DoUpdates: clause.AssignmentColumns([]string{"views", "impressions", "favorites", "votes", "chats"}),
+	}).Create(&stat).Error
+}
+
+// saveBlogDailyStat sums the stored hours of a day. The visitor count only
+// grows during a day, so an expired HyperLogLog does not reset it.
+func saveBlogDailyStat(blogID uint64, day time.Time) error {
+	stat := models.BlogDailyStat{BlogID: blogID, Day: day}
+	if err := initializers.DB.Model(&models.BlogHourlyStat{}).
+		Select("COALESCE(SUM(views), 0) AS views, COALESCE(SUM(impressions), 0) AS impressions, "+
+			"COALESCE(SUM(favorites), 0) AS favorites, COALESCE(SUM(votes), 0) AS votes, COALESCE(SUM(chats), 0) AS chats").
+		Where("blog_id = ? AND hour >= ? AND hour < ?", blogID, day, day.Add(24*time.Hour)).
+		Scan(&stat).Error; err != nil {
+		return err
+	}
+	stat.BlogID, stat.Day = blogID, day
+
+	visitors, err := initializers.RedisClient.PFCount(context.TODO(),
+		blogVisitorsKeyPrefix+strconv.FormatUint(blogID, 10)+":"+day.Format(blogStatsDayLayout)).Result()
+	if err != nil {
+		return err
+	}
+	stat.UniqueVisitors = visitors
+
+	return initializers.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "blog_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"views":           clause.Column{Table: "excluded", Name: "views"},
+			"impressions":     clause.Column{Table: "excluded", Name: "impressions"},
+			"favorites":       clause.Column{Table: "excluded", Name: "favorites"},
+			"votes":           clause.Column{Table: "excluded", Name: "votes"},
+			"chats":           clause.Column{Table: "excluded", Name: "chats"},
+			"unique_visitors": gorm.Expr("GREATEST(blog_daily_stats.unique_visitors, excluded.unique_visitors)"),
+		}),
+	}).Create(&stat).Error
+}
+
+// DeleteBlogStats removes the stored activity of a blog and keeps its
+// pending counters from being rolled up again; the keys expire on their own.
+func DeleteBlogStats(blogID uint64) error {
+	prefix := strconv.FormatUint(blogID, 10) + ":"
+	buckets, err := initializers.RedisClient.SMembers(context.TODO(), blogStatsDirtyKey).Result()
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		if strings.HasPrefix(bucket, prefix) {
+			initializers.RedisClient.SRem(context.TODO(), blogStatsDirtyKey, bucket)
+		}
+	}
+
+	if err := initializers.DB.Where("blog_id = ?", blogID).Delete(&models.BlogHourlyStat{}).Error; err != nil {
+		return err
+	}
+	return initializers.DB.Where("blog_id = ?", blogID).Delete(&models.BlogDailyStat{}).Error
+}
+
+// BlogStatsSeries returns one point per hour or day from from to to, both
+// truncated to the interval; steps without activity are zero.
+func BlogStatsSeries(blogID uint64, interval string, from, to time.Time) ([]models.BlogStatsPoint, error) {
+	step, limit := time.Hour, BlogStatsMaxHours
+	if interval == BlogStatsDay {
+		step, limit = 24*time.Hour, BlogStatsMaxDays
+	} else if interval != BlogStatsHour {
+		return nil, ErrBlogStatsRange
+	}
+	from, to = from.UTC().Truncate(step), to.UTC().Truncate(step)
+	if to.Before(from) || int(to.Sub(from)/step) >= limit {
+		return nil, ErrBlogStatsRange
+	}
+
+	points := map[time.Time]models.BlogStatsPoint{}
+	if interval == BlogStatsDay {
+		var stats []models.BlogDailyStat
+		if err := initializers.DB.Where("blog_id = ? AND day BETWEEN ? AND ?", blogID, from, to).Find(&stats).Error; err != nil {
+			return nil, err
+		}
+		for _, s := range stats {
+			visitors := s.UniqueVisitors
+			day := s.Day.UTC()
+			points[time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)] = models.BlogStatsPoint{
+				Views: s.Views, UniqueVisitors: &visitors, Impressions: s.Impressions,
+				Favorites: s.Favorites, Votes: s.Votes, Chats: s.Chats,
+			}
+		}
+	} else {
+		var stats []models.BlogHourlyStat
+		if err := initializers.DB.Where("blog_id = ? AND hour BETWEEN ? AND ?", blogID, from, to).Find(&stats).Error; err != nil {
+			return nil, err
+		}
+		for _, s := range stats {
+			points[s.Hour.UTC()] = models.BlogStatsPoint{
+				Views: s.Views, Impressions: s.Impressions,
+				Favorites: s.Favorites, Votes: s.Votes, Chats: s.Chats,
+			}
+		}
+	}
+
+	series := make([]models.BlogStatsPoint, 0, int(to.Sub(from)/step)+1)
+	for at := from; !at.After(to); at = at.Add(step) {
+		point := points[at]
+		point.Time = at
+		if interval == BlogStatsDay && point.UniqueVisitors == nil {
+			point.UniqueVisitors = new(int64)
+		}
+		series = append(series, point)
+	}
+	return series, nil
+}
@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Blog prices are stored in the currency of the blog. Listings convert them
+// with currency_rates, which hold the value of a unit of every currency in
+// the base currency. Rates come from admins or from CURRENCY_RATES_FILE,
+// reloaded every CurrencyRatesInterval; an admin's rate wins over the file.
+const (
+	DefaultBaseCurrency   = "RUB"
+	CurrencyRatesInterval = time.Hour
+)
+
+var (
+	ErrCurrencyUnknown = errors.New("unknown currency")
+	ErrCurrencyBase    = errors.New("the rate of the base currency is always 1")
+)
+
+// BlogPriceSQL is the price of a blog in the currency whose rate is its var,
+// NULL when the blog's currency has no rate.
+const BlogPriceSQL = "(blogs.total * (SELECT r.rate FROM currency_rates r WHERE r.code = blogs.currency) / ?)"
+
+// BaseCurrency is the currency rates are expressed in.
+func BaseCurrency() string {
+	config, _ := initializers.LoadConfig(".")
+	if code := NormalizeCurrency(config.BaseCurrency); code != "" {
+		return code
+	}
+	return DefaultBaseCurrency
+}
+
+// NormalizeCurrency upper-cases a currency code.
+func NormalizeCurrency(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CurrencyRates returns the rates keyed by currency code, the base currency
+// included.
+func CurrencyRates() (map[string]float64, error) {
+	var rows []models.CurrencyRate
+	if err := initializers.DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	rates := make(map[string]float64, len(rows)+1)
+	for _, row := range rows {
+		rates[row.Code] = row.Rate
+	}
+	rates[BaseCurrency()] = 1
+	return rates, nil
+}
+
+// BlogCurrency checks the currency of a new or edited blog and returns its
+// code, the base currency when none is given.
+func BlogCurrency(code string) (string, error) {
+	code = NormalizeCurrency(code)
+	if code == "" {
+		return BaseCurrency(), nil
+	}
+
+	rates, err := CurrencyRates()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := rates[code]; !ok {
+		return "", ErrCurrencyUnknown
+	}
+	return code, nil
+}
+
+// ConvertPrice converts amount from one currency to another, rounded to
+// cents. It returns nil when either currency has no rate.
+func ConvertPrice(amount float64, from, to string, rates map[string]float64) *float64 {
+	fromRate, ok := rates[from]
+	if !ok {
+		return nil
+	}
+	toRate, ok := rates[to]
+	if !ok || toRate == 0 {
+		return nil
+	}
+	converted := math.Round(amount*fromRate/toRate*100) / 100
+	return &converted
+}
+
+// OrderBlogsByPrice sorts query by the price of the blogs converted with
+// rate, then by thenBy. Blogs whose currency has no rate come last.
+func OrderBlogsByPrice(query *gorm.DB, rate float64, desc bool, thenBy string) *gorm.DB {
+	direction := " ASC"
+	if desc {
+		direction = " DESC"
+	}
+	return query.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:                BlogPriceSQL + direction + " NULLS LAST, " + thenBy,
+		Vars:               []interface{}{rate},
+		WithoutParentheses: true,
+	}})
+}
+
+// SetCurrencyRate sets the rate of a currency on behalf of an admin.
+func SetCurrencyRate(code string, rate float64) (*models.CurrencyRate, error) {
+	code = NormalizeCurrency(code)
+	if code == BaseCurrency() {
+		return nil, ErrCurrencyBase
+	}
+
+	row := models.CurrencyRate{Code: code, Rate: rate, Source: models.CurrencyRateSourceManual, UpdatedAt: time.Now()}
+	if err := initializers.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "updated_at"}),
+	}).Create(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// DeleteCurrencyRate removes the rate of a currency. Blogs priced in it are
+// no longer converted until it gets a rate again.
+func DeleteCurrencyRate(code string) error {
+	code = NormalizeCurrency(code)
+	if code == BaseCurrency() {
+		return ErrCurrencyBase
+	}
+
+	result := initializers.DB.Where("code = ?", code).Delete(&models.CurrencyRate{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCurrencyUnknown
+	}
+	return nil
+}
+
+// LoadCurrencyRatesFile stores the rates of a CSV of "code,rate" lines. A
+// header line and lines starting with # are skipped. Rates set by an admin
+// are left alone. It returns the number of rates read.
+func LoadCurrencyRatesFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	rows, err := parseCurrencyRates(f, BaseCurrency())
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	err = initializers.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "currency_rates.source = ?", Vars: []interface{}{models.CurrencyRateSourceFeed}},
+		}},
+	}).Create(&rows).Error
+	return len(rows), err
+}
+
+// parseCurrencyRates reads the rates of a rates file, leaving out the base
+// currency.
+func parseCurrencyRates(r io.Reader, base string) ([]models.CurrencyRate, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	now := time.Now()
+	rows := []models.CurrencyRate{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("currency rates: line %d: expected code,rate", line)
+		}
+
+		code := NormalizeCurrency(record[0])
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil && line == 1 {
+			continue
+		}
+		if err != nil || rate <= 0 || math.IsInf(rate, 0) || len(code) != 3 {
+			return nil, fmt.Errorf("currency rates: line %d: invalid rate %q for %q", line, record[1], record[0])
+		}
+		if code == base {
+			continue
+		}
+		rows = append(rows, models.CurrencyRate{Code: code, Rate: rate, Source: models.CurrencyRateSourceFeed, UpdatedAt: now})
+	}
+	return rows, nil
+}
+
+// RunCurrencyRatesFeed reloads CURRENCY_RATES_FILE when one is configured.
+func RunCurrencyRatesFeed() {
+	config, _ := initializers.LoadConfig(".")
+	if config.CurrencyRatesFile == "" {
+		return
+	}
+
+	if _, err := LoadCurrencyRatesFile(config.CurrencyRatesFile); err != nil {
+		log.Printf("currency rates: load %s: %s", config.CurrencyRatesFile, err)
+	}
+}
+
+// MigrateBlogCurrency stores the base currency with a rate of 1 and gives
+// it to the blogs that have no currency yet. It is safe to run repeatedly.
+func MigrateBlogCurrency() error {
+	base := BaseCurrency()
+	if err := initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.CurrencyRate{
+		Code:      base,
+		Rate:      1,
+		Source:    models.CurrencyRateSourceManual,
+		UpdatedAt: time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("currency: seed %s: %w", base, err)
+	}
+
+	if err := initializers.DB.Exec("UPDATE blogs SET currency = ? WHERE currency = ''", base).Error; err != nil {
+		return fmt.Errorf("currency: set blog currency: %w", err)
+	}
+	return nil
+}
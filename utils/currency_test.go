@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hyperpage/models"
+)
+
+func TestConvertPrice(t *testing.T) {
+	rates := map[string]float64{"RUB": 1, "USD": 90, "EUR": 97.5, "XXX": 0}
+	price := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		amount   float64
+		from, to string
+		want     *float64
+	}{
+		{amount: 100, from: "RUB", to: "RUB", want: price(100)},
+		{amount: 10, from: "USD", to: "RUB", want: price(900)},
+		{amount: 900, from: "RUB", to: "USD", want: price(10)},
+		{amount: 100, from: "RUB", to: "USD", want: price(1.11)},
+		{amount: 10, from: "EUR", to: "USD", want: price(10.83)},
+		{amount: 10, from: "GEL", to: "RUB"},
+		{amount: 10, from: "RUB", to: "GEL"},
+		{amount: 10, from: "RUB", to: "XXX"},
+	}
+
+	for _, tt := range tests {
+		got := ConvertPrice(tt.amount, tt.from, tt.to, rates)
+		if !equalFloatPtr(got, tt.want) {
+			t.Errorf("ConvertPrice(%v %s to %s) = %v, want %v", tt.amount, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestParseCurrencyRates(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]float64
+		err   string
+	}{
+		{name: "empty", input: "", want: map[string]float64{}},
+		{
+			name:  "header and comments",
+			input: "code,rate\n# from the central bank\nusd, 90.5\nEUR,97\n",
+			want:  map[string]float64{"USD": 90.5, "EUR": 97},
+		},
+		{name: "base currency is skipped", input: "RUB,1\nUSD,90\n", want: map[string]float64{"USD": 90}},
+		{name: "missing rate", input: "USD\n", err: "line 1: expected code,rate"},
+		{name: "bad rate", input: "USD,90\nEUR,abc\n", err: "line 2: invalid rate"},
+		{name: "negative rate", input: "USD,-1\n", err: "line 1: invalid rate"},
+		{name: "bad code", input: "USD,90\nEURO,97\n", err: "line 2: invalid rate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseCurrencyRates(strings.NewReader(tt.input), "RUB")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]float64{}
+			for _, row := range rows {
+				if row.Source != models.CurrencyRateSourceFeed {
+					t.Fatalf("%s has source %q", row.Code, row.Source)
+				}
+				got[row.Code] = row.Rate
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("rates = %v, want %v", got, tt.want)
+			}
+			for code, rate := range tt.want {
+				if got[code] != rate {
+					t.Fatalf("rates = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadCurrencyRatesFileWithoutRates(t *testing.T) {
+	useTestConfig(t, "BASE_CURRENCY=RUB")
+
+	if _, err := LoadCurrencyRatesFile(filepath.Join(t.TempDir(), "missing.csv")); !os.IsNotExist(err) {
+		t.Fatalf("missing file: error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "rates.csv")
+	if err := os.WriteFile(path, []byte("code,rate\nRUB,1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := LoadCurrencyRatesFile(path); n != 0 || err != nil {
+		t.Fatalf("only the base currency: %d, %v", n, err)
+	}
+
+	if err := os.WriteFile(path, []byte("USD,ninety\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := LoadCurrencyRatesFile(path); n != 0 || err != nil {
+		t.Fatalf("a header alone: %d, %v", n, err)
+	}
+
+	if err := os.WriteFile(path, []byte("code,rate\nUSD,ninety\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCurrencyRatesFile(path); err == nil {
+		t.Fatal("an invalid rate was accepted")
+	}
+}
@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+// Lists are paged by keyset: a cursor holds the sort key of the first or
+// last row of a page and the next page continues strictly after it, which
+// stays fast on deep pages and does not shift when rows are inserted. The
+// cursor is "<payload>.<signature>" where payload is base64url JSON and the
+// signature binds it to the list that issued it. skip/limit keep working
+// for older clients.
+const (
+	DefaultPageLimit = 10
+
+	cursorLinkScope = "cursor"
+)
+
+var ErrCursorInvalid = errors.New("cursor is invalid")
+
+// Keyset is the order of a list. All columns share the direction and the
+// last one must be unique so that every row has a distinct position.
+type Keyset struct {
+	Name    string
+	Columns []string
+	Desc    bool
+}
+
+type PageParams struct {
+	Limit  int
+	Skip   int
+	Cursor string
+}
+
+// CursorPage holds the cursors of the pages around the one returned. An
+// empty cursor means there is no such page.
+type CursorPage struct {
+	Next string
+	Prev string
+}
+
+type pageCursor struct {
+	Values []string `json:"v"`
+	Before bool     `json:"b,omitempty"`
+}
+
+// ParsePageParams reads limit, skip and cursor from the query string.
+func ParsePageParams(c *fiber.Ctx) (PageParams, error) {
+	params := PageParams{Cursor: c.Query("cursor")}
+
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(DefaultPageLimit)))
+	if err != nil || limit < 0 {
+		return params, errors.New("Invalid limit parameter")
+	}
+	params.Limit = limit
+
+	skip, err := strconv.Atoi(c.Query("skip", "0"))
+	if err != nil || skip < 0 {
+		return params, errors.New("Invalid skip parameter")
+	}
+	params.Skip = skip
+
+	return params, nil
+}
+
+// Meta adds the cursors to the meta object of a list response.
+func (p *CursorPage) Meta(meta fiber.Map) fiber.Map {
+	if p.Next != "" {
+		meta["next_cursor"] = p.Next
+	}
+	if p.Prev != "" {
+		meta["prev_cursor"] = p.Prev
+	}
+	return meta
+}
+
+// FindPage loads one page of query ordered by ks. With a cursor the page
+// starts right after (or, for a previous-page cursor, ends right before) the
+// row it was taken from; otherwise params.Skip rows are skipped. key returns
+// the values of ks.Columns for a row. query must not be ordered already.
+func FindPage[T any](query *gorm.DB, ks Keyset, params PageParams, key func(*T) []interface{}) ([]T, *CursorPage, error) {
+	var cursor *pageCursor
+	if params.Cursor != "" {
+		var err error
+		if cursor, err = decodeCursor(ks, params.Cursor); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	backward := cursor != nil && cursor.Before
+	query = query.Order(ks.order(backward))
+	if cursor != nil {
+		values, err := cursor.values()
+		if err != nil {
+			return nil, nil, err
+		}
+		query = query.Where(ks.after(backward), values...)
+	} else if params.Skip > 0 {
+		query = query.Offset(params.Skip)
+	}
+
+	// One extra row tells whether there is a further page
+	rows := []T{}
+	if err := query.Limit(params.Limit + 1).Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	more := len(rows) > params.Limit
+	if more {
+		rows = rows[:params.Limit]
+	}
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	page := &CursorPage{}
+	if len(rows) == 0 {
+		return rows, page, nil
+	}
+
+	// Going back, the page we came from is always ahead
+	var err error
+	if more || backward {
+		if page.Next, err = encodeCursor(ks, key(&rows[len(rows)-1]), false); err != nil {
+			return nil, nil, err
+		}
+	}
+	if (backward && more) || (!backward && (cursor != nil || params.Skip > 0)) {
+		if page.Prev, err = encodeCursor(ks, key(&rows[0]), true); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return rows, page, nil
+}
+
+func (ks Keyset) order(backward bool) string {
+	direction := "ASC"
+	if ks.Desc != backward {
+		direction = "DESC"
+	}
+
+	columns := make([]string, len(ks.Columns))
+	for i, column := range ks.Columns {
+		columns[i] = column + " " + direction
+	}
+	return strings.Join(columns, ", ")
+}
+
+// after compares the row against the cursor values, e.g.
+// "(blogs.created_at, blogs.id) < (?, ?)".
+func (ks Keyset) after(backward bool) string {
+	op := ">"
+	if ks.Desc != backward {
+		op = "<"
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ks.Columns)), ", ")
+	return fmt.Sprintf("(%s) %s (%s)", strings.Join(ks.Columns, ", "), op, placeholders)
+}
+
+// Values are tagged with their type so that they decode to the same type:
+// "t:" time, "i:" integer, "s:" string.
+func encodeCursor(ks Keyset, values []interface{}, before bool) (string, error) {
+	cursor := pageCursor{Before: before}
+	for _, value := range values {
+		switch v := value.(type) {
+		case time.Time:
+			cursor.Values = append(cursor.Values, "t:"+v.UTC().Format(time.RFC3339Nano))
+		case int:
+			cursor.Values = append(cursor.Values, "i:"+strconv.FormatInt(int64(v), 10))
+		case int64:
+			cursor.Values = append(cursor.Values, "i:"+strconv.FormatInt(v, 10))
+		case uint:
+			cursor.Values = append(cursor.Values, "i:"+strconv.FormatUint(uint64(v), 10))
+		case uint64:
+			cursor.Values = append(cursor.Values, "i:"+strconv.FormatUint(v, 10))
+		case uuid.UUID:
+			cursor.Values = append(cursor.Values, "s:"+v.String())
+		case string:
+			cursor.Values = append(cursor.Values, "s:"+v)
+		default:
+			return "", fmt.Errorf("cursor %s: unsupported key type %T", ks.Name, value)
+		}
+	}
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("cursor %s: %w", ks.Name, err)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	signature, err := signToken(cursorLinkScope+":"+ks.Name, payload)
+	if err != nil {
+		return "", fmt.Errorf("cursor %s: %w", ks.Name, err)
+	}
+
+	return payload + "." + signature, nil
+}
+
+func decodeCursor(ks Keyset, token string) (*pageCursor, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrCursorInvalid
+	}
+
+	expected, err := signToken(cursorLinkScope+":"+ks.Name, payload)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, ErrCursorInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || len(cursor.Values) != len(ks.Columns) {
+		return nil, ErrCursorInvalid
+	}
+
+	return &cursor, nil
+}
+
+func (c *pageCursor) values() ([]interface{}, error) {
+	values := make([]interface{}, len(c.Values))
+	for i, raw := range c.Values {
+		tag, value, _ := strings.Cut(raw, ":")
+		switch tag {
+		case "t":
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, ErrCursorInvalid
+			}
+			values[i] = t
+		case "i":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, ErrCursorInvalid
+			}
+			values[i] = n
+		case "s":
+			values[i] = value
+		default:
+			return nil, ErrCursorInvalid
+		}
+	}
+	return values, nil
+}
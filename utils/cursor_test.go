@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"hyperpage/initializers"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// useTestConfig runs the test in a directory whose app.env holds lines.
+func useTestConfig(t *testing.T, lines ...string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.env"), []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	useTestConfig(t, "TOKEN_SECRET=test-secret")
+
+	ks := Keyset{Name: "test", Columns: []string{"created_at", "rank", "id", "owner"}, Desc: true}
+	createdAt := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.FixedZone("MSK", 3*3600))
+	owner := uuid.NewV4()
+
+	for _, before := range []bool{false, true} {
+		token, err := encodeCursor(ks, []interface{}{createdAt, 7, uint64(42), owner}, before)
+		if err != nil {
+			t.Fatalf("encodeCursor: %v", err)
+		}
+
+		cursor, err := decodeCursor(ks, token)
+		if err != nil {
+			t.Fatalf("decodeCursor: %v", err)
+		}
+		if cursor.Before != before {
+			t.Fatalf("Before = %v, want %v", cursor.Before, before)
+		}
+		values, err := cursor.values()
+		if err != nil {
+			t.Fatalf("values: %v", err)
+		}
+		want := []interface{}{createdAt.UTC(), int64(7), int64(42), owner.String()}
+		if !reflect.DeepEqual(values, want) {
+			t.Fatalf("values = %#v, want %#v", values, want)
+		}
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	useTestConfig(t, "TOKEN_SECRET=test-secret")
+
+	ks := Keyset{Name: "test", Columns: []string{"id"}}
+	token, err := encodeCursor(ks, []interface{}{uint64(1)}, false)
+	if err != nil {
+		t.Fatalf("encodeCursor: %v", err)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+	forged, err := encodeCursor(ks, []interface{}{uint64(2)}, false)
+	if err != nil {
+		t.Fatalf("encodeCursor: %v", err)
+	}
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	tests := []struct {
+		name  string
+		ks    Keyset
+		token string
+	}{
+		{name: "no signature", ks: ks, token: payload},
+		{name: "tampered signature", ks: ks, token: payload + "." + strings.Repeat("0", len(signature))},
+		{name: "swapped payload", ks: ks, token: forgedPayload + "." + signature},
+		{name: "other list", ks: Keyset{Name: "other", Columns: []string{"id"}}, token: token},
+		{name: "other columns", ks: Keyset{Name: "test", Columns: []string{"created_at", "id"}}, token: token},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.ks, tt.token); err != ErrCursorInvalid {
+				t.Fatalf("error = %v, want %v", err, ErrCursorInvalid)
+			}
+		})
+	}
+}
+
+func TestCursorWithoutSecret(t *testing.T) {
+	useTestConfig(t, "TOKEN_SECRET=")
+
+	ks := Keyset{Name: "test", Columns: []string{"id"}}
+	if token, err := encodeCursor(ks, []interface{}{1}, false); !errors.Is(err, ErrTokenSecretMissing) {
+		t.Errorf("encodeCursor = %q, %v, want %v", token, err, ErrTokenSecretMissing)
+	}
+	if _, err := decodeCursor(ks, "e30.00"); !errors.Is(err, ErrTokenSecretMissing) {
+		t.Errorf("decodeCursor error = %v, want %v", err, ErrTokenSecretMissing)
+	}
+}
+
+func TestEncodeCursorUnsupportedType(t *testing.T) {
+	useTestConfig(t, "TOKEN_SECRET=test-secret")
+
+	if token, err := encodeCursor(Keyset{Name: "test", Columns: []string{"id"}}, []interface{}{1.5}, false); err == nil {
+		t.Errorf("encodeCursor = %q for a float key", token)
+	}
+}
+
+func TestCheckTokenSecret(t *testing.T) {
+	if err := CheckTokenSecret(&initializers.Config{}); err != ErrTokenSecretMissing {
+		t.Errorf("CheckTokenSecret without secret = %v, want %v", err, ErrTokenSecretMissing)
+	}
+	if err := CheckTokenSecret(&initializers.Config{TokenSecret: "test-secret"}); err != nil {
+		t.Errorf("CheckTokenSecret = %v", err)
+	}
+}
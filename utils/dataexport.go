@@ -0,0 +1,380 @@
+package utils
+
+import (
+	"archive/zip"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+)
+
+// A personal data export is built in the background into a zip archive under
+// EXPORT_STORE_PATH. The user receives a signed download link that stays
+// valid for DataExportTTL; the daily cleanup removes expired archives.
+const (
+	DataExportTTL      = 48 * time.Hour
+	DataExportCooldown = 24 * time.Hour
+
+	dataExportStaleAfter = time.Hour
+	dataExportLinkScope  = "data_export"
+)
+
+var ErrDataExportLinkInvalid = errors.New("download link is invalid or has expired")
+
+// BuildDataExport collects the user's data into the archive of export id and
+// mails the download link. It is meant to run in its own goroutine.
+func BuildDataExport(id uint64) {
+	var export models.DataExport
+	if err := initializers.DB.First(&export, "id = ?", id).Error; err != nil {
+		log.Printf("data export %d: %s", id, err)
+		return
+	}
+
+	initializers.DB.Model(&export).Update("status", models.DataExportProcessing)
+
+	fileName, size, err := writeDataExport(&export)
+	if err != nil {
+		log.Printf("data export %d: %s", id, err)
+		initializers.DB.Model(&export).Updates(map[string]interface{}{
+			"status": models.DataExportFailed,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(DataExportTTL)
+	if err := initializers.DB.Model(&export).Updates(map[string]interface{}{
+		"status":     models.DataExportReady,
+		"file_name":  fileName,
+		"size":       size,
+		"ready_at":   now,
+		"expires_at": expiresAt,
+	}).Error; err != nil {
+		log.Printf("data export %d: %s", id, err)
+		return
+	}
+	export.ExpiresAt = &expiresAt
+
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", export.UserID).Error; err != nil {
+		log.Printf("data export %d: %s", id, err)
+		return
+	}
+
+	url, err := DataExportURL(&export)
+	if err != nil {
+		log.Printf("data export %d: %s", id, err)
+		return
+	}
+
+	firstName := user.Name
+	if strings.Contains(firstName, " ") {
+		firstName = strings.Split(firstName, " ")[1]
+	}
+
+	emailData := EmailData{URL: url, FirstName: firstName}
+
+	language := export.Language
+	switch language {
+	case "ru":
+		emailData.Subject = "Архив ваших данных MYRUONLINE готов"
+	case "es":
+		emailData.Subject = "El archivo de sus datos de MYRUONLINE está listo"
+	case "ke":
+		emailData.Subject = "თქვენი MYRUONLINE მონაცემების არქივი მზადაა"
+	default:
+		language = "en"
+		emailData.Subject = "Your MYRUONLINE data archive is ready"
+	}
+
+	if !strings.HasSuffix(user.Email, ".invalid") {
+		SendEmail(&user, &emailData, "dataExport", language)
+	}
+}
+
+// DataExportURL returns the signed download link of a ready export.
+func DataExportURL(export *models.DataExport) (string, error) {
+	if export.ExpiresAt == nil {
+		return "", errors.New("data export is not ready")
+	}
+
+	expires := strconv.FormatInt(export.ExpiresAt.Unix(), 10)
+	signature, err := signToken(dataExportLinkScope, dataExportLinkID(strconv.FormatUint(export.ID, 10), expires))
+	if err != nil {
+		return "", err
+	}
+
+	config, _ := initializers.LoadConfig(".")
+	return fmt.Sprintf("%s/api/users/export/download/%d?expires=%s&signature=%s", config.SERVER_URL, export.ID, expires, signature), nil
+}
+
+// VerifyDataExportLink checks a download link and returns the ready export
+// and the path of its archive.
+func VerifyDataExportLink(id, expires, signature string) (*models.DataExport, string, error) {
+	expected, err := signToken(dataExportLinkScope, dataExportLinkID(id, expires))
+	if err != nil {
+		return nil, "", err
+	}
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, "", ErrDataExportLinkInvalid
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return nil, "", ErrDataExportLinkInvalid
+	}
+
+	export, err := findDataExport(id)
+	if err != nil {
+		return nil, "", ErrDataExportLinkInvalid
+	}
+	if export.Status != models.DataExportReady || export.FileName == "" {
+		return nil, "", ErrDataExportLinkInvalid
+	}
+
+	return export, filepath.Join(dataExportDir(), export.FileName), nil
+}
+
+var findDataExport = func(id string) (*models.DataExport, error) {
+	var export models.DataExport
+	if err := initializers.DB.First(&export, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// CleanupDataExports removes expired archives and fails jobs that were
+// interrupted, e.g. by a restart.
+func CleanupDataExports() {
+	var expired []models.DataExport
+	initializers.DB.Where("status = ? AND expires_at < ?", models.DataExportReady, time.Now()).Find(&expired)
+
+	for _, export := range expired {
+		if export.FileName != "" {
+			if err := os.Remove(filepath.Join(dataExportDir(), export.FileName)); err != nil && !os.IsNotExist(err) {
+				log.Printf("data export %d: %s", export.ID, err)
+				continue
+			}
+		}
+		initializers.DB.Model(&export).Updates(map[string]interface{}{
+			"status":    models.DataExportExpired,
+			"file_name": "",
+		})
+	}
+
+	initializers.DB.Model(&models.DataExport{}).
+		Where("status IN ? AND updated_at < ?", []string{models.DataExportPending, models.DataExportProcessing}, time.Now().Add(-dataExportStaleAfter)).
+		Updates(map[string]interface{}{"status": models.DataExportFailed, "error": "interrupted"})
+}
+
+func dataExportLinkID(id, expires string) string {
+	return id + "." + expires
+}
+
+func dataExportDir() string {
+	config, _ := initializers.LoadConfig(".")
+	if config.ExportStorePath != "" {
+		return config.ExportStorePath
+	}
+	return filepath.Join(os.TempDir(), "hyperpage-exports")
+}
+
+func writeDataExport(export *models.DataExport) (string, int64, error) {
+	config, _ := initializers.LoadConfig(".")
+
+	var user models.User
+	if err := initializers.DB.First(&user, "id = ?", export.UserID).Error; err != nil {
+		return "", 0, fmt.Errorf("load user: %w", err)
+	}
+
+	var profiles []models.Profile
+	var blogs []models.Blog
+	var messages []models.ChatMessage
+	var transactions []models.Transaction
+	var payments []models.Payments
+	var favorites []models.Favorite
+	var notifications []models.Notification
+	var filters []models.Presavedfilters
+
+	queries := []struct {
+		name string
+		err  error
+	}{
+		{"profile", initializers.DB.Preload("Photos").Preload("Documents").Preload("City").Preload("Guilds").Preload("Hashtags").Where("user_id = ?", user.ID).Find(&profiles).Error},
+		{"blogs", initializers.DB.Preload("Photos").Preload("Hashtags").Where("user_id = ?", user.ID).Order("created_at").Find(&blogs).Error},
+		{"chat messages", initializers.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&messages).Error},
+		{"transactions", initializers.DB.Where("user_id = ?", user.ID).Find(&transactions).Error},
+		{"payments", initializers.DB.Where("user_id = ?", user.ID).Find(&payments).Error},
+		{"favorites", initializers.DB.Where("user_id = ?", user.ID).Find(&favorites).Error},
+		{"notifications", initializers.DB.Where("user_id = ?", user.ID).Order("created_at").Find(&notifications).Error},
+		{"saved filters", initializers.DB.Where("user_id = ?", user.ID).Find(&filters).Error},
+	}
+	for _, q := range queries {
+		if q.err != nil {
+			return "", 0, fmt.Errorf("load %s: %w", q.name, q.err)
+		}
+	}
+
+	// Profile coordinates are hidden from the profile JSON
+	locations := make([]map[string]interface{}, 0, len(profiles))
+	for _, profile := range profiles {
+		locations = append(locations, map[string]interface{}{
+			"profile_id": profile.ID,
+			"latitude":   profile.Latitude,
+			"longitude":  profile.Longitude,
+		})
+	}
+
+	documents := map[string]interface{}{
+		"user.json":          models.FilterUserRecord(&user, export.Language),
+		"locations.json":     locations,
+		"profile.json":       profiles,
+		"blogs.json":         blogs,
+		"chat_messages.json": messages,
+		"transactions.json":  transactions,
+		"payments.json":      payments,
+		"favorites.json":     favorites,
+		"notifications.json": notifications,
+		"saved_filters.json": filters,
+	}
+
+	// Only files inside the user's storage directory are exported, paths in
+	// the JSON columns are client supplied.
+	var files []string
+	for _, profile := range profiles {
+		for _, photo := range profile.Photos {
+			files = append(files, uploadedFilePaths(photo.Files.Bytes, user.Storage)...)
+		}
+		for _, document := range profile.Documents {
+			files = append(files, uploadedFilePaths(document.Files.Bytes, user.Storage)...)
+		}
+	}
+	for _, blog := range blogs {
+		for _, photo := range blog.Photos {
+			files = append(files, uploadedFilePaths(photo.Files.Bytes, user.Storage)...)
+		}
+	}
+
+	dir := dataExportDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", 0, fmt.Errorf("create export dir: %w", err)
+	}
+
+	fileName := fmt.Sprintf("%s-%d.zip", user.ID, export.ID)
+	tmp, err := os.CreateTemp(dir, fileName+".*.tmp")
+	if err != nil {
+		return "", 0, fmt.Errorf("create archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	archive := zip.NewWriter(tmp)
+
+	for name, data := range documents {
+		w, err := archive.Create(name)
+		if err != nil {
+			return "", 0, fmt.Errorf("write %s: %w", name, err)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			return "", 0, fmt.Errorf("write %s: %w", name, err)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, file := range files {
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+
+		if err := addFileToArchive(archive, filepath.Join(config.IMGStorePath, file), "files/"+file); err != nil {
+			// A missing upload should not fail the whole export
+			log.Printf("data export %d: %s", export.ID, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return "", 0, fmt.Errorf("close archive: %w", err)
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		return "", 0, fmt.Errorf("stat archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, fmt.Errorf("close archive: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, fileName)); err != nil {
+		return "", 0, fmt.Errorf("save archive: %w", err)
+	}
+
+	return fileName, info.Size(), nil
+}
+
+func addFileToArchive(archive *zip.Writer, src, name string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// uploadedFilePaths returns every "path" value in a files JSON column that
+// points into the storage directory.
+func uploadedFilePaths(data []byte, storage string) []string {
+	if len(data) == 0 || storage == "" {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil
+	}
+
+	var paths []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, item := range v {
+				if p, ok := item.(string); ok && key == "path" {
+					p = path.Clean(strings.TrimPrefix(p, "/"))
+					if strings.HasPrefix(p, storage+"/") {
+						paths = append(paths, p)
+					}
+					continue
+				}
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(value)
+
+	return paths
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"errors"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"hyperpage/models"
+)
+
+func stubDataExports(t *testing.T, exports map[string]models.DataExport) {
+	t.Helper()
+
+	previous := findDataExport
+	findDataExport = func(id string) (*models.DataExport, error) {
+		export, ok := exports[id]
+		if !ok {
+			return nil, errors.New("record not found")
+		}
+		return &export, nil
+	}
+	t.Cleanup(func() { findDataExport = previous })
+}
+
+// signedDataExportLink returns the id, expires and signature query values of
+// the download link built for export.
+func signedDataExportLink(t *testing.T, export *models.DataExport) (string, string, string) {
+	t.Helper()
+
+	link, err := DataExportURL(export)
+	if err != nil {
+		t.Fatalf("DataExportURL: %s", err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parse %q: %s", link, err)
+	}
+	if want := "/api/users/export/download/" + strconv.FormatUint(export.ID, 10); u.Path != want {
+		t.Fatalf("link path = %q, want %q", u.Path, want)
+	}
+	return strconv.FormatUint(export.ID, 10), u.Query().Get("expires"), u.Query().Get("signature")
+}
+
+func TestVerifyDataExportLink(t *testing.T) {
+	useTestConfig(t, "TOKEN_SECRET=test-secret", "EXPORT_STORE_PATH=/exports")
+
+	future := time.Now().Add(time.Hour).Truncate(time.Second)
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	stubDataExports(t, map[string]models.DataExport{
+		"1": {ID: 1, Status: models.DataExportReady, FileName: "one.zip", ExpiresAt: &future},
+		"2": {ID: 2, Status: models.DataExportReady, FileName: "two.zip", ExpiresAt: &future},
+		"3": {ID: 3, Status: models.DataExportProcessing, ExpiresAt: &future},
+		"4": {ID: 4, Status: models.DataExportExpired, FileName: "four.zip", ExpiresAt: &future},
+		"5": {ID: 5, Status: models.DataExportReady, ExpiresAt: &future},
+		"6": {ID: 6, Status: models.DataExportReady, FileName: "six.zip", ExpiresAt: &past},
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		id, expires, signature := signedDataExportLink(t, &models.DataExport{ID: 1, ExpiresAt: &future})
+		export, file, err := VerifyDataExportLink(id, expires, signature)
+		if err != nil {
+			t.Fatalf("VerifyDataExportLink: %s", err)
+		}
+		if export.ID != 1 {
+			t.Errorf("export = %d, want 1", export.ID)
+		}
+		if want := filepath.Join("/exports", "one.zip"); file != want {
+			t.Errorf("file = %q, want %q", file, want)
+		}
+	})
+
+	_, expires, signature := signedDataExportLink(t, &models.DataExport{ID: 1, ExpiresAt: &future})
+	later := strconv.FormatInt(future.Add(24*time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		export    *models.DataExport
+		id        string
+		expires   string
+		signature string
+	}{
+		{name: "tampered id", id: "2", expires: expires, signature: signature},
+		{name: "tampered expiry", id: "1", expires: later, signature: signature},
+		{name: "tampered signature", id: "1", expires: expires, signature: signature[:len(signature)-1] + "x"},
+		{name: "missing signature", id: "1", expires: expires},
+		{name: "expired link", export: &models.DataExport{ID: 6, ExpiresAt: &past}},
+		{name: "not ready", export: &models.DataExport{ID: 3, ExpiresAt: &future}},
+		{name: "expired export", export: &models.DataExport{ID: 4, ExpiresAt: &future}},
+		{name: "no archive", export: &models.DataExport{ID: 5, ExpiresAt: &future}},
+		{name: "unknown export", export: &models.DataExport{ID: 7, ExpiresAt: &future}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, expires, signature := tt.id, tt.expires, tt.signature
+			if tt.export != nil {
+				id, expires, signature = signedDataExportLink(t, tt.export)
+			}
+			if _, _, err := VerifyDataExportLink(id, expires, signature); err != ErrDataExportLinkInvalid {
+				t.Errorf("err = %v, want %v", err, ErrDataExportLinkInvalid)
+			}
+		})
+	}
+}
+
+func TestDataExportURLNotReady(t *testing.T) {
+	useTestConfig(t, "TOKEN_SECRET=test-secret")
+
+	if _, err := DataExportURL(&models.DataExport{ID: 1}); err == nil {
+		t.Error("DataExportURL without expiry succeeded")
+	}
+}
+
+func TestUploadedFilePaths(t *testing.T) {
+	const storage = "3f2c9a"
+
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{name: "empty", data: ``},
+		{name: "invalid json", data: `{"path":`},
+		{
+			name: "nested",
+			data: `{"cover":{"path":"/3f2c9a/cover.png"},"gallery":[{"path":"3f2c9a/a.png"},{"path":"3f2c9a/sub/b.png"}]}`,
+			want: []string{"3f2c9a/a.png", "3f2c9a/cover.png", "3f2c9a/sub/b.png"},
+		},
+		{
+			name: "other storage",
+			data: `[{"path":"other/a.png"},{"path":"3f2c9a-evil/a.png"},{"path":"3f2c9a"}]`,
+		},
+		{
+			name: "traversal",
+			data: `[{"path":"3f2c9a/../other/a.png"},{"path":"/3f2c9a/../../etc/passwd"},{"path":"../3f2c9a/a.png"},{"path":"3f2c9a/sub/../a.png"}]`,
+			want: []string{"3f2c9a/a.png"},
+		},
+		{name: "non-string path", data: `{"path":{"path":"3f2c9a/a.png"}}`, want: []string{"3f2c9a/a.png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uploadedFilePaths([]byte(tt.data), storage)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uploadedFilePaths = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := uploadedFilePaths([]byte(`{"path":"/a.png"}`), ""); got != nil {
+		t.Errorf("uploadedFilePaths without storage = %q, want nil", got)
+	}
+}
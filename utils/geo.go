@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+
+	"hyperpage/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A blog or profile is located at its own coordinates when it has them,
+// otherwise at its first city (by ID) that has coordinates. Listings take
+// ?lat=&lng= to sort by distance from a point, ?radius_km= to only keep
+// what lies within that distance; what has no location sorts last.
+//
+// The coordinates of a profile are the home of a person, so profile
+// listings only reveal whole kilometres: distances are rounded up and a
+// radius never goes below ProfileDistanceStepKm.
+const (
+	EarthRadiusKm         = 6371.0
+	GeoMaxRadiusKm        = 20000.0
+	ProfileDistanceStepKm = 1.0
+)
+
+var (
+	ErrGeoPoint       = errors.New("lat and lng must be given together and be valid coordinates")
+	ErrGeoRadius      = errors.New("radius_km must be a positive number of kilometres, at most 20000")
+	ErrGeoRadiusPoint = errors.New("radius_km requires lat and lng")
+)
+
+// GeoLocation holds the SQL expressions of the latitude and longitude of a
+// listed row.
+type GeoLocation struct {
+	Lat string
+	Lng string
+}
+
+var (
+	BlogLocation = GeoLocation{
+		Lat: geoCityFallback("blogs.latitude", "latitude", "blog_city", "blog_id", "blogs.id"),
+		Lng: geoCityFallback("blogs.longitude", "longitude", "blog_city", "blog_id", "blogs.id"),
+	}
+	ProfileLocation = GeoLocation{
+		Lat: geoCityFallback("profiles.latitude", "latitude", "profiles_city", "profile_id", "profiles.id"),
+		Lng: geoCityFallback("profiles.longitude", "longitude", "profiles_city", "profile_id", "profiles.id"),
+	}
+
+	// BlogPreciseLocation leaves out the city of blogs without coordinates
+	BlogPreciseLocation = GeoLocation{Lat: "blogs.latitude", Lng: "blogs.longitude"}
+)
+
+func geoCityFallback(own, column, joinTable, joinColumn, id string) string {
+	return "COALESCE(" + own + ", (SELECT c." + column + " FROM " + joinTable + " j JOIN cities c ON c.id = j.city_id" +
+		" WHERE j." + joinColumn + " = " + id + " AND c.latitude IS NOT NULL AND c.longitude IS NOT NULL" +
+		" ORDER BY j.city_id LIMIT 1))"
+}
+
+// GeoFilter is a point to sort by distance from, with an optional radius.
+type GeoFilter struct {
+	Lat      float64
+	Lng      float64
+	RadiusKm float64
+}
+
+// ParseGeoFilter reads the lat, lng and radius_km query values. It returns
+// nil when no point is given.
+func ParseGeoFilter(lat, lng, radiusKm string) (*GeoFilter, error) {
+	if lat == "" && lng == "" {
+		if radiusKm != "" {
+			return nil, ErrGeoRadiusPoint
+		}
+		return nil, nil
+	}
+
+	latValue, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return nil, ErrGeoPoint
+	}
+	lngValue, err := strconv.ParseFloat(lng, 64)
+	if err != nil {
+		return nil, ErrGeoPoint
+	}
+	if err := ValidateCoordinates(&latValue, &lngValue); err != nil {
+		return nil, err
+	}
+
+	filter := &GeoFilter{Lat: latValue, Lng: lngValue}
+	if radiusKm != "" {
+		radius, err := strconv.ParseFloat(radiusKm, 64)
+		if err != nil || math.IsNaN(radius) || radius <= 0 || radius > GeoMaxRadiusKm {
+			return nil, ErrGeoRadius
+		}
+		filter.RadiusKm = radius
+	}
+	return filter, nil
+}
+
+// ValidateCoordinates checks optional coordinates: both or neither, within
+// the range of latitudes and longitudes.
+func ValidateCoordinates(lat, lng *float64) error {
+	if lat == nil && lng == nil {
+		return nil
+	}
+	if lat == nil || lng == nil {
+		return ErrGeoPoint
+	}
+	if math.IsNaN(*lat) || math.IsNaN(*lng) || *lat < -90 || *lat > 90 || *lng < -180 || *lng > 180 {
+		return ErrGeoPoint
+	}
+	return nil
+}
+
+// OptionalFloat is a number of an update request that tells a field left
+// out (Set false) from an explicit null (Set true, Value nil).
+type OptionalFloat struct {
+	Set   bool
+	Value *float64
+}
+
+func (o *OptionalFloat) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	o.Value = nil
+	if string(data) == "null" {
+		return nil
+	}
+
+	var value float64
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	o.Value = &value
+	return nil
+}
+
+// CoordinatesUpdate holds the coordinates of an update request. Left out,
+// they keep the current location; sent as null, they clear it.
+type CoordinatesUpdate struct {
+	Latitude  OptionalFloat `json:"latitude"`
+	Longitude OptionalFloat `json:"longitude"`
+}
+
+// Validate checks that the coordinates are sent together and are valid.
+func (u CoordinatesUpdate) Validate() error {
+	if u.Latitude.Set != u.Longitude.Set {
+		return ErrGeoPoint
+	}
+	return ValidateCoordinates(u.Latitude.Value, u.Longitude.Value)
+}
+
+// Apply stores the sent coordinates in lat and lng.
+func (u CoordinatesUpdate) Apply(lat, lng **float64) {
+	if !u.Latitude.Set {
+		return
+	}
+	*lat = u.Latitude.Value
+	*lng = u.Longitude.Value
+}
+
+// Within keeps the rows located within the radius of the filter, if any.
+func (g *GeoFilter) Within(query *gorm.DB, location GeoLocation) *gorm.DB {
+	if g.RadiusKm == 0 {
+		return query
+	}
+	return query.Where(g.distanceSQL(location)+" <= ?", g.Lat, g.Lat, g.Lng, g.RadiusKm)
+}
+
+// OrderByDistance sorts query nearest first, then by thenBy.
+func (g *GeoFilter) OrderByDistance(query *gorm.DB, location GeoLocation, thenBy string) *gorm.DB {
+	return query.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:                g.distanceSQL(location) + " ASC NULLS LAST, " + thenBy,
+		Vars:               []interface{}{g.Lat, g.Lat, g.Lng},
+		WithoutParentheses: true,
+	}})
+}
+
+// distanceSQL is the haversine distance in kilometres from the point of
+// the filter; it takes the latitude twice and the longitude as vars.
+func (g *GeoFilter) distanceSQL(location GeoLocation) string {
+	return "(" + strconv.FormatFloat(2*EarthRadiusKm, 'f', -1, 64) + " * ASIN(LEAST(1, SQRT(" +
+		"POWER(SIN(RADIANS(" + location.Lat + " - ?) / 2), 2)" +
+		" + COS(RADIANS(?)) * COS(RADIANS(" + location.Lat + "))" +
+		" * POWER(SIN(RADIANS(" + location.Lng + " - ?) / 2), 2)))))"
+}
+
+// DistanceTo returns the distance in kilometres from the point of the
+// filter, rounded to 10 m, or nil for an unknown location.
+func (g *GeoFilter) DistanceTo(lat, lng *float64) *float64 {
+	if lat == nil || lng == nil {
+		return nil
+	}
+	distance := math.Round(DistanceKm(g.Lat, g.Lng, *lat, *lng)*100) / 100
+	return &distance
+}
+
+// CoarseDistanceTo is DistanceTo rounded up to a multiple of stepKm.
+func (g *GeoFilter) CoarseDistanceTo(lat, lng *float64, stepKm float64) *float64 {
+	if lat == nil || lng == nil {
+		return nil
+	}
+	steps := math.Max(1, math.Ceil(DistanceKm(g.Lat, g.Lng, *lat, *lng)/stepKm))
+	distance := steps * stepKm
+	return &distance
+}
+
+// Coarsen raises the radius of the filter to at least stepKm.
+func (g *GeoFilter) Coarsen(stepKm float64) {
+	if g.RadiusKm != 0 && g.RadiusKm < stepKm {
+		g.RadiusKm = stepKm
+	}
+}
+
+// DistanceKm is the great-circle distance between two points.
+func DistanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLng := (lng2 - lng1) * math.Pi / 180
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// BlogCoordinates returns the location of a blog with its cities preloaded.
+func BlogCoordinates(b *models.Blog) (*float64, *float64) {
+	if b.Latitude != nil && b.Longitude != nil {
+		return b.Latitude, b.Longitude
+	}
+	return citiesCoordinates(b.City)
+}
+
+// ProfileCoordinates returns the location of a profile with its cities
+// preloaded.
+func ProfileCoordinates(p *models.Profile) (*float64, *float64) {
+	if p.Latitude != nil && p.Longitude != nil {
+		return p.Latitude, p.Longitude
+	}
+	return citiesCoordinates(p.City)
+}
+
+func citiesCoordinates(cities []models.City) (*float64, *float64) {
+	var first *models.City
+	for i := range cities {
+		city := &cities[i]
+		if city.Latitude == nil || city.Longitude == nil {
+			continue
+		}
+		if first == nil || city.ID < first.ID {
+			first = city
+		}
+	}
+	if first == nil {
+		return nil, nil
+	}
+	return first.Latitude, first.Longitude
+}
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseGeoFilter(t *testing.T) {
+	tests := []struct {
+		name             string
+		lat, lng, radius string
+		want             *GeoFilter
+		err              error
+	}{
+		{name: "none"},
+		{name: "point", lat: "41.7", lng: "44.8", want: &GeoFilter{Lat: 41.7, Lng: 44.8}},
+		{name: "radius", lat: "-33.9", lng: "151.2", radius: "25", want: &GeoFilter{Lat: -33.9, Lng: 151.2, RadiusKm: 25}},
+		{name: "only lat", lat: "41.7", err: ErrGeoPoint},
+		{name: "only lng", lng: "44.8", err: ErrGeoPoint},
+		{name: "not a number", lat: "north", lng: "44.8", err: ErrGeoPoint},
+		{name: "latitude out of range", lat: "91", lng: "0", err: ErrGeoPoint},
+		{name: "longitude out of range", lat: "0", lng: "-181", err: ErrGeoPoint},
+		{name: "NaN", lat: "NaN", lng: "0", err: ErrGeoPoint},
+		{name: "radius without point", radius: "10", err: ErrGeoRadiusPoint},
+		{name: "zero radius", lat: "0", lng: "0", radius: "0", err: ErrGeoRadius},
+		{name: "negative radius", lat: "0", lng: "0", radius: "-5", err: ErrGeoRadius},
+		{name: "radius too large", lat: "0", lng: "0", radius: "20001", err: ErrGeoRadius},
+		{name: "NaN radius", lat: "0", lng: "0", radius: "NaN", err: ErrGeoRadius},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGeoFilter(tt.lat, tt.lng, tt.radius)
+			if err != tt.err {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Fatalf("filter = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want                   float64
+	}{
+		{name: "same point", lat1: 41.7151, lng1: 44.8271, lat2: 41.7151, lng2: 44.8271, want: 0},
+		{name: "London to Paris", lat1: 51.5074, lng1: -0.1278, lat2: 48.8566, lng2: 2.3522, want: 343.5},
+		{name: "Moscow to Saint Petersburg", lat1: 55.7558, lng1: 37.6173, lat2: 59.9343, lng2: 30.3351, want: 633},
+		{name: "equator to pole", lat1: 0, lng1: 0, lat2: 90, lng2: 0, want: math.Pi / 2 * EarthRadiusKm},
+		{name: "antipodes", lat1: 0, lng1: 0, lat2: 0, lng2: 180, want: math.Pi * EarthRadiusKm},
+	}
+
+	for _, tt := range tests {
+		if got := DistanceKm(tt.lat1, tt.lng1, tt.lat2, tt.lng2); math.Abs(got-tt.want) > 1 {
+			t.Errorf("%s: DistanceKm = %.2f, want %.2f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCoarseDistanceTo(t *testing.T) {
+	filter := &GeoFilter{Lat: 0, Lng: 0}
+	at := func(lat float64) *float64 { return &lat }
+	// A degree of latitude is about 111.19 km
+	tests := []struct {
+		lat  *float64
+		want *float64
+	}{
+		{lat: nil, want: nil},
+		{lat: at(0), want: at(1)},
+		{lat: at(0.001), want: at(1)},
+		{lat: at(0.01), want: at(2)},
+		{lat: at(1), want: at(112)},
+	}
+
+	for _, tt := range tests {
+		lng := 0.0
+		got := filter.CoarseDistanceTo(tt.lat, &lng, ProfileDistanceStepKm)
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("CoarseDistanceTo(%v) = %v, want %v", tt.lat, got, tt.want)
+		}
+	}
+
+	coarse := &GeoFilter{RadiusKm: 0.2}
+	coarse.Coarsen(ProfileDistanceStepKm)
+	if coarse.RadiusKm != ProfileDistanceStepKm {
+		t.Errorf("Coarsen: radius %v, want %v", coarse.RadiusKm, ProfileDistanceStepKm)
+	}
+	unbounded := &GeoFilter{}
+	unbounded.Coarsen(ProfileDistanceStepKm)
+	if unbounded.RadiusKm != 0 {
+		t.Errorf("Coarsen set a radius on a filter without one: %v", unbounded.RadiusKm)
+	}
+}
+
+func TestCoordinatesUpdate(t *testing.T) {
+	lat, lng := 1.0, 2.0
+	movedLat, movedLng := 41.5, 44.5
+	tests := []struct {
+		name     string
+		body     string
+		err      error
+		lat, lng *float64
+	}{
+		{name: "left out", body: `{}`, lat: &lat, lng: &lng},
+		{name: "cleared", body: `{"latitude":null,"longitude":null}`},
+		{name: "moved", body: `{"latitude":41.5,"longitude":44.5}`, lat: &movedLat, lng: &movedLng},
+		{name: "only one", body: `{"latitude":41.5}`, err: ErrGeoPoint},
+		{name: "one cleared", body: `{"latitude":null,"longitude":44.5}`, err: ErrGeoPoint},
+		{name: "out of range", body: `{"latitude":100,"longitude":44.5}`, err: ErrGeoPoint},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update CoordinatesUpdate
+			if err := json.Unmarshal([]byte(tt.body), &update); err != nil {
+				t.Fatal(err)
+			}
+			if err := update.Validate(); err != tt.err {
+				t.Fatalf("Validate = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			gotLat, gotLng := &lat, &lng
+			update.Apply(&gotLat, &gotLng)
+			if !equalFloatPtr(gotLat, tt.lat) || !equalFloatPtr(gotLng, tt.lng) {
+				t.Fatalf("Apply = %v, %v; want %v, %v", gotLat, gotLng, tt.lat, tt.lng)
+			}
+		})
+	}
+}
+
+func equalFloatPtr(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"hyperpage/initializers"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// A password login for a user with two-factor authentication enabled yields
+// an opaque "mfa pending" token instead of the normal token pair. It lives in
+// Redis for MFAPendingTTL and allows MFAMaxAttempts code guesses.
+const (
+	MFAPendingTTL  = 5 * time.Minute
+	MFAMaxAttempts = 5
+
+	mfaPendingKeyPrefix  = "mfa_pending:"
+	mfaAttemptsKeyPrefix = "mfa_attempts:"
+	totpUsedKeyPrefix    = "totp_used:"
+)
+
+var (
+	ErrMFATokenInvalid     = errors.New("two-factor token is invalid or has expired")
+	ErrMFATooManyAttempts  = errors.New("too many invalid two-factor codes, please sign in again")
+	ErrTOTPCodeAlreadyUsed = errors.New("two-factor code has already been used")
+)
+
+type MFAPending struct {
+	UserID  string `json:"user_id"`
+	Session string `json:"session"`
+}
+
+func CreateMFAPendingToken(pending MFAPending) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("mfa: generate token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return "", fmt.Errorf("mfa: encode: %w", err)
+	}
+
+	if err := initializers.RedisClient.Set(context.TODO(), mfaPendingKeyPrefix+token, data, MFAPendingTTL).Err(); err != nil {
+		return "", fmt.Errorf("mfa: save token: %w", err)
+	}
+
+	return token, nil
+}
+
+func GetMFAPending(token string) (*MFAPending, error) {
+	data, err := initializers.RedisClient.Get(context.TODO(), mfaPendingKeyPrefix+token).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMFATokenInvalid
+	} else if err != nil {
+		return nil, fmt.Errorf("mfa: get token: %w", err)
+	}
+
+	var pending MFAPending
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("mfa: decode: %w", err)
+	}
+
+	return &pending, nil
+}
+
+// RegisterMFAFailure counts a wrong code and drops the pending token once the
+// attempt budget is exhausted.
+func RegisterMFAFailure(token string) error {
+	ctx := context.TODO()
+
+	attempts, err := initializers.RedisClient.Incr(ctx, mfaAttemptsKeyPrefix+token).Result()
+	if err != nil {
+		return fmt.Errorf("mfa: count attempt: %w", err)
+	}
+	initializers.RedisClient.Expire(ctx, mfaAttemptsKeyPrefix+token, MFAPendingTTL)
+
+	if attempts >= MFAMaxAttempts {
+		DeleteMFAPending(token)
+		return ErrMFATooManyAttempts
+	}
+
+	return nil
+}
+
+func DeleteMFAPending(token string) {
+	initializers.RedisClient.Del(context.TODO(), mfaPendingKeyPrefix+token, mfaAttemptsKeyPrefix+token)
+}
+
+// MarkTOTPStepUsed rejects replay of a code within its validity window.
+func MarkTOTPStepUsed(userID string, step int64) error {
+	key := totpUsedKeyPrefix + userID + ":" + strconv.FormatInt(step, 10)
+
+	first, err := initializers.RedisClient.SetNX(context.TODO(), key, 1, (2*totpSkew+1)*totpPeriod*time.Second).Result()
+	if err != nil {
+		return fmt.Errorf("mfa: mark code used: %w", err)
+	}
+	if !first {
+		return ErrTOTPCodeAlreadyUsed
+	}
+
+	return nil
+}
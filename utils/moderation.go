@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Pre-moderation is switched on with MODERATION_ENABLED. Blogs of trusted
+// users and of users allowed to moderate are published without review.
+// A rejected new blog is refunded; rejected blogs stay rejected. The author
+// is notified of both decisions.
+
+// BlogNeedsReview tells whether a blog created or edited by user has to wait
+// for a moderator.
+func BlogNeedsReview(user *models.User) bool {
+	config, _ := initializers.LoadConfig(".")
+	if !config.ModerationEnabled || user.Trusted {
+		return false
+	}
+
+	_, allowed, err := PermissionScope(user.Role, "moderation", "review")
+	if err != nil {
+		log.Printf("moderation: %s", err)
+	}
+	return !allowed
+}
+
+// EditedBlogStatus is the status of a blog after editor changed it: a live
+// blog goes back to review when editor's posts need review, a rejected one
+// is resubmitted.
+func EditedBlogStatus(status string, editor *models.User) string {
+	if status == models.BlogStatusRejected || (status == "ACTIVE" && BlogNeedsReview(editor)) {
+		return models.BlogStatusPendingReview
+	}
+	return status
+}
+
+// ApproveBlogs publishes the pending blogs among ids and returns the IDs
+// that were approved. A new blog's paid period starts now, an edited one
+// keeps its expiry.
+func ApproveBlogs(ids []uint64, moderatorID uuid.UUID) ([]uint64, error) {
+	blogs, err := pendingBlogs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	approved := []uint64{}
+	for i := range blogs {
+		blog := &blogs[i]
+		now := time.Now()
+
+		updates := map[string]interface{}{
+			"status":           "ACTIVE",
+			"rejection_reason": "",
+			"reviewed_at":      now,
+			"reviewed_by":      moderatorID,
+		}
+		if blog.ExpiredAt == nil || blog.ExpiredAt.Before(now) {
+			updates["expired_at"] = BlogExpiry(now, blog.Days)
+		}
+		// A new blog is listed among the newest from its publication
+		if blog.ExpiredAt == nil {
+			updates["created_at"] = now
+		}
+
+		result := initializers.DB.Model(&models.Blog{}).
+			Where("id = ? AND status = ?", blog.ID, models.BlogStatusPendingReview).
+			Updates(updates)
+		if result.Error != nil {
+			return approved, fmt.Errorf("moderation: approve %d: %w", blog.ID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		approved = append(approved, blog.ID)
+
+		notifyBlogOwner(blog, "Объявление опубликовано",
+			fmt.Sprintf("Пост «%s» прошёл модерацию и опубликован.", blog.Title),
+			"/"+blog.UniqId+"/"+blog.Slug)
+
+		if err := SendBlogMessageToClients("newblog", blog.User.Name); err != nil {
+			log.Printf("moderation: broadcast %d: %s", blog.ID, err)
+		}
+	}
+
+	return approved, nil
+}
+
+// RejectBlogs rejects the pending blogs among ids with reason and returns
+// the IDs that were rejected.
+func RejectBlogs(ids []uint64, reason string, moderatorID uuid.UUID) ([]uint64, error) {
+	blogs, err := pendingBlogs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	rejected := []uint64{}
+	for i := range blogs {
+		blog := &blogs[i]
+
+		result := initializers.DB.Model(&models.Blog{}).
+			Where("id = ? AND status = ?", blog.ID, models.BlogStatusPendingReview).
+			Updates(map[string]interface{}{
+				"status":           models.BlogStatusRejected,
+				"rejection_reason": reason,
+				"reviewed_at":      time.Now(),
+				"reviewed_by":      moderatorID,
+			})
+		if result.Error != nil {
+			return rejected, fmt.Errorf("moderation: reject %d: %w", blog.ID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		rejected = append(rejected, blog.ID)
+
+		// Only a blog that never went live is refunded, a rejected edit
+		// has used its paid period
+		if blog.ExpiredAt == nil {
+			if _, err := RefundElementCharges(blog.UserID, "blog", blog.ID); err != nil {
+				log.Printf("moderation: refund %d: %s", blog.ID, err)
+			}
+		}
+
+		notifyBlogOwner(blog, "Объявление отклонено",
+			fmt.Sprintf("Пост «%s» отклонён модератором: %s", blog.Title, reason), "")
+	}
+
+	return rejected, nil
+}
+
+func pendingBlogs(ids []uint64) ([]models.Blog, error) {
+	var blogs []models.Blog
+	if err := initializers.DB.Preload("User").
+		Where("id IN ? AND status = ?", ids, models.BlogStatusPendingReview).
+		Find(&blogs).Error; err != nil {
+		return nil, fmt.Errorf("moderation: load blogs: %w", err)
+	}
+	return blogs, nil
+}
+
+func notifyBlogOwner(blog *models.Blog, title, message, url string) {
+	if err := Notification(title, message, blog.UserID.String(), url); err != nil {
+		log.Printf("moderation: notify %s: %s", blog.UserID, err)
+		return
+	}
+	if blog.User.Session != "" {
+		SendPersonalMessageToClient(blog.User.Session, "new_notification")
+	}
+}
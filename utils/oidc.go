@@ -0,0 +1,462 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"hyperpage/initializers"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+// OIDCProviderConfig is the subset of the discovery document we rely on.
+type OIDCProviderConfig struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// OIDCState is kept in Redis between the redirect to the provider and the callback.
+type OIDCState struct {
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	Session      string `json:"session"`
+}
+
+// OIDCLink is kept in Redis while the owner of an existing account with the
+// email of an ID token confirms its password.
+type OIDCLink struct {
+	UserID  string `json:"user_id"`
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+	Session string `json:"session"`
+}
+
+type OIDCClaims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+const (
+	OIDCStateTTL = 10 * time.Minute
+
+	oidcStateKeyPrefix = "oidc_state:"
+	oidcLinkKeyPrefix  = "oidc_link:"
+	oidcCacheTTL       = time.Hour
+	oidcClockSkew      = time.Minute
+)
+
+var (
+	ErrOIDCStateInvalid = errors.New("login state is invalid or has expired")
+	ErrOIDCLinkInvalid  = errors.New("link token is invalid or has expired")
+
+	oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+	oidcCacheLock  sync.Mutex
+	oidcProviders  = make(map[string]*OIDCProviderConfig)
+	oidcKeys       = make(map[string]map[string]interface{})
+	oidcFetchedAt  = make(map[string]time.Time)
+	oidcKeysLoaded = make(map[string]time.Time)
+)
+
+// DiscoverOIDC fetches and caches the provider's
+// /.well-known/openid-configuration document.
+func DiscoverOIDC(issuer string) (*OIDCProviderConfig, error) {
+	oidcCacheLock.Lock()
+	defer oidcCacheLock.Unlock()
+
+	if provider, ok := oidcProviders[issuer]; ok && time.Since(oidcFetchedAt[issuer]) < oidcCacheTTL {
+		return provider, nil
+	}
+
+	var provider OIDCProviderConfig
+	if err := getJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &provider); err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+
+	if provider.Issuer != issuer {
+		return nil, fmt.Errorf("oidc: discovery: issuer mismatch %q != %q", provider.Issuer, issuer)
+	}
+
+	oidcProviders[issuer] = &provider
+	oidcFetchedAt[issuer] = time.Now()
+
+	return &provider, nil
+}
+
+// NewOIDCState generates state, nonce and a PKCE verifier and stores them
+// under the returned state value.
+func NewOIDCState(session string) (string, *OIDCState, error) {
+	state := &OIDCState{
+		CodeVerifier: randomURLString(32),
+		Nonce:        randomURLString(16),
+		Session:      session,
+	}
+	key := randomURLString(16)
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", nil, fmt.Errorf("oidc: encode state: %w", err)
+	}
+
+	if err := initializers.RedisClient.Set(context.TODO(), oidcStateKeyPrefix+key, data, OIDCStateTTL).Err(); err != nil {
+		return "", nil, fmt.Errorf("oidc: save state: %w", err)
+	}
+
+	return key, state, nil
+}
+
+// ConsumeOIDCState loads and deletes the state so a callback cannot be replayed.
+func ConsumeOIDCState(key string) (*OIDCState, error) {
+	data, err := initializers.RedisClient.GetDel(context.TODO(), oidcStateKeyPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrOIDCStateInvalid
+	} else if err != nil {
+		return nil, fmt.Errorf("oidc: load state: %w", err)
+	}
+
+	var state OIDCState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("oidc: decode state: %w", err)
+	}
+
+	return &state, nil
+}
+
+// NewOIDCLink stores a pending link and returns its token.
+func NewOIDCLink(link OIDCLink) (string, error) {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return "", fmt.Errorf("oidc: encode link: %w", err)
+	}
+
+	key := randomURLString(16)
+	if err := initializers.RedisClient.Set(context.TODO(), oidcLinkKeyPrefix+key, data, OIDCStateTTL).Err(); err != nil {
+		return "", fmt.Errorf("oidc: save link: %w", err)
+	}
+
+	return key, nil
+}
+
+// ConsumeOIDCLink loads and deletes a pending link, so a wrong password
+// means starting over from the provider.
+func ConsumeOIDCLink(key string) (*OIDCLink, error) {
+	data, err := initializers.RedisClient.GetDel(context.TODO(), oidcLinkKeyPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrOIDCLinkInvalid
+	} else if err != nil {
+		return nil, fmt.Errorf("oidc: load link: %w", err)
+	}
+
+	var link OIDCLink
+	if err := json.Unmarshal(data, &link); err != nil {
+		return nil, fmt.Errorf("oidc: decode link: %w", err)
+	}
+
+	return &link, nil
+}
+
+// OIDCAuthorizationURL builds the authorization-code request with a S256 PKCE challenge.
+func OIDCAuthorizationURL(provider *OIDCProviderConfig, config *initializers.Config, stateKey string, state *OIDCState) string {
+	challenge := sha256.Sum256([]byte(state.CodeVerifier))
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", config.OIDCClientID)
+	params.Set("redirect_uri", config.OIDCRedirectURL)
+	params.Set("scope", oidcScopes(config))
+	params.Set("state", stateKey)
+	params.Set("nonce", state.Nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return provider.AuthorizationEndpoint + separator + params.Encode()
+}
+
+// ExchangeOIDCCode redeems the authorization code and returns the raw ID token.
+func ExchangeOIDCCode(provider *OIDCProviderConfig, config *initializers.Config, code, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", config.OIDCRedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	useBasic := config.OIDCClientSecret != "" && supportsAuthMethod(provider, "client_secret_basic")
+	if !useBasic {
+		form.Set("client_id", config.OIDCClientID)
+		if config.OIDCClientSecret != "" {
+			form.Set("client_secret", config.OIDCClientSecret)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("oidc: token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasic {
+		req.SetBasicAuth(url.QueryEscape(config.OIDCClientID), url.QueryEscape(config.OIDCClientSecret))
+	}
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc: token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("oidc: decode token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc: token endpoint returned %d: %s %s", resp.StatusCode, body.Error, body.ErrorDescription)
+	}
+
+	if body.IDToken == "" {
+		return "", errors.New("oidc: token response has no id_token")
+	}
+
+	return body.IDToken, nil
+}
+
+// VerifyOIDCIDToken checks the ID token signature against the provider JWKS
+// and validates issuer, audience, expiry and nonce.
+func VerifyOIDCIDToken(provider *OIDCProviderConfig, config *initializers.Config, rawIDToken, nonce string) (*OIDCClaims, error) {
+	parsed, err := jwt.Parse(rawIDToken, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected method: %s", t.Header["alg"])
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		return oidcKey(provider, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("oidc: verify id token: %w", err)
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || !parsed.Valid {
+		return nil, errors.New("oidc: verify id token: invalid token")
+	}
+
+	// Valid only checks exp and iat when they are present
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Unix(), true) {
+		return nil, errors.New("oidc: verify id token: missing or expired exp")
+	}
+	if !claims.VerifyIssuedAt(now.Add(oidcClockSkew).Unix(), true) {
+		return nil, errors.New("oidc: verify id token: missing or future iat")
+	}
+
+	if !claims.VerifyIssuer(provider.Issuer, true) {
+		return nil, errors.New("oidc: verify id token: issuer mismatch")
+	}
+
+	if !claims.VerifyAudience(config.OIDCClientID, true) {
+		return nil, errors.New("oidc: verify id token: audience mismatch")
+	}
+
+	if azp, ok := claims["azp"].(string); ok && azp != config.OIDCClientID {
+		return nil, errors.New("oidc: verify id token: authorized party mismatch")
+	}
+
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, errors.New("oidc: verify id token: nonce mismatch")
+	}
+
+	result := &OIDCClaims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string:
+		result.EmailVerified = v == "true"
+	}
+
+	if result.Subject == "" {
+		return nil, errors.New("oidc: verify id token: missing subject")
+	}
+
+	return result, nil
+}
+
+// oidcKey returns the JWKS key for kid, refetching the key set once when the
+// kid is unknown to pick up provider key rotation.
+func oidcKey(provider *OIDCProviderConfig, kid string) (interface{}, error) {
+	oidcCacheLock.Lock()
+	defer oidcCacheLock.Unlock()
+
+	keys, ok := oidcKeys[provider.JWKSURI]
+	if ok {
+		if key, found := lookupKey(keys, kid); found {
+			return key, nil
+		}
+		if time.Since(oidcKeysLoaded[provider.JWKSURI]) < time.Minute {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	keys, err := fetchJWKS(provider.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	oidcKeys[provider.JWKSURI] = keys
+	oidcKeysLoaded[provider.JWKSURI] = time.Now()
+
+	if key, found := lookupKey(keys, kid); found {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func lookupKey(keys map[string]interface{}, kid string) (interface{}, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+func fetchJWKS(uri string) (map[string]interface{}, error) {
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(uri, &set); err != nil {
+		return nil, fmt.Errorf("oidc: jwks: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+func getJSON(uri string, out interface{}) error {
+	resp, err := oidcHTTPClient.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", uri, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func oidcScopes(config *initializers.Config) string {
+	if config.OIDCScopes == "" {
+		return "openid email profile"
+	}
+	return config.OIDCScopes
+}
+
+func supportsAuthMethod(provider *OIDCProviderConfig, method string) bool {
+	// client_secret_basic is the default when the provider does not say
+	if len(provider.TokenEndpointAuthMethodsSupported) == 0 {
+		return method == "client_secret_basic"
+	}
+	for _, m := range provider.TokenEndpointAuthMethodsSupported {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func randomURLString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"hyperpage/initializers"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// mockOIDCProvider is an identity provider serving discovery, JWKS and a
+// token endpoint that answers with the ID token in idToken.
+type mockOIDCProvider struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	idToken string
+	form    url.Values
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDCProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(OIDCProviderConfig{
+			Issuer:                            m.server.URL,
+			AuthorizationEndpoint:             m.server.URL + "/authorize",
+			TokenEndpoint:                     m.server.URL + "/token",
+			JWKSURI:                           m.server.URL + "/jwks",
+			TokenEndpointAuthMethodsSupported: []string{"client_secret_post"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.form = r.PostForm
+		if r.PostForm.Get("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.idToken})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockOIDCProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (m *mockOIDCProvider) claims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            "client",
+		"sub":            "subject-1",
+		"email":          "User@Example.com",
+		"email_verified": true,
+		"nonce":          nonce,
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+	}
+}
+
+func TestOIDCMockProvider(t *testing.T) {
+	m := newMockOIDCProvider(t)
+	config := &initializers.Config{
+		OIDCIssuer:       m.server.URL,
+		OIDCClientID:     "client",
+		OIDCClientSecret: "secret",
+		OIDCRedirectURL:  "https://example.com/callback",
+	}
+
+	provider, err := DiscoverOIDC(config.OIDCIssuer)
+	if err != nil {
+		t.Fatalf("DiscoverOIDC: %v", err)
+	}
+
+	state := &OIDCState{CodeVerifier: "verifier", Nonce: "nonce"}
+	authURL, err := url.Parse(OIDCAuthorizationURL(provider, config, "state-key", state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authURL.Query()
+	if query.Get("state") != "state-key" || query.Get("nonce") != "nonce" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization URL %s", authURL)
+	}
+
+	m.idToken = m.sign(t, m.claims("nonce"))
+	rawIDToken, err := ExchangeOIDCCode(provider, config, "good-code", state.CodeVerifier)
+	if err != nil {
+		t.Fatalf("ExchangeOIDCCode: %v", err)
+	}
+	if m.form.Get("code_verifier") != "verifier" || m.form.Get("client_secret") != "secret" {
+		t.Fatalf("token request form %v", m.form)
+	}
+
+	claims, err := VerifyOIDCIDToken(provider, config, rawIDToken, state.Nonce)
+	if err != nil {
+		t.Fatalf("VerifyOIDCIDToken: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "User@Example.com" || !claims.EmailVerified {
+		t.Fatalf("claims %+v", claims)
+	}
+
+	if _, err := ExchangeOIDCCode(provider, config, "bad-code", state.CodeVerifier); err == nil {
+		t.Fatal("ExchangeOIDCCode accepted a rejected code")
+	}
+}
+
+func TestVerifyOIDCIDTokenRejects(t *testing.T) {
+	m := newMockOIDCProvider(t)
+	config := &initializers.Config{OIDCIssuer: m.server.URL, OIDCClientID: "client"}
+
+	provider, err := DiscoverOIDC(config.OIDCIssuer)
+	if err != nil {
+		t.Fatalf("DiscoverOIDC: %v", err)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+		token  func(jwt.MapClaims) string
+		want   string
+	}{
+		{name: "nonce", modify: func(c jwt.MapClaims) { c["nonce"] = "other" }, want: "nonce mismatch"},
+		{name: "audience", modify: func(c jwt.MapClaims) { c["aud"] = "other" }, want: "audience mismatch"},
+		{name: "issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, want: "issuer mismatch"},
+		{name: "authorized party", modify: func(c jwt.MapClaims) { c["azp"] = "other" }, want: "authorized party mismatch"},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, want: "expired"},
+		{name: "no expiry", modify: func(c jwt.MapClaims) { delete(c, "exp") }, want: "missing or expired exp"},
+		{name: "no issued at", modify: func(c jwt.MapClaims) { delete(c, "iat") }, want: "missing or future iat"},
+		{name: "issued in the future", modify: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }, want: "used before issued"},
+		{name: "subject", modify: func(c jwt.MapClaims) { delete(c, "sub") }, want: "missing subject"},
+		{
+			name: "signature",
+			token: func(c jwt.MapClaims) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+				token.Header["kid"] = "test"
+				signed, _ := token.SignedString(otherKey)
+				return signed
+			},
+			want: "verification error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := m.claims("nonce")
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			var raw string
+			if tt.token != nil {
+				raw = tt.token(claims)
+			} else {
+				raw = m.sign(t, claims)
+			}
+
+			_, err := VerifyOIDCIDToken(provider, config, raw, "nonce")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
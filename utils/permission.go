@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Grants of a role are cached in Redis as a JSON object mapping
+// "resource:action" to the scope. Editing grants drops the cached entry.
+const (
+	RolePermissionsTTL       = 10 * time.Minute
+	rolePermissionsKeyPrefix = "role_permissions:"
+)
+
+// RolePermissions returns the grant set of role, keyed by models.PermissionKey.
+func RolePermissions(role string) (map[string]string, error) {
+	ctx := context.TODO()
+	key := rolePermissionsKeyPrefix + role
+
+	cached, err := initializers.RedisClient.Get(ctx, key).Result()
+	if err == nil {
+		grants := map[string]string{}
+		if err := json.Unmarshal([]byte(cached), &grants); err == nil {
+			return grants, nil
+		}
+	} else if err != redis.Nil {
+		return nil, fmt.Errorf("permission: read cache: %w", err)
+	}
+
+	grants, err := loadRolePermissions(role)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := json.Marshal(grants)
+	initializers.RedisClient.Set(ctx, key, data, RolePermissionsTTL)
+
+	return grants, nil
+}
+
+// loadRolePermissions reads the grant set of role from the database.
+var loadRolePermissions = func(role string) (map[string]string, error) {
+	var rows []models.RolePermission
+	if err := initializers.DB.Preload("Permission").Where("role = ?", role).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("permission: load grants: %w", err)
+	}
+
+	grants := make(map[string]string, len(rows))
+	for _, row := range rows {
+		grants[models.PermissionKey(row.Permission.Resource, row.Permission.Action)] = row.Scope
+	}
+	return grants, nil
+}
+
+// PermissionScope returns the scope role holds for action on resource and
+// false when the permission is not granted.
+func PermissionScope(role, resource, action string) (string, bool, error) {
+	grants, err := RolePermissions(role)
+	if err != nil {
+		return "", false, err
+	}
+	scope, ok := grants[models.PermissionKey(resource, action)]
+	return scope, ok, nil
+}
+
+// InvalidateRolePermissions drops the cached grants of role. Without a Redis
+// connection there is no cache to drop.
+func InvalidateRolePermissions(role string) {
+	if initializers.RedisClient == nil {
+		return
+	}
+	initializers.RedisClient.Del(context.TODO(), rolePermissionsKeyPrefix+role)
+}
+
+// SeedPermissions creates the default roles and permissions. Default grants
+// are only added together with a new permission, so grants revoked by an
+// admin are not restored on the next migration.
+func SeedPermissions() error {
+	for _, role := range models.DefaultRoles {
+		role := role
+		if err := initializers.DB.Where(models.AccessRole{Name: role.Name}).FirstOrCreate(&role).Error; err != nil {
+			return fmt.Errorf("permission: seed role %s: %w", role.Name, err)
+		}
+	}
+
+	for _, permission := range models.DefaultPermissions {
+		permission := permission
+
+		var existing models.Permission
+		err := initializers.DB.Where("resource = ? AND action = ?", permission.Resource, permission.Action).First(&existing).Error
+		if err == nil {
+			continue
+		} else if err != gorm.ErrRecordNotFound {
+			return fmt.Errorf("permission: seed %s: %w", models.PermissionKey(permission.Resource, permission.Action), err)
+		}
+
+		if err := initializers.DB.Create(&permission).Error; err != nil {
+			return fmt.Errorf("permission: seed %s: %w", models.PermissionKey(permission.Resource, permission.Action), err)
+		}
+
+		grants := defaultGrants(&permission)
+		if err := initializers.DB.Create(&grants).Error; err != nil {
+			return fmt.Errorf("permission: seed grants: %w", err)
+		}
+	}
+
+	for _, role := range models.DefaultRoles {
+		InvalidateRolePermissions(role.Name)
+	}
+
+	return nil
+}
+
+// defaultGrants returns the grants a new permission starts with: admin with
+// scope "any" and the roles of models.DefaultRoleGrants.
+func defaultGrants(permission *models.Permission) []models.RolePermission {
+	grants := []models.RolePermission{{Role: "admin", PermissionID: permission.ID, Scope: models.PermissionScopeAny}}
+	for role, defaults := range models.DefaultRoleGrants {
+		for _, grant := range defaults {
+			if grant.Resource == permission.Resource && grant.Action == permission.Action {
+				grants = append(grants, models.RolePermission{Role: role, PermissionID: permission.ID, Scope: grant.Scope})
+			}
+		}
+	}
+	return grants
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"testing"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+)
+
+func TestRolePermissionsCache(t *testing.T) {
+	f := useFakeRedis(t)
+
+	loads := 0
+	previous := loadRolePermissions
+	loadRolePermissions = func(role string) (map[string]string, error) {
+		loads++
+		return map[string]string{models.PermissionKey("blog", "update"): models.PermissionScopeOwn}, nil
+	}
+	t.Cleanup(func() { loadRolePermissions = previous })
+
+	for i := 0; i < 2; i++ {
+		scope, granted, err := PermissionScope("user", "blog", "update")
+		if err != nil || !granted || scope != models.PermissionScopeOwn {
+			t.Fatalf("PermissionScope = %q, %v, %v", scope, granted, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("grants loaded %d times, want 1", loads)
+	}
+	if _, ok := f.get(rolePermissionsKeyPrefix + "user"); !ok {
+		t.Fatal("grants were not cached")
+	}
+
+	if _, granted, err := PermissionScope("user", "lang", "create"); err != nil || granted {
+		t.Fatalf("ungranted permission: %v, %v", granted, err)
+	}
+
+	InvalidateRolePermissions("user")
+	if _, ok := f.get(rolePermissionsKeyPrefix + "user"); ok {
+		t.Fatal("InvalidateRolePermissions kept the cache")
+	}
+	if _, _, err := PermissionScope("user", "blog", "update"); err != nil || loads != 2 {
+		t.Fatalf("after invalidation: %d loads, %v", loads, err)
+	}
+}
+
+func TestInvalidateRolePermissionsWithoutRedis(t *testing.T) {
+	previous := initializers.RedisClient
+	initializers.RedisClient = nil
+	t.Cleanup(func() { initializers.RedisClient = previous })
+
+	InvalidateRolePermissions("user")
+}
+
+func TestDefaultGrants(t *testing.T) {
+	scopes := func(resource, action string) map[string]string {
+		got := map[string]string{}
+		for _, grant := range defaultGrants(&models.Permission{ID: 7, Resource: resource, Action: action}) {
+			if grant.PermissionID != 7 {
+				t.Fatalf("grant %+v of another permission", grant)
+			}
+			got[grant.Role] = grant.Scope
+		}
+		return got
+	}
+
+	tests := []struct {
+		resource, action string
+		want             map[string]string
+	}{
+		{resource: "blog", action: "update", want: map[string]string{"admin": "any", "user": "own", "vip": "own"}},
+		{resource: "chat", action: "use", want: map[string]string{"admin": "any", "user": "own", "vip": "own"}},
+		{resource: "lang", action: "create", want: map[string]string{"admin": "any"}},
+		{resource: "report", action: "update", want: map[string]string{"admin": "any"}},
+	}
+
+	for _, tt := range tests {
+		got := scopes(tt.resource, tt.action)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s:%s grants %v, want %v", tt.resource, tt.action, got, tt.want)
+			continue
+		}
+		for role, scope := range tt.want {
+			if got[role] != scope {
+				t.Errorf("%s:%s grants %v, want %v", tt.resource, tt.action, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestDefaultRoleGrantsArePermissions(t *testing.T) {
+	known := map[string]bool{}
+	for _, permission := range models.DefaultPermissions {
+		key := models.PermissionKey(permission.Resource, permission.Action)
+		if known[key] {
+			t.Errorf("permission %s is listed twice", key)
+		}
+		known[key] = true
+	}
+
+	for role, grants := range models.DefaultRoleGrants {
+		for _, grant := range grants {
+			if !known[models.PermissionKey(grant.Resource, grant.Action)] {
+				t.Errorf("role %s is granted unknown permission %s:%s", role, grant.Resource, grant.Action)
+			}
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"hyperpage/initializers"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// Failed auth attempts are counted per action for the client IP, the email
+// and the IP/email pair. After AuthFreeAttempts failures a key is blocked for
+// an exponentially growing delay; AccountLockThreshold failed logins for one
+// email lock the account for AccountLockDuration.
+//
+// Redis layout:
+//
+//	auth_fail:<action>:<kind>:<id>   failure counter, expires after AuthFailureWindow
+//	auth_block:<action>:<kind>:<id>  backoff block, expires when the delay is over
+//	auth_lock:<email>                account lock
+const (
+	AuthFreeAttempts     = 3
+	AuthBackoffBase      = time.Second
+	AuthBackoffMax       = 15 * time.Minute
+	AuthFailureWindow    = time.Hour
+	AccountLockThreshold = 10
+	AccountLockDuration  = 30 * time.Minute
+
+	authFailKeyPrefix  = "auth_fail:"
+	authBlockKeyPrefix = "auth_block:"
+	authLockKeyPrefix  = "auth_lock:"
+)
+
+// Auth actions guarded by the limiter.
+const (
+	AuthActionLogin       = "login"
+	AuthActionForgot      = "forgot"
+	AuthActionVerifyEmail = "verify"
+	AuthActionMagicLink   = "magic"
+)
+
+type AuthLimitStatus struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+type AuthLock struct {
+	Key        string `json:"key"`
+	Kind       string `json:"kind"`
+	RetryAfter int64  `json:"retry_after"`
+}
+
+// ClientIP returns the address nginx forwards in X-Real-IP when the request
+// comes from one of TRUSTED_PROXIES, otherwise the peer address.
+func ClientIP(c *fiber.Ctx) string {
+	config, _ := initializers.LoadConfig(".")
+	if !isTrustedProxy(c.IP(), config.TrustedProxies) {
+		return c.IP()
+	}
+	if ip := strings.TrimSpace(c.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return c.IP()
+}
+
+// isTrustedProxy reports whether ip is one of the comma separated addresses
+// or CIDR ranges of proxies.
+func isTrustedProxy(ip, proxies string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, proxy := range strings.Split(proxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if trusted := net.ParseIP(proxy); trusted != nil && trusted.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAuthLimit reports whether the caller must wait before trying action again.
+func CheckAuthLimit(action, ip, email string) (*AuthLimitStatus, error) {
+	ctx := context.TODO()
+	status := &AuthLimitStatus{}
+
+	if email != "" {
+		ttl, err := initializers.RedisClient.TTL(ctx, authLockKeyPrefix+email).Result()
+		if err != nil {
+			return nil, fmt.Errorf("ratelimit: check lock: %w", err)
+		}
+		if ttl > 0 {
+			status.Locked = true
+			status.RetryAfter = ttl
+		}
+	}
+
+	for _, key := range authLimitKeys(action, ip, email) {
+		ttl, err := initializers.RedisClient.TTL(ctx, authBlockKeyPrefix+key).Result()
+		if err != nil {
+			return nil, fmt.Errorf("ratelimit: check block: %w", err)
+		}
+		if ttl > status.RetryAfter {
+			status.RetryAfter = ttl
+		}
+	}
+
+	return status, nil
+}
+
+// RegisterAuthFailure counts a failed attempt and applies backoff. It returns
+// true when this failure locked the account.
+func RegisterAuthFailure(action, ip, email string) (bool, error) {
+	ctx := context.TODO()
+
+	for _, key := range authLimitKeys(action, ip, email) {
+		failures, err := initializers.RedisClient.Incr(ctx, authFailKeyPrefix+key).Result()
+		if err != nil {
+			return false, fmt.Errorf("ratelimit: count failure: %w", err)
+		}
+		if failures == 1 {
+			initializers.RedisClient.Expire(ctx, authFailKeyPrefix+key, AuthFailureWindow)
+		}
+
+		if failures > AuthFreeAttempts {
+			if err := initializers.RedisClient.Set(ctx, authBlockKeyPrefix+key, failures, authBackoff(failures)).Err(); err != nil {
+				return false, fmt.Errorf("ratelimit: block: %w", err)
+			}
+		}
+	}
+
+	if action != AuthActionLogin || email == "" {
+		return false, nil
+	}
+
+	failures, err := initializers.RedisClient.Get(ctx, authFailKeyPrefix+authLimitKey(action, "email", email)).Int64()
+	if err != nil && err != redis.Nil {
+		return false, fmt.Errorf("ratelimit: read failures: %w", err)
+	}
+	if failures < AccountLockThreshold {
+		return false, nil
+	}
+
+	locked, err := initializers.RedisClient.SetNX(ctx, authLockKeyPrefix+email, failures, AccountLockDuration).Result()
+	if err != nil {
+		return false, fmt.Errorf("ratelimit: lock account: %w", err)
+	}
+
+	return locked, nil
+}
+
+// ResetAuthFailures forgets failures of the email after a successful attempt.
+// IP counters are kept so one valid account cannot be used to reset them.
+func ResetAuthFailures(action, ip, email string) {
+	ctx := context.TODO()
+
+	for _, key := range authLimitKeys(action, ip, email) {
+		if strings.Contains(key, ":ip:") {
+			continue
+		}
+		initializers.RedisClient.Del(ctx, authFailKeyPrefix+key, authBlockKeyPrefix+key)
+	}
+}
+
+// ListAuthLocks returns current account locks and backoff blocks.
+func ListAuthLocks() ([]AuthLock, error) {
+	ctx := context.TODO()
+	locks := []AuthLock{}
+
+	for _, prefix := range []string{authLockKeyPrefix, authBlockKeyPrefix} {
+		iter := initializers.RedisClient.Scan(ctx, 0, prefix+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			ttl, err := initializers.RedisClient.TTL(ctx, key).Result()
+			if err != nil || ttl <= 0 {
+				continue
+			}
+
+			kind := "account"
+			if prefix == authBlockKeyPrefix {
+				kind = "backoff"
+			}
+
+			locks = append(locks, AuthLock{
+				Key:        strings.TrimPrefix(key, prefix),
+				Kind:       kind,
+				RetryAfter: int64(ttl.Seconds()),
+			})
+		}
+		if err := iter.Err(); err != nil {
+			return nil, fmt.Errorf("ratelimit: list: %w", err)
+		}
+	}
+
+	return locks, nil
+}
+
+// ClearAuthLocks removes the account lock and every counter and block that
+// mentions the given email and/or IP.
+func ClearAuthLocks(email, ip string) (int64, error) {
+	ctx := context.TODO()
+	var cleared int64
+
+	var patterns []string
+	if email != "" {
+		n, err := initializers.RedisClient.Del(ctx, authLockKeyPrefix+email).Result()
+		if err != nil {
+			return cleared, fmt.Errorf("ratelimit: clear: %w", err)
+		}
+		cleared += n
+		patterns = append(patterns, "*:email:"+escapeGlob(email), "*:pair:*|"+escapeGlob(email))
+	}
+	if ip != "" {
+		patterns = append(patterns, "*:ip:"+escapeGlob(ip), "*:pair:"+escapeGlob(ip)+"|*")
+	}
+
+	for _, pattern := range patterns {
+		for _, prefix := range []string{authFailKeyPrefix, authBlockKeyPrefix} {
+			iter := initializers.RedisClient.Scan(ctx, 0, prefix+pattern, 100).Iterator()
+			for iter.Next(ctx) {
+				n, err := initializers.RedisClient.Del(ctx, iter.Val()).Result()
+				if err != nil {
+					return cleared, fmt.Errorf("ratelimit: clear: %w", err)
+				}
+				cleared += n
+			}
+			if err := iter.Err(); err != nil {
+				return cleared, fmt.Errorf("ratelimit: clear: %w", err)
+			}
+		}
+	}
+
+	return cleared, nil
+}
+
+// SetRetryAfter sets the Retry-After header in whole seconds, rounding up.
+func SetRetryAfter(c *fiber.Ctx, d time.Duration) {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Set(fiber.HeaderRetryAfter, fmt.Sprint(seconds))
+}
+
+func authBackoff(failures int64) time.Duration {
+	delay := AuthBackoffBase
+	for i := int64(AuthFreeAttempts); i < failures-1 && delay < AuthBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > AuthBackoffMax {
+		delay = AuthBackoffMax
+	}
+	return delay
+}
+
+func authLimitKeys(action, ip, email string) []string {
+	keys := []string{authLimitKey(action, "ip", ip)}
+	if email != "" {
+		keys = append(keys,
+			authLimitKey(action, "email", email),
+			authLimitKey(action, "pair", ip+"|"+email),
+		)
+	}
+	return keys
+}
+
+func authLimitKey(action, kind, id string) string {
+	return action + ":" + kind + ":" + id
+}
+
+// escapeGlob escapes the characters SCAN MATCH patterns treat specially, so
+// an email such as "*@example.com" only matches itself.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\', '*', '?', '[', ']':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuthBackoff(t *testing.T) {
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{failures: 1, want: time.Second},
+		{failures: AuthFreeAttempts + 1, want: time.Second},
+		{failures: AuthFreeAttempts + 2, want: 2 * time.Second},
+		{failures: AuthFreeAttempts + 3, want: 4 * time.Second},
+		{failures: AuthFreeAttempts + 10, want: 512 * time.Second},
+		{failures: AuthFreeAttempts + 11, want: AuthBackoffMax},
+		{failures: 1000, want: AuthBackoffMax},
+	}
+
+	for _, tt := range tests {
+		if got := authBackoff(tt.failures); got != tt.want {
+			t.Errorf("authBackoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestIsTrustedProxy(t *testing.T) {
+	proxies := "127.0.0.1, 172.16.0.0/12,bad/cidr"
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "127.0.0.1", want: true},
+		{ip: "172.18.0.5", want: true},
+		{ip: "172.32.0.1", want: false},
+		{ip: "10.0.0.1", want: false},
+		{ip: "not an ip", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isTrustedProxy(tt.ip, proxies); got != tt.want {
+			t.Errorf("isTrustedProxy(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+	if isTrustedProxy("127.0.0.1", "") {
+		t.Error("no proxy is trusted when TRUSTED_PROXIES is empty")
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	tests := map[string]string{
+		"user@example.com": "user@example.com",
+		"*@example.com":    `\*@example.com`,
+		"a?b[c]d":          `a\?b\[c\]d`,
+		`back\slash`:       `back\\slash`,
+		"":                 "",
+	}
+
+	for in, want := range tests {
+		if got := escapeGlob(in); got != want {
+			t.Errorf("escapeGlob(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
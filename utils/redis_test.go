@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hyperpage/initializers"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedis is an in-memory server speaking enough RESP2 for the helpers
+// under test: strings without expiry, lists, sets and a polling BRPOP.
+type fakeRedis struct {
+	mu      sync.Mutex
+	strings map[string]string
+	lists   map[string][]string
+	sets    map[string]map[string]bool
+}
+
+// useFakeRedis points initializers.RedisClient at a fresh fakeRedis for
+// the duration of the test.
+func useFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{strings: map[string]string{}, lists: map[string][]string{}, sets: map[string]map[string]bool{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	previous := initializers.RedisClient
+	initializers.RedisClient = redis.NewClient(&redis.Options{Addr: listener.Addr().String()})
+	t.Cleanup(func() {
+		initializers.RedisClient.Close()
+		initializers.RedisClient = previous
+		listener.Close()
+	})
+	return f
+}
+
+func (f *fakeRedis) get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.strings[key]
+	return value, ok
+}
+
+func (f *fakeRedis) list(key string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.lists[key]...)
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, f.exec(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		if value, ok := f.get(args[1]); ok {
+			return bulk(value)
+		}
+		return "$-1\r\n"
+	case "SET":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		nx := false
+		for _, option := range args[3:] {
+			nx = nx || strings.EqualFold(option, "NX")
+		}
+		if _, exists := f.strings[args[1]]; exists && nx {
+			return "$-1\r\n"
+		}
+		f.strings[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.strings[key]; ok {
+				delete(f.strings, key)
+				deleted++
+			}
+		}
+		return ":" + strconv.Itoa(deleted) + "\r\n"
+	case "EXISTS":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := f.strings[key]; ok {
+				n++
+			}
+		}
+		return ":" + strconv.Itoa(n) + "\r\n"
+	case "SADD":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.sets[args[1]] == nil {
+			f.sets[args[1]] = map[string]bool{}
+		}
+		added := 0
+		for _, member := range args[2:] {
+			if !f.sets[args[1]][member] {
+				f.sets[args[1]][member] = true
+				added++
+			}
+		}
+		return ":" + strconv.Itoa(added) + "\r\n"
+	case "SREM":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		removed := 0
+		for _, member := range args[2:] {
+			if f.sets[args[1]][member] {
+				delete(f.sets[args[1]], member)
+				removed++
+			}
+		}
+		return ":" + strconv.Itoa(removed) + "\r\n"
+	case "SISMEMBER":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.sets[args[1]][args[2]] {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "SMEMBERS":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		reply := "*" + strconv.Itoa(len(f.sets[args[1]])) + "\r\n"
+		for member := range f.sets[args[1]] {
+			reply += bulk(member)
+		}
+		return reply
+	case "LPUSH":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, value := range args[2:] {
+			f.lists[args[1]] = append([]string{value}, f.lists[args[1]]...)
+		}
+		return ":" + strconv.Itoa(len(f.lists[args[1]])) + "\r\n"
+	case "BRPOP":
+		key := args[1]
+		seconds, _ := strconv.ParseFloat(args[len(args)-1], 64)
+		deadline := time.Now().Add(time.Duration(seconds * float64(time.Second)))
+		for {
+			f.mu.Lock()
+			if items := f.lists[key]; len(items) > 0 {
+				value := items[len(items)-1]
+				f.lists[key] = items[:len(items)-1]
+				f.mu.Unlock()
+				return "*2\r\n" + bulk(key) + bulk(value)
+			}
+			f.mu.Unlock()
+			if seconds > 0 && time.Now().After(deadline) {
+				return "*-1\r\n"
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	default:
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("fake redis: unexpected %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func bulk(value string) string {
+	return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+}
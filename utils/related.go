@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Related blogs are other ACTIVE blogs sharing a hashtag, city or category
+// with the blog. They are scored by what they share, how close their price
+// is and how new they are, and the best RelatedBlogsLimit IDs are cached.
+// The cache of a blog is dropped when it is edited; blogs that stopped being
+// ACTIVE are filtered out when the IDs are loaded.
+//
+// Redis layout:
+//
+//	related_blogs:<blog id>:all      IDs of related blogs, JSON
+//	related_blogs:<blog id>:others   the same without the blog's author
+const (
+	RelatedBlogsLimit    = 12
+	RelatedBlogsCacheTTL = 30 * time.Minute
+
+	relatedBlogsKeyPrefix = "related_blogs:"
+)
+
+// Weights of the related blog score. A shared category counts more than a
+// shared city, every shared hashtag adds up; a blog at the same price gets
+// the whole price weight, one at double or zero price none, prices being
+// compared in the base currency. The recency weight halves in
+// relatedBlogsHalfLife days.
+const (
+	relatedWeightCategory = 4.0
+	relatedWeightCity     = 2.0
+	relatedWeightHashtag  = 1.5
+	relatedWeightPrice    = 2.0
+	relatedWeightRecency  = 1.0
+	relatedBlogsHalfLife  = 7
+)
+
+// RelatedBlogIDs returns the IDs of the blogs related to blog, best first.
+// excludeAuthor leaves out the other blogs of the same author.
+func RelatedBlogIDs(blog *models.Blog, excludeAuthor bool) ([]uint64, error) {
+	key := relatedBlogsKey(blog.ID, excludeAuthor)
+
+	var ids []uint64
+	cached, err := initializers.RedisClient.Get(context.TODO(), key).Result()
+	if err == nil && json.Unmarshal([]byte(cached), &ids) == nil {
+		return activeBlogIDs(ids)
+	} else if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	ids, err = scoreRelatedBlogs(blog, excludeAuthor)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := json.Marshal(ids)
+	if err := initializers.RedisClient.Set(context.TODO(), key, data, RelatedBlogsCacheTTL).Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// InvalidateRelatedBlogs drops the cached related blogs of a blog.
+func InvalidateRelatedBlogs(blogID uint64) error {
+	return initializers.RedisClient.Del(context.TODO(),
+		relatedBlogsKey(blogID, false),
+		relatedBlogsKey(blogID, true),
+	).Err()
+}
+
+func relatedBlogsKey(blogID uint64, excludeAuthor bool) string {
+	mode := "all"
+	if excludeAuthor {
+		mode = "others"
+	}
+	return relatedBlogsKeyPrefix + strconv.FormatUint(blogID, 10) + ":" + mode
+}
+
+func scoreRelatedBlogs(blog *models.Blog, excludeAuthor bool) ([]uint64, error) {
+	rates, err := CurrencyRates()
+	if err != nil {
+		return nil, err
+	}
+	// A blog whose currency has no rate gets no price weight
+	total := 0.0
+	if converted := ConvertPrice(blog.Total, blog.Currency, BaseCurrency(), rates); converted != nil {
+		total = *converted
+	}
+
+	query := `
+		SELECT b.id FROM blogs b
+		WHERE b.status = 'ACTIVE' AND b.id <> @blog
+			AND (b.id IN (SELECT blog_id FROM blog_hashtags WHERE hashtags_id IN (SELECT hashtags_id FROM blog_hashtags WHERE blog_id = @blog))
+				OR b.id IN (SELECT blog_id FROM blog_city WHERE city_id IN (SELECT city_id FROM blog_city WHERE blog_id = @blog))
+				OR b.id IN (SELECT blog_id FROM blog_guilds WHERE guilds_id IN (SELECT guilds_id FROM blog_guilds WHERE blog_id = @blog)))`
+	if excludeAuthor {
+		query += ` AND b.user_id <> @user`
+	}
+	query += `
+		ORDER BY
+			CASE WHEN EXISTS (SELECT 1 FROM blog_guilds g WHERE g.blog_id = b.id AND g.guilds_id IN (SELECT guilds_id FROM blog_guilds WHERE blog_id = @blog)) THEN @category ELSE 0 END
+			+ CASE WHEN EXISTS (SELECT 1 FROM blog_city c WHERE c.blog_id = b.id AND c.city_id IN (SELECT city_id FROM blog_city WHERE blog_id = @blog)) THEN @city ELSE 0 END
+			+ @hashtag * (SELECT COUNT(*) FROM blog_hashtags h WHERE h.blog_id = b.id AND h.hashtags_id IN (SELECT hashtags_id FROM blog_hashtags WHERE blog_id = @blog))
+			+ COALESCE(CASE WHEN @total > 0 AND b.total > 0 THEN @price * GREATEST(0, 1 - ABS(b.total * (SELECT r.rate FROM currency_rates r WHERE r.code = b.currency) - @total) / @total) END, 0)
+			+ @recency * POWER(0.5, EXTRACT(EPOCH FROM NOW() - b.created_at) / 86400 / @halfLife)
+			DESC,
+			b.created_at DESC, b.id DESC
+		LIMIT @limit`
+
+	ids := []uint64{}
+	err = initializers.DB.Raw(query, map[string]interface{}{
+		"blog":     blog.ID,
+		"user":     blog.UserID,
+		"total":    total,
+		"category": relatedWeightCategory,
+		"city":     relatedWeightCity,
+		"hashtag":  relatedWeightHashtag,
+		"price":    relatedWeightPrice,
+		"recency":  relatedWeightRecency,
+		"halfLife": relatedBlogsHalfLife,
+		"limit":    RelatedBlogsLimit,
+	}).Scan(&ids).Error
+	return ids, err
+}
+
+// activeBlogIDs keeps the IDs of blogs that are still ACTIVE, in order.
+func activeBlogIDs(ids []uint64) ([]uint64, error) {
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	var active []uint64
+	if err := initializers.DB.Model(&models.Blog{}).
+		Where("id IN ? AND status = ?", ids, "ACTIVE").
+		Pluck("id", &active).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[uint64]bool, len(active))
+	for _, id := range active {
+		found[id] = true
+	}
+	kept := ids[:0]
+	for _, id := range ids {
+		if found[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept, nil
+}
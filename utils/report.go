@@ -0,0 +1,287 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+// A user can file ReportRateLimit reports per ReportRateWindow and holds at
+// most one open report per target. A blog reported by REPORT_HIDE_THRESHOLD
+// distinct users is hidden; it comes back when the open reports fall below
+// the threshold again through dismissals and none of its reports was upheld.
+//
+// Redis layout:
+//
+//	report_rate:<user id>  reports filed in the current window
+const (
+	ReportRateLimit            = 10
+	ReportRateWindow           = time.Hour
+	DefaultReportHideThreshold = 5
+
+	reportRateKeyPrefix = "report_rate:"
+)
+
+var (
+	ErrReportRateLimited   = errors.New("too many reports, try again later")
+	ErrReportDuplicate     = errors.New("you have already reported this")
+	ErrReportTargetMissing = errors.New("reported element not found")
+	ErrReportOwnTarget     = errors.New("you cannot report your own content")
+	ErrReportNotFound      = errors.New("report not found")
+	ErrReportClosed        = errors.New("report is already closed")
+)
+
+var openReportStatuses = []string{models.ReportStatusOpen, models.ReportStatusAssigned}
+
+// CreateReport files a report of reporterID after checking the target, the
+// reporter's open reports and the rate limit.
+func CreateReport(reporterID uuid.UUID, input *models.CreateReportInput) (*models.Report, error) {
+	owner, targetID, err := reportTargetOwner(input.TargetType, input.TargetID)
+	if err != nil {
+		return nil, err
+	}
+	if owner == reporterID {
+		return nil, ErrReportOwnTarget
+	}
+
+	var open int64
+	if err := initializers.DB.Model(&models.Report{}).
+		Where("reporter_id = ? AND target_type = ? AND target_id = ? AND status IN ?", reporterID, input.TargetType, targetID, openReportStatuses).
+		Count(&open).Error; err != nil {
+		return nil, fmt.Errorf("report: check duplicate: %w", err)
+	}
+	if open > 0 {
+		return nil, ErrReportDuplicate
+	}
+
+	ctx := context.TODO()
+	key := reportRateKeyPrefix + reporterID.String()
+	filed, err := initializers.RedisClient.Incr(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("report: rate limit: %w", err)
+	}
+	if filed == 1 {
+		initializers.RedisClient.Expire(ctx, key, ReportRateWindow)
+	}
+	if filed > ReportRateLimit {
+		return nil, ErrReportRateLimited
+	}
+
+	report := models.Report{
+		ReporterID: reporterID,
+		TargetType: input.TargetType,
+		TargetID:   targetID,
+		Reason:     input.Reason,
+		Details:    input.Details,
+		Status:     models.ReportStatusOpen,
+	}
+	if err := initializers.DB.Create(&report).Error; err != nil {
+		return nil, fmt.Errorf("report: create: %w", err)
+	}
+
+	if report.TargetType == models.ReportTargetPost {
+		if err := hideReportedBlog(report.TargetID); err != nil {
+			log.Printf("report: hide blog %s: %s", report.TargetID, err)
+		}
+	}
+
+	return &report, nil
+}
+
+// AssignReport hands an open report to assigneeID, or returns it to the
+// queue when assigneeID is nil.
+func AssignReport(id uint64, assigneeID *uuid.UUID) (*models.Report, error) {
+	report, err := openReport(id)
+	if err != nil {
+		return nil, err
+	}
+
+	status := models.ReportStatusAssigned
+	if assigneeID == nil {
+		status = models.ReportStatusOpen
+	}
+
+	if err := initializers.DB.Model(report).Updates(map[string]interface{}{
+		"assignee_id": assigneeID,
+		"status":      status,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("report: assign: %w", err)
+	}
+
+	return report, nil
+}
+
+// CloseReport resolves or dismisses an open report. Dismissing may bring a
+// hidden blog back.
+func CloseReport(id uint64, status, resolution string, adminID uuid.UUID) (*models.Report, error) {
+	report, err := openReport(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := initializers.DB.Model(report).Updates(map[string]interface{}{
+		"status":      status,
+		"resolution":  resolution,
+		"resolved_by": adminID,
+		"resolved_at": time.Now(),
+	}).Error; err != nil {
+		return nil, fmt.Errorf("report: close: %w", err)
+	}
+
+	if report.TargetType == models.ReportTargetPost && status == models.ReportStatusDismissed {
+		if err := unhideReportedBlog(report.TargetID); err != nil {
+			log.Printf("report: unhide blog %s: %s", report.TargetID, err)
+		}
+	}
+
+	return report, nil
+}
+
+// ReportHideThreshold is the number of distinct reporters that hides a blog.
+func ReportHideThreshold() int64 {
+	config, _ := initializers.LoadConfig(".")
+	if config.ReportHideThreshold <= 0 {
+		return DefaultReportHideThreshold
+	}
+	return int64(config.ReportHideThreshold)
+}
+
+func openReport(id uint64) (*models.Report, error) {
+	var report models.Report
+	if err := initializers.DB.First(&report, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReportNotFound
+		}
+		return nil, fmt.Errorf("report: load: %w", err)
+	}
+	if report.Status != models.ReportStatusOpen && report.Status != models.ReportStatusAssigned {
+		return nil, ErrReportClosed
+	}
+	return &report, nil
+}
+
+// reportTargetOwner checks that the target exists and returns its owner and
+// its ID in canonical form, so that "042" and "42" are the same post.
+func reportTargetOwner(targetType, targetID string) (uuid.UUID, string, error) {
+	if targetType == models.ReportTargetUser {
+		id, err := uuid.FromString(targetID)
+		if err != nil {
+			return uuid.Nil, "", ErrReportTargetMissing
+		}
+		var user models.User
+		if err := initializers.DB.Select("id").First(&user, "id = ?", id).Error; err != nil {
+			return uuid.Nil, "", reportTargetError(err)
+		}
+		return user.ID, id.String(), nil
+	}
+
+	id, err := strconv.ParseUint(targetID, 10, 64)
+	if err != nil {
+		return uuid.Nil, "", ErrReportTargetMissing
+	}
+
+	var owner struct{ UserID uuid.UUID }
+	var query *gorm.DB
+	switch targetType {
+	case models.ReportTargetPost:
+		query = initializers.DB.Model(&models.Blog{})
+	case models.ReportTargetMessage:
+		query = initializers.DB.Model(&models.ChatMessage{}).Where("is_deleted = ?", false)
+	case models.ReportTargetProfile:
+		query = initializers.DB.Model(&models.Profile{})
+	default:
+		return uuid.Nil, "", ErrReportTargetMissing
+	}
+	if err := query.Select("user_id").Where("id = ?", id).Take(&owner).Error; err != nil {
+		return uuid.Nil, "", reportTargetError(err)
+	}
+	return owner.UserID, strconv.FormatUint(id, 10), nil
+}
+
+func reportTargetError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrReportTargetMissing
+	}
+	return fmt.Errorf("report: load target: %w", err)
+}
+
+func openPostReporters(blogID string) (int64, error) {
+	var reporters int64
+	err := initializers.DB.Model(&models.Report{}).
+		Where("target_type = ? AND target_id = ? AND status IN ?", models.ReportTargetPost, blogID, openReportStatuses).
+		Distinct("reporter_id").
+		Count(&reporters).Error
+	return reporters, err
+}
+
+func hideReportedBlog(blogID string) error {
+	reporters, err := openPostReporters(blogID)
+	if err != nil {
+		return err
+	}
+	if reporters < ReportHideThreshold() {
+		return nil
+	}
+
+	var blog models.Blog
+	if err := initializers.DB.Preload("User").First(&blog, "id = ?", blogID).Error; err != nil {
+		return err
+	}
+
+	result := initializers.DB.Model(&models.Blog{}).
+		Where("id = ? AND status = ?", blog.ID, "ACTIVE").
+		Update("status", models.BlogStatusHidden)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	notifyBlogOwner(&blog, "Объявление скрыто",
+		fmt.Sprintf("Пост «%s» скрыт после жалоб пользователей и ожидает проверки.", blog.Title), "")
+	return nil
+}
+
+func unhideReportedBlog(blogID string) error {
+	reporters, err := openPostReporters(blogID)
+	if err != nil {
+		return err
+	}
+	if reporters >= ReportHideThreshold() {
+		return nil
+	}
+
+	var upheld int64
+	if err := initializers.DB.Model(&models.Report{}).
+		Where("target_type = ? AND target_id = ? AND status = ?", models.ReportTargetPost, blogID, models.ReportStatusResolved).
+		Count(&upheld).Error; err != nil {
+		return err
+	}
+	if upheld > 0 {
+		return nil
+	}
+
+	var blog models.Blog
+	if err := initializers.DB.Preload("User").First(&blog, "id = ?", blogID).Error; err != nil {
+		return err
+	}
+
+	result := initializers.DB.Model(&models.Blog{}).
+		Where("id = ? AND status = ?", blog.ID, models.BlogStatusHidden).
+		Update("status", gorm.Expr("CASE WHEN expired_at < ? THEN 'ARCHIVED' ELSE 'ACTIVE' END", time.Now()))
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	notifyBlogOwner(&blog, "Объявление восстановлено",
+		fmt.Sprintf("Жалобы на пост «%s» отклонены, он снова доступен.", blog.Title),
+		"/"+blog.UniqId+"/"+blog.Slug)
+	return nil
+}
@@ -0,0 +1,269 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm/clause"
+)
+
+// Saved filters (Presavedfilters) can subscribe to new blogs. Every
+// SavedSearchInterval the blogs that became ACTIVE since the last check are
+// run through each subscribed filter with the semantics of /blog/listAll.
+// Matches are recorded in saved_search_matches, so a blog is announced once
+// per filter even when it is archived and published again. Instant filters
+// are announced right away in-app, by push and by Telegram; daily ones are
+// collected by SendSavedSearchDigests into one message per user.
+const (
+	SavedSearchInterval = 5 * time.Minute
+	// Blogs are picked up a little before the last check so that one
+	// committed late is not missed; recorded matches keep them from repeating
+	savedSearchOverlap = time.Minute
+	// Blog titles listed in one message
+	savedSearchListLimit = 10
+)
+
+var (
+	ErrSavedSearchNotFound = errors.New("saved filter not found")
+	ErrSavedSearchInvalid  = errors.New("saved filter has invalid filters")
+)
+
+type savedSearchBlog struct {
+	ID     uint64
+	Title  string
+	UniqId string
+	Slug   string
+}
+
+// SetSavedSearchAlerts changes the alert mode of a user's saved filter.
+// Turning alerts on starts matching from now, existing blogs are not
+// announced.
+func SetSavedSearchAlerts(userID uuid.UUID, filterID uint64, mode string) (*models.Presavedfilters, error) {
+	var filter models.Presavedfilters
+	if err := initializers.DB.Where("id = ? AND user_id = ?", filterID, userID).First(&filter).Error; err != nil {
+		return nil, ErrSavedSearchNotFound
+	}
+
+	if mode != models.SavedSearchAlertsOff {
+		if _, err := savedSearchFilters(&filter); err != nil {
+			return nil, ErrSavedSearchInvalid
+		}
+	}
+
+	checkedAt := filter.AlertsCheckedAt
+	if mode == models.SavedSearchAlertsOff {
+		checkedAt = nil
+	} else if filter.Alerts == models.SavedSearchAlertsOff || checkedAt == nil {
+		now := time.Now()
+		checkedAt = &now
+	}
+	if err := initializers.DB.Model(&filter).Updates(map[string]interface{}{
+		"alerts":            mode,
+		"alerts_checked_at": checkedAt,
+	}).Error; err != nil {
+		return nil, err
+	}
+	filter.Alerts, filter.AlertsCheckedAt = mode, checkedAt
+
+	return &filter, nil
+}
+
+// RunSavedSearchAlerts matches new blogs against the subscribed filters and
+// announces the matches of instant filters.
+func RunSavedSearchAlerts(bot *tgbotapi.BotAPI) {
+	var filters []models.Presavedfilters
+	if err := initializers.DB.
+		Where("alerts IN ? AND meta IS NOT NULL", []string{models.SavedSearchAlertsInstant, models.SavedSearchAlertsDaily}).
+		Find(&filters).Error; err != nil {
+		log.Printf("saved search: %s", err)
+		return
+	}
+
+	for i := range filters {
+		if err := runSavedSearch(bot, &filters[i]); err != nil {
+			log.Printf("saved search: filter %d: %s", filters[i].ID, err)
+		}
+	}
+}
+
+func runSavedSearch(bot *tgbotapi.BotAPI, filter *models.Presavedfilters) error {
+	checkedAt := time.Now()
+
+	filters, err := savedSearchFilters(filter)
+	if err != nil {
+		return err
+	}
+
+	since := checkedAt.Add(-SavedSearchInterval)
+	if filter.AlertsCheckedAt != nil {
+		since = *filter.AlertsCheckedAt
+	}
+
+	ids := filters.MatchingIDs("").
+		Where("blogs.created_at > ?", since.Add(-savedSearchOverlap)).
+		Where("blogs.user_id <> ?", filter.UserID).
+		Where("NOT EXISTS (SELECT 1 FROM saved_search_matches m WHERE m.filter_id = ? AND m.blog_id = blogs.id)", filter.ID)
+
+	var blogs []savedSearchBlog
+	if err := initializers.DB.Table("blogs").
+		Select("id, title, uniq_id, slug").
+		Where("id IN (?)", ids).
+		Order("created_at, id").
+		Scan(&blogs).Error; err != nil {
+		return err
+	}
+
+	var fresh []savedSearchBlog
+	for _, blog := range blogs {
+		match := models.SavedSearchMatch{FilterID: filter.ID, BlogID: blog.ID, UserID: filter.UserID}
+		// Instant matches count as notified once recorded; a failed
+		// delivery is dropped rather than repeated
+		if filter.Alerts == models.SavedSearchAlertsInstant {
+			match.NotifiedAt = &checkedAt
+		}
+		result := initializers.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&match)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			fresh = append(fresh, blog)
+		}
+	}
+
+	if err := initializers.DB.Model(&models.Presavedfilters{}).
+		Where("id = ?", filter.ID).
+		UpdateColumn("alerts_checked_at", checkedAt).Error; err != nil {
+		return err
+	}
+
+	if filter.Alerts != models.SavedSearchAlertsInstant || len(fresh) == 0 {
+		return nil
+	}
+
+	title := fmt.Sprintf("Новое объявление по фильтру «%s»", filter.Name)
+	url := "/" + fresh[0].UniqId + "/" + fresh[0].Slug
+	if len(fresh) > 1 {
+		title = fmt.Sprintf("Новые объявления по фильтру «%s»: %d", filter.Name, len(fresh))
+		url = ""
+	}
+	notifySavedSearch(bot, filter.UserID, title, savedSearchList(fresh), url)
+	return nil
+}
+
+// SendSavedSearchDigests sends every user one message with the matches of
+// their daily filters collected since the previous digest.
+func SendSavedSearchDigests(bot *tgbotapi.BotAPI) {
+	startedAt := time.Now()
+
+	var rows []struct {
+		UserID     uuid.UUID
+		FilterID   uint64
+		FilterName string
+		ID         uint64
+		Title      string
+		UniqId     string
+		Slug       string
+	}
+	if err := initializers.DB.Table("saved_search_matches m").
+		Select("m.user_id, m.filter_id, f.name AS filter_name, b.id, b.title, b.uniq_id, b.slug").
+		Joins("JOIN presavedfilters f ON f.id = m.filter_id").
+		Joins("JOIN blogs b ON b.id = m.blog_id").
+		Where("m.notified_at IS NULL AND m.created_at <= ?", startedAt).
+		Where("f.alerts = ? AND b.status = ?", models.SavedSearchAlertsDaily, "ACTIVE").
+		Order("m.user_id, m.filter_id, m.created_at").
+		Scan(&rows).Error; err != nil {
+		log.Printf("saved search digest: %s", err)
+		return
+	}
+
+	// Matches whose blog is gone or whose filter left daily mode are dropped
+	// along with the sent ones
+	if err := initializers.DB.Model(&models.SavedSearchMatch{}).
+		Where("notified_at IS NULL AND created_at <= ?", startedAt).
+		UpdateColumn("notified_at", startedAt).Error; err != nil {
+		log.Printf("saved search digest: %s", err)
+		return
+	}
+
+	for start := 0; start < len(rows); {
+		userID := rows[start].UserID
+		var sections []string
+		total := 0
+		for start < len(rows) && rows[start].UserID == userID {
+			filterID, name := rows[start].FilterID, rows[start].FilterName
+			var blogs []savedSearchBlog
+			for ; start < len(rows) && rows[start].UserID == userID && rows[start].FilterID == filterID; start++ {
+				row := rows[start]
+				blogs = append(blogs, savedSearchBlog{ID: row.ID, Title: row.Title, UniqId: row.UniqId, Slug: row.Slug})
+			}
+			total += len(blogs)
+			sections = append(sections, fmt.Sprintf("«%s»: %d\n%s", name, len(blogs), savedSearchList(blogs)))
+		}
+
+		notifySavedSearch(bot, userID,
+			fmt.Sprintf("Новые объявления по вашим фильтрам: %d", total),
+			strings.Join(sections, "\n\n"), "")
+	}
+}
+
+// savedSearchFilters resolves the listing filters stored in a saved
+// filter's Meta, in the language stored along with them.
+func savedSearchFilters(filter *models.Presavedfilters) (*BlogFilters, error) {
+	language := filter.Meta["language"]
+	if language == "" {
+		language = models.DefaultLanguage
+	}
+	return ParseBlogFilters(filter.Meta, language)
+}
+
+func savedSearchList(blogs []savedSearchBlog) string {
+	lines := make([]string, 0, savedSearchListLimit+1)
+	for i, blog := range blogs {
+		if i == savedSearchListLimit {
+			lines = append(lines, fmt.Sprintf("и ещё %d", len(blogs)-i))
+			break
+		}
+		lines = append(lines, "— "+blog.Title)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func notifySavedSearch(bot *tgbotapi.BotAPI, userID uuid.UUID, title, message, url string) {
+	var user models.User
+	if err := initializers.DB.Select("id", "session", "device_ios", "tid", "telegram_activated").
+		First(&user, "id = ?", userID).Error; err != nil {
+		log.Printf("saved search: load user %s: %s", userID, err)
+		return
+	}
+
+	if err := Notification(title, message, userID.String(), url); err != nil {
+		log.Printf("saved search: notify %s: %s", userID, err)
+	} else if user.Session != "" {
+		SendPersonalMessageToClient(user.Session, "new_notification")
+	}
+
+	if user.DeviceIOS != "" {
+		if err := Push(title, message, user.DeviceIOS, url); err != nil {
+			log.Printf("saved search: push %s: %s", userID, err)
+		}
+	}
+
+	if bot != nil && user.TelegramActivated && user.Tid != 0 {
+		text := title + "\n\n" + message
+		if url != "" {
+			config, _ := initializers.LoadConfig(".")
+			text += "\n\n" + config.ClientOrigin + url
+		}
+		if _, err := bot.Send(tgbotapi.NewMessage(user.Tid, text)); err != nil {
+			log.Printf("saved search: telegram %s: %s", userID, err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Blogs are searched through a generated tsvector column on every
+// content_translations row, built with the text-search configuration of the
+// row's language and weighted by field: title A, description B, content C.
+// search_base covers the original text, whose language is unknown, with the
+// "simple" configuration. Postgres keeps generated columns up to date on
+// every insert and update.
+
+type searchLanguage struct {
+	Code   string
+	Config string
+}
+
+// Languages without a configuration here, Georgian among them, use
+// "simple", which only lowercases the words.
+var searchLanguages = map[string]searchLanguage{
+	"en": {Code: "en", Config: "english"},
+	"ru": {Code: "ru", Config: "russian"},
+	"es": {Code: "es", Config: "spanish"},
+}
+
+const blogSearchBaseConfig = "simple"
+
+// BlogSearchHit carries the rank and highlighted fragments of a found blog.
+type BlogSearchHit struct {
+	ID      uint64  `json:"-"`
+	Rank    float64 `json:"rank"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+}
+
+// MigrateBlogSearch adds the search columns and their GIN indexes. It is
+// safe to run repeatedly.
+func MigrateBlogSearch() error {
+	columns := []struct{ table, column, expr string }{
+		{"blogs", "search_base", searchVectorSQL(blogSearchBaseConfig, "title", "descr", "content")},
+		{"content_translations", "search", translationVectorSQL()},
+	}
+
+	for _, c := range columns {
+		if err := initializers.DB.Exec(fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s tsvector GENERATED ALWAYS AS (%s) STORED", c.table, c.column, c.expr,
+		)).Error; err != nil {
+			return fmt.Errorf("search: add %s.%s: %w", c.table, c.column, err)
+		}
+		if err := initializers.DB.Exec(fmt.Sprintf(
+			"CREATE INDEX IF NOT EXISTS idx_%s_%s ON %s USING GIN (%s)", c.table, c.column, c.table, c.column,
+		)).Error; err != nil {
+			return fmt.Errorf("search: index %s.%s: %w", c.table, c.column, err)
+		}
+	}
+
+	return nil
+}
+
+// SearchBlogs restricts query to blogs matching text in language and orders
+// them by rank, then by thenBy.
+func SearchBlogs(query *gorm.DB, text, language, thenBy string) *gorm.DB {
+	return OrderBlogsByRank(MatchBlogs(query, text, language), text, language, thenBy)
+}
+
+// MatchBlogs restricts query to blogs matching text in language.
+func MatchBlogs(query *gorm.DB, text, language string) *gorm.DB {
+	lang := blogSearchLanguage(language)
+
+	return query.Where(fmt.Sprintf(
+		"(blogs.id IN (SELECT entity_id FROM content_translations WHERE entity = 'blog' AND lang = ? AND search @@ websearch_to_tsquery('%s', ?))"+
+			" OR blogs.search_base @@ websearch_to_tsquery('%s', ?))",
+		lang.Config, blogSearchBaseConfig,
+	), lang.Code, text, text)
+}
+
+// OrderBlogsByRank orders query by relevance to text, then by thenBy. The
+// order is a single expression, a later Order call would replace it.
+func OrderBlogsByRank(query *gorm.DB, text, language, thenBy string) *gorm.DB {
+	return query.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:                blogSearchRankSQL(blogSearchLanguage(language)) + " DESC, " + thenBy,
+		Vars:               blogSearchRankVars(blogSearchLanguage(language), text),
+		WithoutParentheses: true,
+	}})
+}
+
+// BlogSearchHits ranks the given blogs against text and returns highlighted
+// title and description fragments keyed by blog ID.
+func BlogSearchHits(ids []uint64, text, language string) (map[uint64]BlogSearchHit, error) {
+	hits := make(map[uint64]BlogSearchHit, len(ids))
+	if len(ids) == 0 {
+		return hits, nil
+	}
+
+	lang := blogSearchLanguage(language)
+	title := "COALESCE(NULLIF((SELECT text FROM content_translations WHERE entity = 'blog' AND entity_id = blogs.id AND field = 'title' AND lang = ?), ''), title)"
+	descr := "COALESCE(NULLIF((SELECT text FROM content_translations WHERE entity = 'blog' AND entity_id = blogs.id AND field = 'descr' AND lang = ?), ''), descr)"
+	options := "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5"
+
+	var rows []BlogSearchHit
+	err := initializers.DB.Raw(fmt.Sprintf(`
+		SELECT id,
+			%s AS rank,
+			ts_headline('%s', %s, websearch_to_tsquery('%s', ?), 'HighlightAll=true, StartSel=<mark>, StopSel=</mark>') AS title,
+			ts_headline('%s', %s, websearch_to_tsquery('%s', ?), '%s') AS snippet
+		FROM blogs WHERE id IN ?`,
+		blogSearchRankSQL(lang),
+		lang.Config, title, lang.Config,
+		lang.Config, descr, lang.Config, options,
+	), append(blogSearchRankVars(lang, text), lang.Code, text, lang.Code, text, ids)...).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("search: highlight: %w", err)
+	}
+
+	for _, row := range rows {
+		hits[row.ID] = row
+	}
+	return hits, nil
+}
+
+func blogSearchLanguage(language string) searchLanguage {
+	language = models.NormalizeLanguage(language)
+	if language == "" {
+		language = models.DefaultLanguage
+	}
+	if lang, ok := searchLanguages[language]; ok {
+		return lang
+	}
+	return searchLanguage{Code: language, Config: blogSearchBaseConfig}
+}
+
+// blogSearchRankSQL sums the rank of the blog's translated fields and adds
+// the rank of search_base; matches in the original text rank lower. Its
+// arguments come from blogSearchRankVars.
+func blogSearchRankSQL(lang searchLanguage) string {
+	return fmt.Sprintf(
+		"(COALESCE((SELECT SUM(ts_rank(ct.search, websearch_to_tsquery('%s', ?))) FROM content_translations ct"+
+			" WHERE ct.entity = 'blog' AND ct.entity_id = blogs.id AND ct.lang = ?), 0)"+
+			" + 0.5 * ts_rank(blogs.search_base, websearch_to_tsquery('%s', ?)))",
+		lang.Config, blogSearchBaseConfig,
+	)
+}
+
+func blogSearchRankVars(lang searchLanguage, text string) []interface{} {
+	return []interface{}{text, lang.Code, text}
+}
+
+// translationVectorSQL picks the configuration by language and the weight
+// by field of a content_translations row.
+func translationVectorSQL() string {
+	codes := make([]string, 0, len(searchLanguages))
+	for code := range searchLanguages {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	config := "CASE lang"
+	for _, code := range codes {
+		config += fmt.Sprintf(" WHEN '%s' THEN '%s'::regconfig", code, searchLanguages[code].Config)
+	}
+	config += fmt.Sprintf(" ELSE '%s'::regconfig END", blogSearchBaseConfig)
+
+	return fmt.Sprintf(
+		`setweight(to_tsvector(%s, coalesce(text, '')), (CASE field WHEN 'title' THEN 'A' WHEN 'descr' THEN 'B' ELSE 'C' END)::"char")`,
+		config,
+	)
+}
+
+func searchVectorSQL(config, title, descr, content string) string {
+	return fmt.Sprintf(
+		"setweight(to_tsvector('%[1]s', coalesce(%[2]s, '')), 'A') || "+
+			"setweight(to_tsvector('%[1]s', coalesce(%[3]s, '')), 'B') || "+
+			"setweight(to_tsvector('%[1]s', coalesce(%[4]s, '')), 'C')",
+		config, title, descr, content,
+	)
+}
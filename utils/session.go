@@ -0,0 +1,275 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"hyperpage/initializers"
+
+	"github.com/redis/go-redis/v9"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Every login opens a device session. Refresh tokens issued for that session
+// form a family: each refresh rotates the token, and presenting an already
+// rotated token revokes the whole family.
+//
+// Redis layout:
+//
+//	session:<sessionID>           JSON Session, expires with the refresh token
+//	user_sessions:<userID>        set of session IDs owned by the user
+//	refresh_token:<tokenUuid>     session ID the refresh token belongs to
+//	refresh_token_used:<tokenUuid> set once the token has been rotated
+const (
+	sessionKeyPrefix          = "session:"
+	userSessionsKeyPrefix     = "user_sessions:"
+	refreshTokenKeyPrefix     = "refresh_token:"
+	refreshTokenUsedKeyPrefix = "refresh_token_used:"
+)
+
+// RecentSignInMaxAge is how old a session may be for sensitive changes by
+// accounts that have no password to confirm.
+const RecentSignInMaxAge = 10 * time.Minute
+
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrRefreshTokenRevoked = errors.New("refresh token has been revoked")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, all tokens of this session were revoked")
+)
+
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// StartSession registers a new device session for the user.
+func StartSession(userID, device, ip string, ttl time.Duration) (*Session, error) {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+
+	session := &Session{
+		ID:         uuid.NewV4().String(),
+		UserID:     userID,
+		Device:     device,
+		IP:         ip,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	if err := saveSession(ctx, session, ttl); err != nil {
+		return nil, err
+	}
+
+	if err := initializers.RedisClient.SAdd(ctx, userSessionsKeyPrefix+userID, session.ID).Err(); err != nil {
+		return nil, fmt.Errorf("session: track user session: %w", err)
+	}
+
+	return session, nil
+}
+
+// RegisterRefreshToken records a freshly issued refresh token so it can be
+// rotated exactly once.
+func RegisterRefreshToken(td *TokenDetails, ttl time.Duration) error {
+	ctx := context.TODO()
+
+	if err := initializers.RedisClient.Set(ctx, refreshTokenKeyPrefix+td.TokenUuid, td.SessionID, ttl).Err(); err != nil {
+		return fmt.Errorf("session: register refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeRefreshToken marks a validated refresh token as used and returns the
+// session it belongs to. A second use of the same token revokes the session.
+func ConsumeRefreshToken(td *TokenDetails, ttl time.Duration) (*Session, error) {
+	ctx := context.TODO()
+
+	sessionID, err := initializers.RedisClient.Get(ctx, refreshTokenKeyPrefix+td.TokenUuid).Result()
+	if err == redis.Nil {
+		return nil, ErrRefreshTokenRevoked
+	} else if err != nil {
+		return nil, fmt.Errorf("session: lookup refresh token: %w", err)
+	}
+
+	first, err := initializers.RedisClient.SetNX(ctx, refreshTokenUsedKeyPrefix+td.TokenUuid, time.Now().UTC().Unix(), ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("session: mark refresh token used: %w", err)
+	}
+
+	if !first {
+		if err := RevokeSession(td.UserID, sessionID); err != nil && err != ErrSessionNotFound {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	session, err := GetSession(sessionID)
+	if err == ErrSessionNotFound {
+		return nil, ErrRefreshTokenRevoked
+	} else if err != nil {
+		return nil, err
+	}
+
+	if session.UserID != td.UserID {
+		return nil, ErrRefreshTokenRevoked
+	}
+
+	now := time.Now().UTC()
+	session.LastUsedAt = now
+	session.ExpiresAt = now.Add(ttl)
+	if err := saveSession(ctx, session, ttl); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func GetSession(sessionID string) (*Session, error) {
+	ctx := context.TODO()
+
+	data, err := initializers.RedisClient.Get(ctx, sessionKeyPrefix+sessionID).Bytes()
+	if err == redis.Nil {
+		return nil, ErrSessionNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("session: get: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("session: decode: %w", err)
+	}
+
+	return &session, nil
+}
+
+// IsRecentSignIn reports whether sessionID was opened by a sign-in within
+// RecentSignInMaxAge. Refreshing tokens does not make a session recent.
+func IsRecentSignIn(sessionID string) (bool, error) {
+	session, err := GetSession(sessionID)
+	if err == ErrSessionNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return time.Since(session.CreatedAt) <= RecentSignInMaxAge, nil
+}
+
+// IsSessionActive reports whether tokens bound to sessionID are still honoured.
+func IsSessionActive(sessionID string) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+
+	n, err := initializers.RedisClient.Exists(context.TODO(), sessionKeyPrefix+sessionID).Result()
+	if err != nil {
+		return false, fmt.Errorf("session: exists: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// ListSessions returns the live sessions of a user and drops expired IDs from
+// the user's set.
+func ListSessions(userID string) ([]Session, error) {
+	ctx := context.TODO()
+
+	ids, err := initializers.RedisClient.SMembers(ctx, userSessionsKeyPrefix+userID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("session: list: %w", err)
+	}
+
+	sessions := make([]Session, 0, len(ids))
+	for _, id := range ids {
+		session, err := GetSession(id)
+		if err == ErrSessionNotFound {
+			initializers.RedisClient.SRem(ctx, userSessionsKeyPrefix+userID, id)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession deletes a single session of the user. Access and refresh
+// tokens carrying its ID stop working immediately. A session of another user
+// is reported as not found and left alone.
+func RevokeSession(userID, sessionID string) error {
+	ctx := context.TODO()
+
+	session, err := GetSession(sessionID)
+	if err == ErrSessionNotFound {
+		session = nil
+	} else if err != nil {
+		return err
+	}
+	if session != nil && session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	removed, err := initializers.RedisClient.SRem(ctx, userSessionsKeyPrefix+userID, sessionID).Result()
+	if err != nil {
+		return fmt.Errorf("session: revoke: %w", err)
+	}
+	if session == nil {
+		if removed == 0 {
+			return ErrSessionNotFound
+		}
+		return nil
+	}
+
+	if err := initializers.RedisClient.Del(ctx, sessionKeyPrefix+sessionID).Err(); err != nil {
+		return fmt.Errorf("session: revoke: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllSessions deletes every session of the user except keepSessionID,
+// which may be empty. It returns the number of revoked sessions.
+func RevokeAllSessions(userID, keepSessionID string) (int, error) {
+	ctx := context.TODO()
+
+	ids, err := initializers.RedisClient.SMembers(ctx, userSessionsKeyPrefix+userID).Result()
+	if err != nil {
+		return 0, fmt.Errorf("session: revoke all: %w", err)
+	}
+
+	revoked := 0
+	for _, id := range ids {
+		if id == keepSessionID {
+			continue
+		}
+		if err := RevokeSession(userID, id); err != nil && err != ErrSessionNotFound {
+			return revoked, err
+		}
+		revoked++
+	}
+
+	return revoked, nil
+}
+
+func saveSession(ctx context.Context, session *Session, ttl time.Duration) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("session: encode: %w", err)
+	}
+
+	if err := initializers.RedisClient.Set(ctx, sessionKeyPrefix+session.ID, data, ttl).Err(); err != nil {
+		return fmt.Errorf("session: save: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func startTestSession(t *testing.T, userID string) *Session {
+	t.Helper()
+
+	session, err := StartSession(userID, "test", "127.0.0.1", time.Hour)
+	if err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	return session
+}
+
+func sessionActive(t *testing.T, sessionID string) bool {
+	t.Helper()
+
+	active, err := IsSessionActive(sessionID)
+	if err != nil {
+		t.Fatalf("IsSessionActive: %v", err)
+	}
+	return active
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	useFakeRedis(t)
+	session := startTestSession(t, "alice")
+
+	first := &TokenDetails{TokenUuid: "token-1", UserID: "alice", SessionID: session.ID}
+	if err := RegisterRefreshToken(first, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ConsumeRefreshToken(first, time.Hour)
+	if err != nil || got.ID != session.ID {
+		t.Fatalf("first use: %+v, %v", got, err)
+	}
+
+	second := &TokenDetails{TokenUuid: "token-2", UserID: "alice", SessionID: session.ID}
+	if err := RegisterRefreshToken(second, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConsumeRefreshToken(second, time.Hour); err != nil {
+		t.Fatalf("rotated token: %v", err)
+	}
+
+	if _, err := ConsumeRefreshToken(&TokenDetails{TokenUuid: "unknown", UserID: "alice"}, time.Hour); err != ErrRefreshTokenRevoked {
+		t.Fatalf("unknown token: error = %v, want %v", err, ErrRefreshTokenRevoked)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	useFakeRedis(t)
+	session := startTestSession(t, "alice")
+	other := startTestSession(t, "alice")
+
+	td := &TokenDetails{TokenUuid: "token-1", UserID: "alice", SessionID: session.ID}
+	if err := RegisterRefreshToken(td, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConsumeRefreshToken(td, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ConsumeRefreshToken(td, time.Hour); err != ErrRefreshTokenReused {
+		t.Fatalf("reuse: error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	if sessionActive(t, session.ID) {
+		t.Fatal("the session survived the reuse of its refresh token")
+	}
+	if !sessionActive(t, other.ID) {
+		t.Fatal("reuse revoked another session of the user")
+	}
+	if _, err := ConsumeRefreshToken(td, time.Hour); err != ErrRefreshTokenReused {
+		t.Fatalf("after revocation: error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	useFakeRedis(t)
+	alice := startTestSession(t, "alice")
+	bob := startTestSession(t, "bob")
+
+	if err := RevokeSession("alice", bob.ID); err != ErrSessionNotFound {
+		t.Fatalf("another user's session: error = %v, want %v", err, ErrSessionNotFound)
+	}
+	if !sessionActive(t, bob.ID) {
+		t.Fatal("a user revoked another user's session")
+	}
+
+	if err := RevokeSession("alice", alice.ID); err != nil {
+		t.Fatalf("own session: %v", err)
+	}
+	if sessionActive(t, alice.ID) {
+		t.Fatal("the revoked session is still active")
+	}
+	if err := RevokeSession("alice", alice.ID); err != ErrSessionNotFound {
+		t.Fatalf("revoked twice: error = %v, want %v", err, ErrSessionNotFound)
+	}
+	if err := RevokeSession("alice", "unknown"); err != ErrSessionNotFound {
+		t.Fatalf("unknown session: error = %v, want %v", err, ErrSessionNotFound)
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	useFakeRedis(t)
+	current := startTestSession(t, "alice")
+	startTestSession(t, "alice")
+	startTestSession(t, "alice")
+	bob := startTestSession(t, "bob")
+
+	revoked, err := RevokeAllSessions("alice", current.ID)
+	if err != nil || revoked != 2 {
+		t.Fatalf("RevokeAllSessions = %d, %v; want 2", revoked, err)
+	}
+
+	sessions, err := ListSessions("alice")
+	if err != nil || len(sessions) != 1 || sessions[0].ID != current.ID {
+		t.Fatalf("remaining sessions %+v, %v", sessions, err)
+	}
+	if !sessionActive(t, bob.ID) {
+		t.Fatal("another user's session was revoked")
+	}
+}
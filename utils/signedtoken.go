@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"hyperpage/initializers"
+)
+
+// Values handed to clients that must come back unchanged — mailed links,
+// data export download links and list cursors — carry an HMAC-SHA256
+// signature keyed with TOKEN_SECRET. The scope is part of the signed input so
+// that a signature issued for one kind of token is not valid for another.
+var ErrTokenSecretMissing = errors.New("TOKEN_SECRET is not set")
+
+// CheckTokenSecret reports whether config can sign tokens. It is checked at
+// startup so that a missing secret fails the boot instead of every request.
+func CheckTokenSecret(config *initializers.Config) error {
+	if config.TokenSecret == "" {
+		return ErrTokenSecretMissing
+	}
+	return nil
+}
+
+func signToken(scope, id string) (string, error) {
+	config, _ := initializers.LoadConfig(".")
+	if err := CheckTokenSecret(&config); err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.TokenSecret))
+	mac.Write([]byte(scope + ":" + id))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hyperpage/initializers"
+)
+
+// TelegramAuthMaxAge bounds how old a Login Widget payload may be. A payload
+// is accepted once: its hash is kept in Redis until it would expire anyway.
+//
+// Redis layout:
+//
+//	telegram_used:<hash>  used Login Widget payload
+const (
+	TelegramAuthMaxAge = 5 * time.Minute
+
+	telegramAuthClockSkew = time.Minute
+	telegramUsedKeyPrefix = "telegram_used:"
+)
+
+var (
+	ErrTelegramHashInvalid = errors.New("telegram login data has an invalid signature")
+	ErrTelegramAuthExpired = errors.New("telegram login data is outdated")
+	ErrTelegramAuthUsed    = errors.New("telegram login data has already been used")
+)
+
+// VerifyTelegramLogin checks a Telegram Login Widget payload as described in
+// https://core.telegram.org/widgets/login#checking-authorization: the hash is
+// HMAC-SHA256 of the sorted "key=value" lines keyed with SHA256(bot token).
+// fields holds every received field except hash; its signed auth_date must
+// be within TelegramAuthMaxAge of now.
+func VerifyTelegramLogin(fields map[string]string, hash, botToken string, now time.Time) error {
+	keys := make([]string, 0, len(fields))
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, key+"="+fields[key])
+	}
+
+	secret := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(hash))) {
+		return ErrTelegramHashInvalid
+	}
+
+	authDate, err := strconv.ParseInt(fields["auth_date"], 10, 64)
+	if err != nil {
+		return ErrTelegramAuthExpired
+	}
+	age := now.Sub(time.Unix(authDate, 0))
+	if age > TelegramAuthMaxAge || age < -telegramAuthClockSkew {
+		return ErrTelegramAuthExpired
+	}
+
+	return nil
+}
+
+// MarkTelegramLoginUsed rejects replay of a verified Login Widget payload.
+func MarkTelegramLoginUsed(hash string) error {
+	key := telegramUsedKeyPrefix + strings.ToLower(hash)
+
+	first, err := initializers.RedisClient.SetNX(context.TODO(), key, 1, TelegramAuthMaxAge+telegramAuthClockSkew).Result()
+	if err != nil {
+		return fmt.Errorf("telegram: mark login used: %w", err)
+	}
+	if !first {
+		return ErrTelegramAuthUsed
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signTelegramLogin(botToken, data string) string {
+	secret := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// telegramLoginFields returns the fields of a Login Widget payload sent at
+// authDate and their hash signed with botToken.
+func telegramLoginFields(botToken, authDate string) (map[string]string, string) {
+	fields := map[string]string{"id": "42", "first_name": "Ann", "username": "", "auth_date": authDate}
+
+	data := "first_name=Ann\nid=42"
+	if authDate != "" {
+		data = "auth_date=" + authDate + "\n" + data
+	}
+	return fields, signTelegramLogin(botToken, data)
+}
+
+func TestVerifyTelegramLogin(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	at := func(d time.Time) string { return strconv.FormatInt(d.Unix(), 10) }
+
+	tests := []struct {
+		name     string
+		authDate string
+		hash     func(hash string) string
+		botToken string
+		want     error
+	}{
+		{name: "valid", authDate: at(now), botToken: "bot-token"},
+		{name: "uppercase hash", authDate: at(now), hash: strings.ToUpper, botToken: "bot-token"},
+		{name: "other bot", authDate: at(now), botToken: "other-token", want: ErrTelegramHashInvalid},
+		{name: "within max age", authDate: at(now.Add(-TelegramAuthMaxAge)), botToken: "bot-token"},
+		{name: "older than max age", authDate: at(now.Add(-TelegramAuthMaxAge - time.Second)), botToken: "bot-token", want: ErrTelegramAuthExpired},
+		{name: "from the future", authDate: at(now.Add(2 * time.Minute)), botToken: "bot-token", want: ErrTelegramAuthExpired},
+		{name: "no auth date", botToken: "bot-token", want: ErrTelegramAuthExpired},
+		{name: "invalid auth date", authDate: "yesterday", botToken: "bot-token", want: ErrTelegramAuthExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, hash := telegramLoginFields("bot-token", tt.authDate)
+			if tt.hash != nil {
+				hash = tt.hash(hash)
+			}
+			if err := VerifyTelegramLogin(fields, hash, tt.botToken, now); err != tt.want {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("tampered auth date", func(t *testing.T) {
+		fields, hash := telegramLoginFields("bot-token", at(now.Add(-time.Hour)))
+		fields["auth_date"] = at(now)
+		if err := VerifyTelegramLogin(fields, hash, "bot-token", now); err != ErrTelegramHashInvalid {
+			t.Fatalf("error = %v, want %v", err, ErrTelegramHashInvalid)
+		}
+	})
+}
+
+func TestMarkTelegramLoginUsed(t *testing.T) {
+	useFakeRedis(t)
+
+	if err := MarkTelegramLoginUsed("ABCDEF"); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := MarkTelegramLoginUsed("abcdef"); err != ErrTelegramAuthUsed {
+		t.Fatalf("replay: error = %v, want %v", err, ErrTelegramAuthUsed)
+	}
+	if err := MarkTelegramLoginUsed("012345"); err != nil {
+		t.Fatalf("another payload: %v", err)
+	}
+}
@@ -13,10 +13,13 @@ type TokenDetails struct {
 	Token     *string
 	TokenUuid string
 	UserID    string
+	SessionID string
 	ExpiresIn *int64
 }
 
-func CreateToken(userid string, ttl time.Duration, privateKey string) (*TokenDetails, error) {
+// CreateToken signs a token for userid. sessionID ties the token to a device
+// session in the Redis registry (see session.go) so it can be revoked.
+func CreateToken(userid string, sessionID string, ttl time.Duration, privateKey string) (*TokenDetails, error) {
 	now := time.Now().UTC()
 	td := &TokenDetails{
 		ExpiresIn: new(int64),
@@ -25,6 +28,7 @@ func CreateToken(userid string, ttl time.Duration, privateKey string) (*TokenDet
 	*td.ExpiresIn = now.Add(ttl).Unix()
 	td.TokenUuid = uuid.NewV4().String()
 	td.UserID = userid
+	td.SessionID = sessionID
 
 	decodedPrivateKey, err := base64.StdEncoding.DecodeString(privateKey)
 	if err != nil {
@@ -39,6 +43,7 @@ func CreateToken(userid string, ttl time.Duration, privateKey string) (*TokenDet
 	atClaims := make(jwt.MapClaims)
 	atClaims["sub"] = userid
 	atClaims["token_uuid"] = td.TokenUuid
+	atClaims["sid"] = td.SessionID
 	atClaims["exp"] = td.ExpiresIn
 	atClaims["iat"] = now.Unix()
 	atClaims["nbf"] = now.Unix()
@@ -79,8 +84,11 @@ func ValidateToken(token string, publicKey string) (*TokenDetails, error) {
 		return nil, fmt.Errorf("validate: invalid token")
 	}
 
+	sessionID, _ := claims["sid"].(string)
+
 	return &TokenDetails{
 		TokenUuid: fmt.Sprint(claims["token_uuid"]),
 		UserID:    fmt.Sprint(claims["sub"]),
+		SessionID: sessionID,
 	}, nil
 }
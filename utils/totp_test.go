@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The RFC lists 8 digits; the last 6 are the 6-digit codes
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		ok       bool
+	}{
+		{name: "current", secret: rfc6238Secret, code: "005924", wantStep: step, ok: true},
+		{name: "lowercase secret and spaces", secret: " " + strings.ToLower(rfc6238Secret), code: " 005924 ", wantStep: step, ok: true},
+		{name: "previous period", secret: rfc6238Secret, code: totpCode(key, step-1), wantStep: step - 1, ok: true},
+		{name: "next period", secret: rfc6238Secret, code: totpCode(key, step+1), wantStep: step + 1, ok: true},
+		{name: "two periods ago", secret: rfc6238Secret, code: totpCode(key, step-2)},
+		{name: "wrong code", secret: rfc6238Secret, code: "000000"},
+		{name: "short code", secret: rfc6238Secret, code: "05924"},
+		{name: "eight digits", secret: rfc6238Secret, code: "89005924"},
+		{name: "bad secret", secret: "not base32!", code: "005924"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(tt.secret, tt.code, now)
+			if ok != tt.ok || gotStep != tt.wantStep {
+				t.Fatalf("ValidateTOTP = %d, %v; want %d, %v", gotStep, ok, tt.wantStep, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGeneratedSecretValidates(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if _, ok := ValidateTOTP(secret, totpCode(key, now.Unix()/totpPeriod), now); !ok {
+		t.Fatal("the current code of a generated secret does not validate")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("%d codes and %d hashes, want %d", len(codes), len(hashes), RecoveryCodeCount)
+	}
+
+	for i, code := range codes {
+		if HashRecoveryCode(code) != hashes[i] {
+			t.Fatalf("hash of %s does not match", code)
+		}
+		// Users may type the code without the dash, in capitals or with spaces
+		typed := " " + strings.ToUpper(strings.ReplaceAll(code, "-", "")) + " "
+		if HashRecoveryCode(typed) != hashes[i] {
+			t.Fatalf("hash of %q differs from %s", typed, code)
+		}
+	}
+}
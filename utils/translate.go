@@ -0,0 +1,639 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	gt "github.com/bas24/googletranslatefree"
+	"github.com/redis/go-redis/v9"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Blog and profile texts are translated in the background into every
+// language of the langs table and stored as content_translations rows.
+// Saving a text fills every language right away from author overrides, the
+// cache or the source text itself, and queues a job for the languages still
+// missing. The workers translate them, store them when the source is
+// unchanged and tell the author's open session.
+//
+// Redis layout:
+//
+//	translation:<sha256 of from, to, text>  cached translation
+//	translation_queue                       pending TranslationJob list
+const (
+	TranslationCacheTTL  = 30 * 24 * time.Hour
+	TranslationWorkers   = 2
+	TranslationAttempts  = 3
+	translationKeyPrefix = "translation:"
+	translationQueueKey  = "translation_queue"
+)
+
+var ErrTranslationField = errors.New("field cannot be translated")
+
+// Translator translates text between language codes.
+type Translator interface {
+	Translate(text, from, to string) (string, error)
+}
+
+// GoogleTranslator uses the free Google Translate endpoint.
+type GoogleTranslator struct{}
+
+func (GoogleTranslator) Translate(text, from, to string) (string, error) {
+	return gt.Translate(text, from, to)
+}
+
+// FakeTranslator prefixes the text with the target code. It needs no network
+// and always gives the same result, for tests and local runs.
+type FakeTranslator struct{}
+
+func (FakeTranslator) Translate(text, from, to string) (string, error) {
+	return "[" + to + "] " + text, nil
+}
+
+var (
+	translator     Translator
+	translatorOnce sync.Once
+)
+
+// SetTranslator replaces the provider chosen by TRANSLATOR.
+func SetTranslator(t Translator) {
+	translatorOnce.Do(func() {})
+	translator = t
+}
+
+// CurrentTranslator returns the provider chosen by TRANSLATOR, "google" by
+// default or "fake".
+func CurrentTranslator() Translator {
+	translatorOnce.Do(func() {
+		config, _ := initializers.LoadConfig(".")
+		switch config.Translator {
+		case "fake":
+			translator = FakeTranslator{}
+		default:
+			translator = GoogleTranslator{}
+		}
+	})
+	return translator
+}
+
+// TranslationJob asks the workers to translate one field. Hash is the hash
+// of the source text when the job was queued.
+type TranslationJob struct {
+	Entity   string `json:"entity"`
+	ID       uint64 `json:"id"`
+	Field    string `json:"field"`
+	Hash     string `json:"hash"`
+	Attempts int    `json:"attempts"`
+}
+
+// translatableEntity maps the translated fields of an entity to the columns
+// holding their source text.
+type translatableEntity struct {
+	table  string
+	fields map[string]string
+}
+
+var translatableEntities = map[string]translatableEntity{
+	models.TranslationEntityBlog: {
+		table:  "blogs",
+		fields: map[string]string{"title": "title", "descr": "descr", "content": "content"},
+	},
+	models.TranslationEntityProfile: {
+		table:  "profiles",
+		fields: map[string]string{"descr": "descr", "additional": "additional"},
+	},
+}
+
+// TranslateFields fills the translations of the given fields of an entity
+// and queues the languages that are not cached.
+func TranslateFields(entity string, id uint64, fields ...string) error {
+	for _, field := range fields {
+		missing, hash, err := fillFieldTranslations(entity, id, field, false)
+		if err != nil {
+			return err
+		}
+		if !missing {
+			continue
+		}
+		if err := queueTranslation(TranslationJob{Entity: entity, ID: id, Field: field, Hash: hash}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrefillTranslations returns text in every language, cached translations
+// where there are some and text itself elsewhere, without calling the
+// translator.
+func PrefillTranslations(text, from string) models.Multilang {
+	m := models.Multilang{}
+
+	var langs []models.Langs
+	if err := initializers.DB.Find(&langs).Error; err != nil {
+		log.Printf("translate: load languages: %s", err)
+		return m
+	}
+
+	if from == "" {
+		from = "auto"
+	}
+	for _, lang := range langs {
+		value, ok := cachedTranslation(text, from, lang.Code)
+		if !ok {
+			value = text
+		}
+		m[lang.Code] = value
+	}
+	return m
+}
+
+// SaveTranslations stores the given languages of a field.
+func SaveTranslations(tx *gorm.DB, entity string, id uint64, field string, values models.Multilang) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	rows := make([]models.ContentTranslation, 0, len(values))
+	for lang, text := range values {
+		rows = append(rows, models.ContentTranslation{Entity: entity, EntityID: id, Field: field, Lang: lang, Text: text})
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "entity"}, {Name: "entity_id"}, {Name: "field"}, {Name: "lang"}},
+		DoUpdates: clause.AssignmentColumns([]string{"text", "updated_at"}),
+	}).Create(&rows).Error
+}
+
+// TranslateText translates text through the cache.
+func TranslateText(text, from, to string) (string, error) {
+	if text == "" || from == to {
+		return text, nil
+	}
+
+	ctx := context.TODO()
+	key := translationKeyPrefix + translationHash(from, to, text)
+
+	cached, err := initializers.RedisClient.Get(ctx, key).Result()
+	if err == nil {
+		return cached, nil
+	}
+	if err != redis.Nil {
+		log.Printf("translate: cache: %s", err)
+	}
+
+	result, err := CurrentTranslator().Translate(text, from, to)
+	if err != nil {
+		return "", fmt.Errorf("translate %s->%s: %w", from, to, err)
+	}
+	if err := initializers.RedisClient.Set(ctx, key, result, TranslationCacheTTL).Err(); err != nil {
+		log.Printf("translate: cache: %s", err)
+	}
+	return result, nil
+}
+
+// SetTranslationOverride stores the author's translation of a field and
+// applies it at once.
+func SetTranslationOverride(entity string, id uint64, input *models.TranslationOverrideInput, userID uuid.UUID) (*models.TranslationOverride, error) {
+	column, err := lookupTranslatableField(entity, input.Field)
+	if err != nil {
+		return nil, err
+	}
+
+	var langs int64
+	if err := initializers.DB.Model(&models.Langs{}).Where("code = ?", input.Lang).Count(&langs).Error; err != nil {
+		return nil, fmt.Errorf("translate: load languages: %w", err)
+	}
+	if langs == 0 {
+		return nil, ErrTranslationField
+	}
+
+	source, _, err := translationSource(entity, id, column)
+	if err != nil {
+		return nil, err
+	}
+
+	override := models.TranslationOverride{Entity: entity, EntityID: id, Field: input.Field, Lang: input.Lang}
+	if err := initializers.DB.Where(override).
+		Assign(models.TranslationOverride{Text: input.Text, SourceHash: textHash(source), UserID: userID}).
+		FirstOrCreate(&override).Error; err != nil {
+		return nil, fmt.Errorf("translate: save override: %w", err)
+	}
+
+	if err := SaveTranslations(initializers.DB, entity, id, input.Field, models.Multilang{input.Lang: input.Text}); err != nil {
+		return nil, fmt.Errorf("translate: apply override: %w", err)
+	}
+
+	return &override, nil
+}
+
+// DeleteTranslationOverride drops the author's translation and goes back to
+// the machine one.
+func DeleteTranslationOverride(entity string, id uint64, fieldName, lang string) error {
+	if _, err := lookupTranslatableField(entity, fieldName); err != nil {
+		return err
+	}
+
+	if err := initializers.DB.
+		Where("entity = ? AND entity_id = ? AND field = ? AND lang = ?", entity, id, fieldName, lang).
+		Delete(&models.TranslationOverride{}).Error; err != nil {
+		return fmt.Errorf("translate: delete override: %w", err)
+	}
+
+	return TranslateFields(entity, id, fieldName)
+}
+
+// DeleteTranslations removes the translations and overrides of an entity.
+func DeleteTranslations(entity string, id uint64) error {
+	if err := initializers.DB.Where("entity = ? AND entity_id = ?", entity, id).Delete(&models.ContentTranslation{}).Error; err != nil {
+		return err
+	}
+	return initializers.DB.Where("entity = ? AND entity_id = ?", entity, id).Delete(&models.TranslationOverride{}).Error
+}
+
+// TranslateAllContent queues every translated field of every blog and
+// profile, so that a newly added language gets filled in.
+func TranslateAllContent() {
+	for entity, e := range translatableEntities {
+		for field, column := range e.fields {
+			var rows []struct {
+				ID     uint64
+				Source string
+			}
+			err := initializers.DB.Table(e.table).
+				Select("id, COALESCE("+column+", '') AS source").
+				Where("COALESCE("+column+", '') <> ''").
+				FindInBatches(&rows, 500, func(tx *gorm.DB, batch int) error {
+					for _, row := range rows {
+						if err := queueTranslation(TranslationJob{Entity: entity, ID: row.ID, Field: field, Hash: textHash(row.Source)}); err != nil {
+							return err
+						}
+					}
+					return nil
+				}).Error
+			if err != nil {
+				log.Printf("translate: queue %s %s: %s", entity, field, err)
+			}
+		}
+	}
+}
+
+// DeleteLanguageTranslations removes the stored translations into a language.
+func DeleteLanguageTranslations(lang string) error {
+	if err := initializers.DB.Where("lang = ?", lang).Delete(&models.ContentTranslation{}).Error; err != nil {
+		return err
+	}
+	return initializers.DB.Where("lang = ?", lang).Delete(&models.TranslationOverride{}).Error
+}
+
+// RunTranslationWorkers processes queued jobs until the process exits.
+func RunTranslationWorkers() {
+	for i := 0; i < TranslationWorkers; i++ {
+		go runTranslationWorker()
+	}
+}
+
+func runTranslationWorker() {
+	for {
+		job, err := nextTranslationJob(0)
+		if errors.Is(err, errTranslationJobInvalid) {
+			log.Printf("translate: %s", err)
+			continue
+		} else if err != nil {
+			log.Printf("translate: queue: %s", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		processTranslationJob(*job)
+	}
+}
+
+var errTranslationJobInvalid = errors.New("bad job")
+
+// nextTranslationJob waits up to timeout, forever when it is 0, for a
+// queued job.
+func nextTranslationJob(timeout time.Duration) (*TranslationJob, error) {
+	item, err := initializers.RedisClient.BRPop(context.TODO(), timeout, translationQueueKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var job TranslationJob
+	if err := json.Unmarshal([]byte(item[1]), &job); err != nil {
+		return nil, fmt.Errorf("%w %q: %s", errTranslationJobInvalid, item[1], err)
+	}
+	return &job, nil
+}
+
+// fillFieldTranslations and notifyTranslation are replaced in tests, which
+// have no database.
+var (
+	fillFieldTranslations = fillTranslations
+	notifyTranslation     = notifyTranslationOwner
+)
+
+func processTranslationJob(job TranslationJob) {
+	missing, hash, err := fillFieldTranslations(job.Entity, job.ID, job.Field, true)
+	if err != nil {
+		log.Printf("translate: %s %d %s: %s", job.Entity, job.ID, job.Field, err)
+		return
+	}
+	// The text changed after the job was queued; its own job takes over
+	if hash != job.Hash {
+		return
+	}
+
+	if missing {
+		job.Attempts++
+		if job.Attempts < TranslationAttempts {
+			if err := queueTranslation(job); err != nil {
+				log.Printf("translate: requeue: %s", err)
+			}
+		}
+		return
+	}
+
+	notifyTranslation(job)
+}
+
+// fillTranslations stores overrides, cached translations and, when translate
+// is set, fresh translations of a field in every language. Languages left
+// without a translation hold the source text. It reports whether some
+// language is still missing and the hash of the source text.
+func fillTranslations(entity string, id uint64, fieldName string, translate bool) (bool, string, error) {
+	column, err := lookupTranslatableField(entity, fieldName)
+	if err != nil {
+		return false, "", err
+	}
+
+	source, from, err := translationSource(entity, id, column)
+	if err != nil {
+		return false, "", err
+	}
+	hash := textHash(source)
+
+	var langs []models.Langs
+	if err := initializers.DB.Find(&langs).Error; err != nil {
+		return false, hash, fmt.Errorf("translate: load languages: %w", err)
+	}
+
+	var overrides []models.TranslationOverride
+	if err := initializers.DB.Where("entity = ? AND entity_id = ? AND field = ?", entity, id, fieldName).
+		Find(&overrides).Error; err != nil {
+		return false, hash, fmt.Errorf("translate: load overrides: %w", err)
+	}
+	// Overrides of an older text no longer apply
+	initializers.DB.Where("entity = ? AND entity_id = ? AND field = ? AND source_hash <> ?", entity, id, fieldName, hash).
+		Delete(&models.TranslationOverride{})
+
+	values, missing := resolveTranslations(source, from, langs, overrides, translate)
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		// Skip the write when the text changed while translating
+		var current int64
+		if err := tx.Table(translatableEntities[entity].table).
+			Where("id = ? AND COALESCE("+column+", '') = ?", id, source).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Count(&current).Error; err != nil || current == 0 {
+			return err
+		}
+		return SaveTranslations(tx, entity, id, fieldName, values)
+	})
+	if err != nil {
+		return false, hash, fmt.Errorf("translate: save: %w", err)
+	}
+
+	return missing, hash, nil
+}
+
+// resolveTranslations returns source in every language: the author's
+// override of source, else the cached translation, else, when translate is
+// set, a fresh one. Languages left without a translation hold source and
+// are reported missing.
+func resolveTranslations(source, from string, langs []models.Langs, overrides []models.TranslationOverride, translate bool) (models.Multilang, bool) {
+	hash := textHash(source)
+	overridden := map[string]string{}
+	for _, o := range overrides {
+		if o.SourceHash == hash {
+			overridden[o.Lang] = o.Text
+		}
+	}
+
+	missing := false
+	values := models.Multilang{}
+	for _, lang := range langs {
+		value, ok := overridden[lang.Code]
+		if !ok {
+			value, ok = cachedTranslation(source, from, lang.Code)
+		}
+		if !ok && translate {
+			result, err := TranslateText(source, from, lang.Code)
+			if err != nil {
+				log.Printf("translate: %s", err)
+			} else {
+				value, ok = result, true
+			}
+		}
+		if !ok {
+			missing = true
+			value = source
+		}
+		values[lang.Code] = value
+	}
+	return values, missing
+}
+
+func cachedTranslation(text, from, to string) (string, bool) {
+	if text == "" || from == to {
+		return text, true
+	}
+	cached, err := initializers.RedisClient.Get(context.TODO(), translationKeyPrefix+translationHash(from, to, text)).Result()
+	if err != nil {
+		return "", false
+	}
+	return cached, true
+}
+
+func translationSource(entity string, id uint64, column string) (string, string, error) {
+	var row struct {
+		Source string
+		Lang   string
+	}
+	if err := initializers.DB.Table(translatableEntities[entity].table).
+		Select("COALESCE("+column+", '') AS source, lang").
+		Where("id = ?", id).
+		Take(&row).Error; err != nil {
+		return "", "", fmt.Errorf("translate: load source: %w", err)
+	}
+	if row.Lang == "" {
+		row.Lang = "auto"
+	}
+	return row.Source, row.Lang, nil
+}
+
+func lookupTranslatableField(entity, fieldName string) (string, error) {
+	column, ok := translatableEntities[entity].fields[fieldName]
+	if !ok {
+		return "", ErrTranslationField
+	}
+	return column, nil
+}
+
+func queueTranslation(job TranslationJob) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := initializers.RedisClient.LPush(context.TODO(), translationQueueKey, payload).Err(); err != nil {
+		return fmt.Errorf("translate: queue: %w", err)
+	}
+	return nil
+}
+
+func notifyTranslationOwner(job TranslationJob) {
+	var session string
+	if err := initializers.DB.Table("users").
+		Select("users.session").
+		Joins("JOIN "+translatableEntities[job.Entity].table+" t ON t.user_id = users.id").
+		Where("t.id = ?", job.ID).
+		Scan(&session).Error; err != nil || session == "" {
+		return
+	}
+
+	if err := sendMessage(session, ClientMessage{
+		Command: "translation_updated",
+		Data: map[string]interface{}{
+			"entity": job.Entity,
+			"id":     job.ID,
+			"field":  job.Field,
+		},
+	}); err != nil {
+		log.Printf("translate: notify: %s", err)
+	}
+}
+
+func textHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func translationHash(from, to, text string) string {
+	return textHash(from + "\x00" + to + "\x00" + text)
+}
+
+// legacyTranslationColumns lists the column prefixes of the fixed language
+// columns translations used to be stored in, one column per language code.
+var legacyTranslationColumns = []struct {
+	entity, table, field, prefix string
+}{
+	{models.TranslationEntityBlog, "blogs", "title", "multilang_title_"},
+	{models.TranslationEntityBlog, "blogs", "descr", "multilang_descr_"},
+	{models.TranslationEntityBlog, "blogs", "content", "multilang_content_"},
+	{models.TranslationEntityProfile, "profiles", "descr", "multilang_Descr_"},
+	{models.TranslationEntityProfile, "profiles", "additional", "multilang_Additional_"},
+}
+
+// MigrateTranslations moves translations out of the fixed language columns
+// of blogs, profiles and blog revisions into content_translations and the
+// revision jsonb columns, then drops the old columns. It is safe to run
+// repeatedly.
+func MigrateTranslations() error {
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		// The old per-language search columns are generated from the
+		// columns dropped below.
+		for _, code := range []string{"en", "ru", "es", "ka"} {
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE blogs DROP COLUMN IF EXISTS search_%s", code)).Error; err != nil {
+				return fmt.Errorf("translations: drop search_%s: %w", code, err)
+			}
+		}
+
+		for _, legacy := range legacyTranslationColumns {
+			columns, err := legacyColumns(tx, legacy.table, legacy.prefix)
+			if err != nil {
+				return err
+			}
+			for code, column := range columns {
+				if err := tx.Exec(fmt.Sprintf(
+					`INSERT INTO content_translations (entity, entity_id, field, lang, text, updated_at)
+					SELECT ?, id, ?, ?, %[1]s, NOW() FROM %[2]s WHERE COALESCE(%[1]s, '') <> ''
+					ON CONFLICT (entity, entity_id, field, lang) DO NOTHING`,
+					quoteColumn(column), legacy.table,
+				), legacy.entity, legacy.field, code).Error; err != nil {
+					return fmt.Errorf("translations: copy %s.%s: %w", legacy.table, column, err)
+				}
+				if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", legacy.table, quoteColumn(column))).Error; err != nil {
+					return fmt.Errorf("translations: drop %s.%s: %w", legacy.table, column, err)
+				}
+			}
+		}
+
+		for _, field := range []string{"title", "descr", "content"} {
+			columns, err := legacyColumns(tx, "blog_revisions", "multilang_"+field+"_")
+			if err != nil {
+				return err
+			}
+			if len(columns) == 0 {
+				continue
+			}
+
+			pairs := make([]string, 0, len(columns))
+			for code, column := range columns {
+				pairs = append(pairs, fmt.Sprintf("'%s', %s", code, quoteColumn(column)))
+			}
+			sort.Strings(pairs)
+			if err := tx.Exec(fmt.Sprintf(
+				"UPDATE blog_revisions SET multilang_%s = jsonb_strip_nulls(jsonb_build_object(%s))",
+				field, strings.Join(pairs, ", "),
+			)).Error; err != nil {
+				return fmt.Errorf("translations: convert revision %s: %w", field, err)
+			}
+
+			for _, column := range columns {
+				if err := tx.Exec(fmt.Sprintf("ALTER TABLE blog_revisions DROP COLUMN %s", quoteColumn(column))).Error; err != nil {
+					return fmt.Errorf("translations: drop blog_revisions.%s: %w", column, err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// legacyColumns returns the columns of table named prefix followed by a
+// language code, keyed by the code.
+func legacyColumns(tx *gorm.DB, table, prefix string) (map[string]string, error) {
+	var names []string
+	if err := tx.Raw(
+		"SELECT column_name FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = ?", table,
+	).Scan(&names).Error; err != nil {
+		return nil, fmt.Errorf("translations: list %s columns: %w", table, err)
+	}
+
+	columns := map[string]string{}
+	for _, name := range names {
+		code := strings.TrimPrefix(name, prefix)
+		if code == name || code == "" || strings.ContainsAny(code, `"' `) {
+			continue
+		}
+		columns[models.NormalizeLanguage(code)] = name
+	}
+	return columns, nil
+}
+
+func quoteColumn(name string) string {
+	return `"` + name + `"`
+}
@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"hyperpage/initializers"
+	"hyperpage/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// countingTranslator is FakeTranslator counting its calls.
+type countingTranslator struct {
+	calls int
+}
+
+func (c *countingTranslator) Translate(text, from, to string) (string, error) {
+	c.calls++
+	return FakeTranslator{}.Translate(text, from, to)
+}
+
+func useCountingTranslator(t *testing.T) *countingTranslator {
+	t.Helper()
+
+	counting := &countingTranslator{}
+	SetTranslator(counting)
+	t.Cleanup(func() { SetTranslator(FakeTranslator{}) })
+	return counting
+}
+
+func stubTranslationFill(t *testing.T, fill func(entity string, id uint64, field string, translate bool) (bool, string, error)) {
+	t.Helper()
+
+	previous := fillFieldTranslations
+	fillFieldTranslations = fill
+	t.Cleanup(func() { fillFieldTranslations = previous })
+}
+
+func queuedTranslationJobs(t *testing.T, f *fakeRedis) []TranslationJob {
+	t.Helper()
+
+	jobs := []TranslationJob{}
+	for _, item := range f.list(translationQueueKey) {
+		var job TranslationJob
+		if err := json.Unmarshal([]byte(item), &job); err != nil {
+			t.Fatalf("queued job %q: %v", item, err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+func TestFakeTranslator(t *testing.T) {
+	got, err := FakeTranslator{}.Translate("hello", "en", "ru")
+	if err != nil || got != "[ru] hello" {
+		t.Fatalf("Translate = %q, %v", got, err)
+	}
+}
+
+func TestTranslateTextCachesByContentHash(t *testing.T) {
+	f := useFakeRedis(t)
+	counting := useCountingTranslator(t)
+
+	for i := 0; i < 2; i++ {
+		got, err := TranslateText("hello", "en", "ru")
+		if err != nil || got != "[ru] hello" {
+			t.Fatalf("TranslateText = %q, %v", got, err)
+		}
+	}
+	if counting.calls != 1 {
+		t.Fatalf("translator called %d times, want 1", counting.calls)
+	}
+	if cached, ok := f.get(translationKeyPrefix + translationHash("en", "ru", "hello")); !ok || cached != "[ru] hello" {
+		t.Fatalf("cache = %q, %v", cached, ok)
+	}
+
+	// Another text or target language is another cache entry
+	if _, err := TranslateText("hello!", "en", "ru"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TranslateText("hello", "en", "es"); err != nil {
+		t.Fatal(err)
+	}
+	if counting.calls != 3 {
+		t.Fatalf("translator called %d times, want 3", counting.calls)
+	}
+
+	// Nothing to translate
+	if got, _ := TranslateText("hello", "en", "en"); got != "hello" || counting.calls != 3 {
+		t.Fatalf("same language: %q after %d calls", got, counting.calls)
+	}
+	if got, _ := TranslateText("", "en", "ru"); got != "" || counting.calls != 3 {
+		t.Fatalf("empty text: %q after %d calls", got, counting.calls)
+	}
+}
+
+func TestResolveTranslations(t *testing.T) {
+	f := useFakeRedis(t)
+	useCountingTranslator(t)
+
+	source := "hello"
+	langs := []models.Langs{{Code: "en"}, {Code: "ru"}, {Code: "es"}, {Code: "de"}}
+	f.strings[translationKeyPrefix+translationHash("en", "es", source)] = "hola"
+	overrides := []models.TranslationOverride{
+		{Lang: "ru", Text: "привет", SourceHash: textHash(source)},
+		// An override of an older text is ignored
+		{Lang: "de", Text: "alt", SourceHash: textHash("old text")},
+	}
+
+	values, missing := resolveTranslations(source, "en", langs, overrides, false)
+	want := models.Multilang{"en": "hello", "ru": "привет", "es": "hola", "de": "hello"}
+	if !missing || !equalMultilang(values, want) {
+		t.Fatalf("without translating: %v, missing %v; want %v, missing", values, missing, want)
+	}
+
+	values, missing = resolveTranslations(source, "en", langs, overrides, true)
+	want["de"] = "[de] hello"
+	if missing || !equalMultilang(values, want) {
+		t.Fatalf("translating: %v, missing %v; want %v", values, missing, want)
+	}
+
+	// The fresh translation is cached for the next save
+	values, missing = resolveTranslations(source, "en", langs, overrides, false)
+	if missing || values["de"] != "[de] hello" {
+		t.Fatalf("after translating: %v, missing %v", values, missing)
+	}
+}
+
+func TestTranslateFieldsQueuesMissingFields(t *testing.T) {
+	f := useFakeRedis(t)
+	stubTranslationFill(t, func(entity string, id uint64, field string, translate bool) (bool, string, error) {
+		if translate {
+			t.Fatalf("TranslateFields called the translator for %s", field)
+		}
+		return field == "title", "hash-" + field, nil
+	})
+
+	if err := TranslateFields(models.TranslationEntityBlog, 7, "title", "descr"); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := queuedTranslationJobs(t, f)
+	want := TranslationJob{Entity: models.TranslationEntityBlog, ID: 7, Field: "title", Hash: "hash-title"}
+	if len(jobs) != 1 || jobs[0] != want {
+		t.Fatalf("queued %+v, want %+v", jobs, want)
+	}
+}
+
+func TestTranslateFieldsUnknownField(t *testing.T) {
+	if err := TranslateFields(models.TranslationEntityProfile, 1, "title"); err != ErrTranslationField {
+		t.Fatalf("error = %v, want %v", err, ErrTranslationField)
+	}
+}
+
+func TestProcessTranslationJob(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		missing  bool
+		hash     string
+		requeue  int
+		notified bool
+	}{
+		{name: "done", missing: false, hash: "h", notified: true},
+		{name: "missing", missing: true, hash: "h", requeue: 1},
+		{name: "last attempt", attempts: TranslationAttempts - 1, missing: true, hash: "h"},
+		{name: "text changed", missing: false, hash: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFakeRedis(t)
+			stubTranslationFill(t, func(entity string, id uint64, field string, translate bool) (bool, string, error) {
+				if !translate {
+					t.Fatal("the worker must translate")
+				}
+				return tt.missing, tt.hash, nil
+			})
+			notified := false
+			previous := notifyTranslation
+			notifyTranslation = func(TranslationJob) { notified = true }
+			t.Cleanup(func() { notifyTranslation = previous })
+
+			job := TranslationJob{Entity: models.TranslationEntityBlog, ID: 3, Field: "title", Hash: "h", Attempts: tt.attempts}
+			processTranslationJob(job)
+
+			jobs := queuedTranslationJobs(t, f)
+			if len(jobs) != tt.requeue {
+				t.Fatalf("requeued %+v, want %d jobs", jobs, tt.requeue)
+			}
+			if tt.requeue > 0 && jobs[0].Attempts != tt.attempts+1 {
+				t.Fatalf("requeued with %d attempts, want %d", jobs[0].Attempts, tt.attempts+1)
+			}
+			if notified != tt.notified {
+				t.Fatalf("notified = %v, want %v", notified, tt.notified)
+			}
+		})
+	}
+}
+
+func TestNextTranslationJob(t *testing.T) {
+	useFakeRedis(t)
+
+	want := TranslationJob{Entity: models.TranslationEntityProfile, ID: 9, Field: "descr", Hash: "h", Attempts: 1}
+	if err := queueTranslation(want); err != nil {
+		t.Fatal(err)
+	}
+	job, err := nextTranslationJob(time.Second)
+	if err != nil || *job != want {
+		t.Fatalf("nextTranslationJob = %+v, %v; want %+v", job, err, want)
+	}
+
+	initializers.RedisClient.LPush(context.TODO(), translationQueueKey, "not json")
+	if _, err := nextTranslationJob(time.Second); !errors.Is(err, errTranslationJobInvalid) {
+		t.Fatalf("bad payload: error = %v", err)
+	}
+
+	if _, err := nextTranslationJob(time.Second); err != redis.Nil {
+		t.Fatalf("empty queue: error = %v, want redis.Nil", err)
+	}
+}
+
+func equalMultilang(a, b models.Multilang) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for code, text := range a {
+		if b[code] != text {
+			return false
+		}
+	}
+	return true
+}